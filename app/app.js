@@ -24,6 +24,7 @@ document.getElementById('login-form').addEventListener('submit', async (event) =
 async function createVideoDraft() {
   const title = document.getElementById('video-title').value;
   const description = document.getElementById('video-description').value;
+  const visibility = document.getElementById('video-visibility').value;
 
   try {
     const res = await fetch('/api/videos', {
@@ -32,7 +33,7 @@ async function createVideoDraft() {
         'Content-Type': 'application/json',
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, visibility }),
     });
     const data = await res.json();
     if (!res.ok) {
@@ -176,6 +177,8 @@ async function uploadVideoFile(videoID) {
     }
 
     console.log('Video uploaded!');
+    // 서버가 영상을 처리하는 동안 진행 상황을 버튼에 표시
+    await watchVideoProcessing(videoID, uploadBtnSelector);
     await getVideo(videoID);
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -184,6 +187,73 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+// GET /api/videos/{videoID}/events (Server-Sent Events)를 처리가 끝날 때까지 읽는 함수
+// @@@ EventSource는 Authorization header를 보낼 수 없으므로 fetch로 stream을 직접 읽는다
+async function watchVideoProcessing(videoID, selector) {
+  const res = await fetch(`/api/videos/${videoID}/events`, {
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+  });
+  if (!res.ok || !res.body) {
+    return;
+  }
+
+  const uploadBtn = document.getElementById(selector);
+  const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) return;
+    buffer += value;
+
+    // event는 빈 줄로 구분된다
+    let end;
+    while ((end = buffer.indexOf('\n\n')) !== -1) {
+      const block = buffer.slice(0, end);
+      buffer = buffer.slice(end + 2);
+      const dataLine = block.split('\n').find((line) => line.startsWith('data: '));
+      if (!dataLine) continue; // heartbeat (: ping)
+
+      const event = JSON.parse(dataLine.slice('data: '.length));
+      if (event.type === 'ready') {
+        reader.cancel();
+        return;
+      }
+      if (event.type === 'failed') {
+        reader.cancel();
+        throw new Error(`Failed to process video. Error: ${event.error}`);
+      }
+      const percent = event.percent !== undefined ? ` ${event.percent}%` : '';
+      uploadBtn.textContent = `${event.type[0].toUpperCase()}${event.type.slice(1)}...${percent}`;
+    }
+  }
+}
+
+// 영상 플레이어의 현재 위치 frame을 썸네일로 지정
+async function thumbnailFromFrame(videoID) {
+  const videoPlayer = document.getElementById('video-player');
+  if (!videoID || !videoPlayer) return;
+
+  try {
+    const res = await fetch(`/api/videos/${videoID}/thumbnail/from_frame?t=${videoPlayer.currentTime}`, {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to set thumbnail. Error: ${data.error}`);
+    }
+
+    console.log('Thumbnail updated!');
+    await getVideo(videoID);
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
 async function getVideos() {
@@ -296,6 +366,10 @@ async function deleteVideo() {
     if (!res.ok) {
       throw new Error('Failed to delete video.');
     }
+    if (res.status === 202) {
+      const data = await res.json();
+      console.log('Some stored files will be removed later:', data.pending);
+    }
     alert('Video deleted successfully.');
     document.getElementById('video-display').style.display = 'none';
     await getVideos();
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// @@@ local 저장소는 영상도 assetsRoot 아래에 저장되어 /assets file server로 누구나 받을 수 있었다
+// @@@ ==> private, unlisted 영상의 경로(/assets/<aspect>/<hash>.mp4)를 알면 인증 없이 받을 수 있으므로
+// @@@ 썸네일과 public video의 객체만 내려주고 나머지는 GET /api/videos/{videoID}/stream 으로만 볼 수 있게 한다
+// @@@ (dbVideoToSignedVideo는 local 저장소의 public이 아닌 영상에 토큰을 붙인 stream url을 준다)
+
+// /assets/ 요청의 객체가 인증 없이 내려줘도 되는 객체인지 확인하는 middleware를 만드는 apiConfig method
+// 아니면 객체가 있다는 사실도 알리지 않도록 404 (디렉토리 목록도 여기서 막힌다)
+func (cfg *apiConfig) assetAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(path.Clean(r.URL.Path), "/assets/")
+		url := cfg.getAssetURL(key)
+		storeName, key, ok := cfg.objectRefFromURL(url)
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Not found", nil)
+			return
+		}
+
+		public, err := cfg.db.IsPublicObject(storeName, key, url)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check asset access", err)
+			return
+		}
+		if !public {
+			respondWithError(w, http.StatusNotFound, "Not found", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,14 +2,19 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
-	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 // assets_root 경로 디렉토리가 있는지 확인하고 없으면 디렉토리를 생성하는 함수
@@ -32,37 +37,35 @@ func (cfg apiConfig) ensureAssetsDir() error {
 // 	return fmt.Sprintf("%s%s", videoID, ext)
 // }
 
-// Content-Type을 받아 랜덤 생성한 파일 이름으로 <randName>.<file_extension> 형태의 string 반환하는 함수
-func getAssetPath(mediaType string) string {
-	// @@@ 해답 예시처럼 랜덤 값 생성 여기서 하기
-	// 32 bytes 슬라이스 생성
-	randBytes := make([]byte, 32)
-	// crypto/rand.Read함수는 입력한 []byte에 랜덤 값 채워주는 함수
-	_, _ = rand.Read(randBytes)
-	// @@@ Read fills b with cryptographically secure random bytes. It never returns an error, and always fills b entirely.
-	randName := base64.RawURLEncoding.EncodeToString(randBytes)
+// Content-Type과 파일 내용의 sha256 hash를 받아 <hash>.<file_extension> 형태의 string 반환하는 함수
+// @@@ 랜덤 이름 대신 내용 hash를 이름으로 사용 ==> 같은 파일은 같은 key가 되어 한번만 저장된다
+func getAssetPath(mediaType, contentHash string) string {
 	ext := mediaTypeToExt(mediaType)
-	return fmt.Sprintf("%s%s", randName, ext)
+	return fmt.Sprintf("%s%s", contentHash, ext)
 }
 
-// s3 버켓에 저장되는 파일이름을 반환하는 함수. landscape, portrait, other 3가지의 prefix 사용해서
-// <prefix>/<randName>.<file_extension> 형태의 string 반환
-func getS3AssetPath(mediaType string, aspectRatio string) string {
-	// @@@ 해답 예시처럼 랜덤 값 생성 여기서 하기
-	// 32 bytes 슬라이스 생성
-	randBytes := make([]byte, 32)
-	// crypto/rand.Read함수는 입력한 []byte에 랜덤 값 채워주는 함수
-	_, _ = rand.Read(randBytes)
-	// @@@ Read fills b with cryptographically secure random bytes. It never returns an error, and always fills b entirely.
-	randName := base64.RawURLEncoding.EncodeToString(randBytes)
-	ext := mediaTypeToExt(mediaType)
-
-	return fmt.Sprintf("%s/%s%s", aspectRatio, randName, ext)
+// s3 버켓에 저장되는 썸네일 파일이름을 반환하는 함수. thumbnails/<hash>.<file_extension> 형태의 string 반환
+// @@@ 새 썸네일은 THUMBNAIL_KEY_TEMPLATE(key_layout.go)을 쓰고 이 함수는 migrate-thumbnails만 사용
+func getS3ThumbnailPath(mediaType, contentHash string) string {
+	return "thumbnails/" + getAssetPath(mediaType, contentHash)
 }
 
-// cfg.assetsRoot와 getAssetPath 함수로 만든 파일이름을 합쳐 경로 string을 반환하는 apiConfig method
-func (cfg apiConfig) getAssetDiskPath(assetPath string) string {
-	return filepath.Join(cfg.assetsRoot, assetPath)
+// @@@ 영상 파일이름을 만들던 getS3AssetPath(<prefix>/<hash>.<file_extension>)는 VIDEO_KEY_TEMPLATE(key_layout.go)으로 대체
+
+// 파일 내용의 sha256 hash를 hex string으로 반환하는 함수
+// @@@ multipart form 업로드는 받으면서 바로 hash를 계산하고, tus나 직접 업로드처럼 이미 디스크에 있는 파일만 이 함수 사용
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // db에 저장될 썸네일 url 생성하는 apiConfig method
@@ -86,8 +89,21 @@ func (cfg apiConfig) getCFURL(fileName string) string {
 	return fmt.Sprintf("%s/%s", cfg.s3CfDistribution, fileName)
 }
 
+// cfg.store에 저장된 객체의 url 생성하는 apiConfig method
+// s3 저장소는 cloud front url, local 저장소는 /assets 파일 서버 url
+func (cfg apiConfig) getStoredObjectURL(key string) string {
+	if cfg.storageBackend == "local" {
+		return cfg.getAssetURL(key)
+	}
+	return cfg.getCFURL(key)
+}
+
 // Content-Type안에 들어 있는 Mime Type이 image/<확장자> 형태이므로 확장자만 가져오는 함수
+// @@@ 영상 container 형식은 Mime Type과 확장자가 다르므로(video/quicktime ==> .mov) videoUploadExts에서 찾는다
 func mediaTypeToExt(mediaType string) string {
+	if ext, ok := videoUploadExts[mediaType]; ok {
+		return ext
+	}
 	parts := strings.Split(mediaType, "/")
 	if len(parts) != 2 {
 		return ".bin"
@@ -95,91 +111,119 @@ func mediaTypeToExt(mediaType string) string {
 	return "." + parts[1]
 }
 
-// 영상파일 파일경로를 받아 화면비를(16:9, 9:16, other 중 하나) 반환하는 함수
-// @@@ 문제 지시사항과 다르게 바로 landscape, portrait, other를 반환하도록 변경
-func getVideoAspectRatio(filePath string) (string, error) {
-	// @@@@@@ ffprobeResult 구조체 정리하기
-	// ffprobe 출력 결과(json)를 담을 구조체
-	type ffprobeResult struct {
-		Streams []struct {
-			Index              int    `json:"index"`
-			CodecName          string `json:"codec_name,omitempty"`
-			CodecLongName      string `json:"codec_long_name,omitempty"`
-			Profile            string `json:"profile,omitempty"`
-			CodecType          string `json:"codec_type"`
-			CodecTagString     string `json:"codec_tag_string"`
-			CodecTag           string `json:"codec_tag"`
-			Width              int    `json:"width,omitempty"`
-			Height             int    `json:"height,omitempty"`
-			CodedWidth         int    `json:"coded_width,omitempty"`
-			CodedHeight        int    `json:"coded_height,omitempty"`
-			ClosedCaptions     int    `json:"closed_captions,omitempty"`
-			FilmGrain          int    `json:"film_grain,omitempty"`
-			HasBFrames         int    `json:"has_b_frames,omitempty"`
-			SampleAspectRatio  string `json:"sample_aspect_ratio,omitempty"`
-			DisplayAspectRatio string `json:"display_aspect_ratio,omitempty"`
-			PixFmt             string `json:"pix_fmt,omitempty"`
-			Level              int    `json:"level,omitempty"`
-			ColorRange         string `json:"color_range,omitempty"`
-			ColorSpace         string `json:"color_space,omitempty"`
-			ColorTransfer      string `json:"color_transfer,omitempty"`
-			ColorPrimaries     string `json:"color_primaries,omitempty"`
-			ChromaLocation     string `json:"chroma_location,omitempty"`
-			FieldOrder         string `json:"field_order,omitempty"`
-			Refs               int    `json:"refs,omitempty"`
-			IsAvc              string `json:"is_avc,omitempty"`
-			NalLengthSize      string `json:"nal_length_size,omitempty"`
-			ID                 string `json:"id"`
-			RFrameRate         string `json:"r_frame_rate"`
-			AvgFrameRate       string `json:"avg_frame_rate"`
-			TimeBase           string `json:"time_base"`
-			StartPts           int    `json:"start_pts"`
-			StartTime          string `json:"start_time"`
-			DurationTs         int    `json:"duration_ts"`
-			Duration           string `json:"duration"`
-			BitRate            string `json:"bit_rate,omitempty"`
-			BitsPerRawSample   string `json:"bits_per_raw_sample,omitempty"`
-			NbFrames           string `json:"nb_frames"`
-			ExtradataSize      int    `json:"extradata_size"`
-			SampleFmt          string `json:"sample_fmt,omitempty"`
-			SampleRate         string `json:"sample_rate,omitempty"`
-			Channels           int    `json:"channels,omitempty"`
-			ChannelLayout      string `json:"channel_layout,omitempty"`
-			BitsPerSample      int    `json:"bits_per_sample,omitempty"`
-			InitialPadding     int    `json:"initial_padding,omitempty"`
-			Disposition        struct {
-				Default         int `json:"default"`
-				Dub             int `json:"dub"`
-				Original        int `json:"original"`
-				Comment         int `json:"comment"`
-				Lyrics          int `json:"lyrics"`
-				Karaoke         int `json:"karaoke"`
-				Forced          int `json:"forced"`
-				HearingImpaired int `json:"hearing_impaired"`
-				VisualImpaired  int `json:"visual_impaired"`
-				CleanEffects    int `json:"clean_effects"`
-				AttachedPic     int `json:"attached_pic"`
-				TimedThumbnails int `json:"timed_thumbnails"`
-				NonDiegetic     int `json:"non_diegetic"`
-				Captions        int `json:"captions"`
-				Descriptions    int `json:"descriptions"`
-				Metadata        int `json:"metadata"`
-				Dependent       int `json:"dependent"`
-				StillImage      int `json:"still_image"`
-			} `json:"disposition"`
-			Tags struct {
-				Language    string `json:"language"`
-				HandlerName string `json:"handler_name"`
-				VendorID    string `json:"vendor_id"`
-				Encoder     string `json:"encoder"`
-				Timecode    string `json:"timecode"`
-			} `json:"tags,omitempty"`
-		} `json:"streams"`
-	}
+// @@@@@@ ffprobeResult 구조체 정리하기
+// ffprobe 출력 결과(json)를 담을 구조체
+// @@@ 예전에는 화면비만 쓰고 나머지는 버렸지만 이제 probeVideo가 영상 정보로 db에 저장한다
+type ffprobeResult struct {
+	Streams []struct {
+		Index              int    `json:"index"`
+		CodecName          string `json:"codec_name,omitempty"`
+		CodecLongName      string `json:"codec_long_name,omitempty"`
+		Profile            string `json:"profile,omitempty"`
+		CodecType          string `json:"codec_type"`
+		CodecTagString     string `json:"codec_tag_string"`
+		CodecTag           string `json:"codec_tag"`
+		Width              int    `json:"width,omitempty"`
+		Height             int    `json:"height,omitempty"`
+		CodedWidth         int    `json:"coded_width,omitempty"`
+		CodedHeight        int    `json:"coded_height,omitempty"`
+		ClosedCaptions     int    `json:"closed_captions,omitempty"`
+		FilmGrain          int    `json:"film_grain,omitempty"`
+		HasBFrames         int    `json:"has_b_frames,omitempty"`
+		SampleAspectRatio  string `json:"sample_aspect_ratio,omitempty"`
+		DisplayAspectRatio string `json:"display_aspect_ratio,omitempty"`
+		PixFmt             string `json:"pix_fmt,omitempty"`
+		Level              int    `json:"level,omitempty"`
+		ColorRange         string `json:"color_range,omitempty"`
+		ColorSpace         string `json:"color_space,omitempty"`
+		ColorTransfer      string `json:"color_transfer,omitempty"`
+		ColorPrimaries     string `json:"color_primaries,omitempty"`
+		ChromaLocation     string `json:"chroma_location,omitempty"`
+		FieldOrder         string `json:"field_order,omitempty"`
+		Refs               int    `json:"refs,omitempty"`
+		IsAvc              string `json:"is_avc,omitempty"`
+		NalLengthSize      string `json:"nal_length_size,omitempty"`
+		ID                 string `json:"id"`
+		RFrameRate         string `json:"r_frame_rate"`
+		AvgFrameRate       string `json:"avg_frame_rate"`
+		TimeBase           string `json:"time_base"`
+		StartPts           int    `json:"start_pts"`
+		StartTime          string `json:"start_time"`
+		DurationTs         int    `json:"duration_ts"`
+		Duration           string `json:"duration"`
+		BitRate            string `json:"bit_rate,omitempty"`
+		BitsPerRawSample   string `json:"bits_per_raw_sample,omitempty"`
+		NbFrames           string `json:"nb_frames"`
+		ExtradataSize      int    `json:"extradata_size"`
+		SampleFmt          string `json:"sample_fmt,omitempty"`
+		SampleRate         string `json:"sample_rate,omitempty"`
+		Channels           int    `json:"channels,omitempty"`
+		ChannelLayout      string `json:"channel_layout,omitempty"`
+		BitsPerSample      int    `json:"bits_per_sample,omitempty"`
+		InitialPadding     int    `json:"initial_padding,omitempty"`
+		Disposition        struct {
+			Default         int `json:"default"`
+			Dub             int `json:"dub"`
+			Original        int `json:"original"`
+			Comment         int `json:"comment"`
+			Lyrics          int `json:"lyrics"`
+			Karaoke         int `json:"karaoke"`
+			Forced          int `json:"forced"`
+			HearingImpaired int `json:"hearing_impaired"`
+			VisualImpaired  int `json:"visual_impaired"`
+			CleanEffects    int `json:"clean_effects"`
+			AttachedPic     int `json:"attached_pic"`
+			TimedThumbnails int `json:"timed_thumbnails"`
+			NonDiegetic     int `json:"non_diegetic"`
+			Captions        int `json:"captions"`
+			Descriptions    int `json:"descriptions"`
+			Metadata        int `json:"metadata"`
+			Dependent       int `json:"dependent"`
+			StillImage      int `json:"still_image"`
+		} `json:"disposition"`
+		Tags struct {
+			Language    string `json:"language"`
+			HandlerName string `json:"handler_name"`
+			VendorID    string `json:"vendor_id"`
+			Encoder     string `json:"encoder"`
+			Timecode    string `json:"timecode"`
+			Rotate      string `json:"rotate"` // 예전 ffmpeg가 쓰던 회전 각도
+		} `json:"tags,omitempty"`
+		// @@@ 휴대폰으로 세로로 찍은 영상은 가로로 저장하고 display matrix(회전 정보)를 붙인다
+		SideDataList []ffprobeSideData `json:"side_data_list,omitempty"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		Size     string `json:"size"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// ffprobe stream의 side data (display matrix의 회전 각도만 사용)
+type ffprobeSideData struct {
+	SideDataType string  `json:"side_data_type"`
+	Rotation     float64 `json:"rotation"`
+}
+
+// ffprobe로 읽은 영상 파일 정보 (db에 저장하는 영상 정보 + 인코딩 방법을 정하는 데 필요한 정보)
+type videoProbe struct {
+	database.VideoMetadata
+	PixelFormat string // 영상 stream의 pixel format (yuv420p 등)
+	Rotation    int    // 재생할 때 돌려야 하는 각도 (0, 90, 180, 270)
+}
+
+// 영상파일을 ffprobe로 읽어 길이, 해상도, codec, fps, bitrate, 음성 정보를 반환하는 함수
+// @@@ FileSize는 faststart 인코딩 후 저장소에 올라간 크기를 써야 하므로 호출한 쪽에서 채운다
+func probeVideo(filePath string) (database.VideoMetadata, error) {
+	probe, err := probeVideoFile(filePath)
+	return probe.VideoMetadata, err
+}
 
+// probeVideo와 같지만 인코딩 방법을 정하는 데 필요한 정보(pixel format)도 반환하는 함수
+func probeVideoFile(filePath string) (videoProbe, error) {
 	// exec.Command는 명령어 이름과 args를 저장하는 exec.Cmd 구조체의 포인터를 반환
 	// 명령어 실행은 반환된 Cmd의 Run 메소드를 사용해야 한다
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filePath)
 	// cmd의 Stdout 필드에는 출력 결과를 담을 컨테이너의 포인터를 저장
 	var out bytes.Buffer
 	cmd.Stdout = &out
@@ -187,7 +231,7 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	// 명령어 실행
 	err := cmd.Run()
 	if err != nil {
-		return "", fmt.Errorf("error running ffprobe command: %w", err)
+		return videoProbe{}, fmt.Errorf("error running ffprobe command: %w", err)
 	}
 	// 실행 완료 후에는 out에 출력 결과가 저장된다
 
@@ -199,123 +243,251 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	// // @@@ 포인터가 아닌 밸류(bytes.Buffer)여도 Read 메소드 실행은 가능하지만
 	// // @@@ 이 때는 Go 컴파일러가 자동으로 out.Read(p)를 (&out).Read(p)로 변환해주기 때문
 	if err := json.NewDecoder(&out).Decode(&result); err != nil {
-		return "", fmt.Errorf("error decoding ffprobe's stdout: %w", err)
+		return videoProbe{}, fmt.Errorf("error decoding ffprobe's stdout: %w", err)
 	}
 
-	// 화면비 계산
-	width := result.Streams[0].Width
-	height := result.Streams[0].Height
+	// @@@ 첫 stream이 음성일 수도 있으므로 codec_type으로 영상, 음성 stream을 찾는다
+	var meta database.VideoMetadata
+	var videoDuration, pixelFormat string
+	var rotation int
+	for _, stream := range result.Streams {
+		switch stream.CodecType {
+		case "video":
+			// 앨범 표지처럼 영상 파일에 붙어 있는 그림은 건너뛴다
+			if meta.Width != 0 || stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			// @@@ 저장된 크기가 아니라 화면에 보이는 크기 (display_aspect_ratio, 회전 적용)
+			rotation = streamRotation(stream.SideDataList, stream.Tags.Rotate)
+			meta.Width, meta.Height = displaySize(stream.Width, stream.Height, stream.DisplayAspectRatio, rotation)
+			meta.VideoCodec = stream.CodecName
+			meta.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if meta.FrameRate == 0 {
+				meta.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+			videoDuration = stream.Duration
+			pixelFormat = stream.PixFmt
+		case "audio":
+			if meta.AudioCodec == "" {
+				meta.AudioCodec = stream.CodecName
+				meta.AudioChannels = stream.Channels
+			}
+		}
+	}
+	if meta.Width == 0 || meta.Height == 0 {
+		return videoProbe{}, fmt.Errorf("no video stream in %s", filePath)
+	}
 
-	standardRatio := 16.0 / 9.0
+	// 길이는 container(format) 값을 쓰고 없으면 영상 stream 값
+	meta.DurationSeconds, _ = strconv.ParseFloat(result.Format.Duration, 64)
+	if meta.DurationSeconds == 0 {
+		meta.DurationSeconds, _ = strconv.ParseFloat(videoDuration, 64)
+	}
+	meta.BitRate, _ = strconv.ParseInt(result.Format.BitRate, 10, 64)
+	return videoProbe{VideoMetadata: meta, PixelFormat: pixelFormat, Rotation: rotation}, nil
+}
 
-	if width >= height {
-		ratio := float64(width) / float64(height)
-		if ratio >= standardRatio-0.05 && ratio <= standardRatio+0.05 {
-			// return "16:9", nil
-			return "landscape", nil
-			// getS3AssetPath에서 16:9대신 landscape를 prefix로 사용하므로 바로 landscape를 저장하도록 변경
+// 영상 stream의 회전 각도를 0, 90, 180, 270 중 하나로 반환하는 함수
+// @@@ 요즘 ffmpeg는 side data의 display matrix에, 예전 ffmpeg는 rotate tag에 적는다
+// @@@ display matrix의 -90은 시계 방향으로 90도 돌려야 한다는 뜻이지만 화면 크기는 방향과 상관없다
+func streamRotation(sideData []ffprobeSideData, rotateTag string) int {
+	degrees := 0.0
+	for _, data := range sideData {
+		if data.SideDataType == "Display Matrix" {
+			degrees = data.Rotation
+			break
 		}
-	} else {
-		ratio := float64(height) / float64(width)
-		if ratio >= standardRatio-0.05 && ratio <= standardRatio+0.05 {
-			// return "9:16", nil
-			return "portrait", nil
-			// getS3AssetPath에서 9:16대신 portrait를 prefix로 사용하므로 바로 landscape를 저장하도록 변경
+	}
+	if degrees == 0 && rotateTag != "" {
+		degrees, _ = strconv.ParseFloat(rotateTag, 64)
+	}
+	// 90도 단위로 맞춘다
+	return (int(math.Round(degrees/90))%4 + 4) % 4 * 90
+}
+
+// 저장된 크기(width x height)에 display_aspect_ratio("16:9")와 회전을 적용해서 화면에 보이는 크기를 반환하는 함수
+// @@@ 화소가 정사각형이 아닌 영상(DVD, 일부 방송 녹화)은 저장된 크기와 화면 비율이 다르다 ==> 높이는 두고 너비를 비율에 맞춘다
+func displaySize(width, height int, displayAspectRatio string, rotation int) (int, int) {
+	if num, den, ok := strings.Cut(displayAspectRatio, ":"); ok && height > 0 {
+		n, err1 := strconv.Atoi(num)
+		d, err2 := strconv.Atoi(den)
+		// 모르면 0:1이나 N/A
+		if err1 == nil && err2 == nil && n > 0 && d > 0 {
+			width = int(math.Round(float64(height) * float64(n) / float64(d)))
 		}
 	}
+	if rotation == 90 || rotation == 270 {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// ffprobe의 frame rate ("30000/1001", "25/1", "0/0")를 fps 숫자로 바꾸는 함수 (모르면 0)
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		fps, _ := strconv.ParseFloat(rate, 64)
+		return fps
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// 화면비 label (key template의 {aspect}, blobs.aspect)
+// @@@ 16:9, 9:16은 예전부터 landscape, portrait로 key prefix에 써왔으므로 이름을 그대로 두고
+// @@@ 새로 추가한 화면비도 object key에 쓸 수 있는 이름으로 (4:3 ==> standard)
+const (
+	aspectSquare    = "square"    // 1:1
+	aspectStandard  = "standard"  // 4:3
+	aspectLandscape = "landscape" // 16:9
+	aspectPortrait  = "portrait"  // 9:16
+	aspectUltrawide = "ultrawide" // 21:9 등 ultrawideMinRatio 이상 가로로 긴 영상
+	aspectOther     = "other"
+)
+
+// 화면비가 이 값 이내로 차이 나면 같은 화면비로 본다
+const aspectTolerance = 0.05
+
+// ultrawide로 보는 가장 작은 가로/세로 비율 (2.2:1 이상, 21:9는 2.33)
+const ultrawideMinRatio = 2.2
+
+// 영상파일 파일경로를 받아 화면비 label을(videoAspectLabel 참고) 반환하는 함수
+// @@@ 문제 지시사항과 다르게 바로 landscape, portrait, other 등을 반환하도록 변경
+// @@@ 예전에는 Streams[0]을 그대로 읽어서 음성 stream이면 실패하고 회전된 세로 영상은 landscape로 분류했다
+// @@@ ==> probeVideo가 첫 영상 stream을 고르고 display_aspect_ratio, 회전을 적용한 크기를 쓴다
+func getVideoAspectRatio(filePath string) (string, error) {
+	meta, err := probeVideo(filePath)
+	if err != nil {
+		return "", err
+	}
+	return videoAspectLabel(meta.Width, meta.Height), nil
+}
+
+// 화면에 보이는 너비, 높이로 화면비 label(square, standard, landscape, portrait, ultrawide, other)을 반환하는 함수 (key template의 {aspect})
+func videoAspectLabel(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return aspectOther
+	}
+	// 화면비 계산
+	ratio := float64(width) / float64(height)
+	near := func(ratio, target float64) bool {
+		return math.Abs(ratio-target) <= aspectTolerance
+	}
+
+	switch {
+	case near(ratio, 1):
+		return aspectSquare
+	case near(ratio, 4.0/3.0):
+		return aspectStandard
+	case near(ratio, 16.0/9.0):
+		// getS3AssetPath에서 16:9대신 landscape를 prefix로 사용하므로 바로 landscape를 저장
+		return aspectLandscape
+	case near(1/ratio, 16.0/9.0):
+		// 세로 영상은 세로/가로 비율로 비교 (예전과 같은 범위)
+		return aspectPortrait
+	case ratio >= ultrawideMinRatio:
+		return aspectUltrawide
+	}
+	return aspectOther
+}
 
-	return "other", nil
+// 브라우저에서 재생할 수 없는 영상을 H.264로 다시 인코딩할 때의 x264 설정
+const (
+	normalizeVideoPreset = "medium"
+	normalizeVideoCRF    = 20
+)
+
+// 브라우저에서 재생할 수 없는 음성을 AAC로 다시 인코딩할 때의 bitrate
+const normalizeAudioBitrate = "128k"
+
+// 영상, 음성 stream을 mp4에 그대로 복사해도 브라우저에서 재생할 수 있는지 반환하는 함수
+// @@@ 영상은 8bit 4:2:0 H.264, 음성은 AAC(또는 음성 없음)만 그대로 쓴다 (10bit H.264는 대부분의 브라우저가 재생하지 못함)
+// @@@ autoRotate면 회전 정보가 있는 영상도 다시 인코딩해서 화소 자체를 돌린다 (회전 정보를 무시하는 player, 썸네일 도구가 있다)
+func browserCompatibleStreams(probe videoProbe, autoRotate bool) (copyVideo, copyAudio bool) {
+	copyVideo = probe.VideoCodec == "h264" && slices.Contains([]string{"", "yuv420p", "yuvj420p"}, probe.PixelFormat) &&
+		!(autoRotate && probe.Rotation != 0)
+	copyAudio = probe.AudioCodec == "" || probe.AudioCodec == "aac"
+	return copyVideo, copyAudio
+}
+
+// 인코딩 후 저장소에 올라간 영상의 정보를 반환하는 함수
+// @@@ 다시 인코딩한 stream은 codec이 바뀌고, bitrate는 올라간 파일 크기와 길이로 다시 계산한다
+func normalizedVideoMetadata(probe videoProbe, autoRotate bool, fileSize int64) database.VideoMetadata {
+	meta := probe.VideoMetadata
+	meta.FileSize = fileSize
+	copyVideo, copyAudio := browserCompatibleStreams(probe, autoRotate)
+	if !copyVideo {
+		meta.VideoCodec = "h264"
+	}
+	if !copyAudio {
+		meta.AudioCodec = "aac"
+	}
+	if (!copyVideo || !copyAudio) && meta.DurationSeconds > 0 {
+		meta.BitRate = int64(float64(fileSize*8) / meta.DurationSeconds)
+	}
+	return meta
 }
 
 // moov atom(mp4 파일의 메타데이터를 담은 부분)가 뒤에 있는 mp4 파일을
 // fast start 인코딩으로 새로 인코딩해 moov atom이 앞에 있는 새 파일을 생성하고 그 새 파일의 경로를 반환하는 함수
 // @@@ moov atom이 뒤에 있는 파일의 경우 브라우저가 처음 스트리밍 할 때 GET 리퀘스트가 3개 이상 복수 생성된다
 // // @@@ (첫부분, moov atom이 있어야 재생가능하므로 끝부분 조금, 다시 첫부분에 이어지는 조금, ...)
-func processVideoForFastStart(filePath string) (string, error) {
+// onProgress가 nil이 아니면 인코딩 진행률(0~100)을 알려준다
+// @@@ mediaType은 업로드된 container 형식, probe는 원본을 ffprobe로 읽은 정보
+// @@@ 브라우저에서 바로 재생할 수 없는 stream(HEVC, VP9, Opus 등)만 H.264/AAC로 인코딩하고 나머지는 그대로 복사한다
+// @@@ autoRotate면 회전 정보가 있는 영상을 똑바로 돌려서 인코딩한다 (VIDEO_AUTO_ROTATE)
+func processVideoForFastStart(filePath, mediaType string, probe videoProbe, autoRotate bool, onProgress func(percent float64)) (string, error) {
 	// 새 파일 경로 string 생성
 	newFilePath := fmt.Sprintf("%s.processing", filePath)
 
-	// 인코딩하는 ffmpeg 명령어 생성
-	cmd := exec.Command("ffmpeg",
-		"-i", filePath,
-		"-c", "copy",
+	// 인코딩하는 ffmpeg 명령어 인자
+	args := []string{"-i", filePath}
+	copyVideo, copyAudio := browserCompatibleStreams(probe, autoRotate)
+	if copyVideo && copyAudio && mediaType == storedVideoMediaType {
+		// 이미 H.264/AAC mp4면 예전처럼 moov atom 위치만 옮긴다
+		args = append(args, "-c", "copy")
+	} else {
+		// @@@ mov, mkv 등에는 mp4에 넣을 수 없는 stream(자막, timecode 등)이 있을 수 있으므로 첫 영상, 음성 stream만 담는다
+		args = append(args, "-map", "0:v:0", "-map", "0:a:0?")
+		if copyVideo {
+			args = append(args, "-c:v", "copy")
+		} else {
+			// yuv420p(H.264 High profile까지)는 가로, 세로가 짝수여야 한다
+			// @@@ ffmpeg는 디코딩할 때 회전 정보대로 frame을 돌리므로(autorotate) 다시 인코딩한 영상에는 회전 정보를 남기지 않는다
+			args = append(args,
+				"-c:v", "libx264",
+				"-preset", normalizeVideoPreset,
+				"-crf", strconv.Itoa(normalizeVideoCRF),
+				"-pix_fmt", "yuv420p",
+				"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+				"-metadata:s:v:0", "rotate=0",
+			)
+		}
+		if copyAudio {
+			args = append(args, "-c:a", "copy")
+		} else {
+			args = append(args, "-c:a", "aac", "-b:a", normalizeAudioBitrate)
+		}
+	}
+	args = append(args,
 		"-movflags", "faststart",
 		"-f", "mp4",
-		newFilePath)
-	// exec.Command는 명령어 이름과 args를 저장하는 exec.Cmd 구조체의 포인터를 반환
-
-	// @@@ 퍼플렉시티 제안
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	// @@@ cmd.Stderr에는 오류 발생시 ffmpeg가 내놓는 상세 에러 내역이 들어 있다
+		newFilePath,
+	)
 
 	// 명령어 실행
-	err := cmd.Run()
-	if err != nil {
-		return "", fmt.Errorf("error running ffmpeg command: %w\n%s", err, stderr.String())
+	// @@@ 실패하면 runFFmpeg가 ffmpeg의 상세 에러 내역(stderr)을 에러에 담아준다
+	if err := runFFmpeg(args, onProgress); err != nil {
+		return "", err
 	}
 
 	// 인코딩 성공 -> 새 파일 경로 반환
 	return newFilePath, nil
 }
 
-// @@@ cloud front 사용하면서 signed url 미사용
-// // 일정 시간이 지나면 expired 되는 pre-signed url을 생성하는 함수
-// func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
-// 	// s3.NewPresignClient함수는
-// 	// pre-signed url 생성에 필요한 s3.PresignClient 구조체의 포인터 반환
-// 	presignClient := s3.NewPresignClient(s3Client)
-
-// 	// PresignGetObject 메소드는 presign된 http request 생성
-// 	presignedHTTPRequest, err := presignClient.PresignGetObject(context.Background(),
-// 		&s3.GetObjectInput{ // s3.GetObjectInput 구조체는 Bucket, Key 필드 필수
-// 			Bucket: aws.String(bucket),
-// 			Key:    aws.String(key), // Key는 파일 이름(ex: portrait/<randName>.mp4)
-// 		},
-// 		s3.WithPresignExpires(expireTime), // 함수 옵션으로는 expire 기간을 추가해주는 s3.WithPresignExpires 사용
-// 	)
-// 	if err != nil {
-// 		return "", fmt.Errorf("error creating presigned http request: %w", err)
-// 	}
-
-// 	// fmt.Print(presignedHTTPRequest.URL)
-// 	// v4.PresignedHTTPRequest 구조체의 URL 필드를 반환
-// 	return presignedHTTPRequest.URL, nil
-// }
-
-// // database.Video 구조체를 입력받아(포인터가 아니므로 pass by value -> 원본 아님)
-// // VideoURL 필드에 저장된 <버킷이름>,<파일이름>을 이용해 presigned URL을 생성하고
-// // VideoURL 필드에 presigned URL이 채워진 database.Video 구조체를 반환하는 함수
-// func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
-// 	// @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
-// 	// @@@ 아직 VideoURL에 데이터("<bucketName>,<fileName>" 형태의 스트링을 가리키는 포인터)가
-// 	// @@@ 들어가서 초기화되기 전인 경우 예외 처리하기
-// 	if video.VideoURL == nil {
-// 		return video, nil
-// 	}
-// 	// @@@ 즉 handlerUploadVideo 함수가 실행되어 VideoURL이 초기화되기 전(handlerVideoMetaCreate만 실행된 상태)
-// 	// @@@ video draft를 들어가면 handlerVideoGet나 handlerVideosRetrieve이 실행되면서
-// 	// @@@ dbVideoToSignedVideo가 실행되는데 video.VideoURL은 nil이므로 이 예외처리가 없으면 밑의 Split에서 에러 발생
-// 	// @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
-
-// 	// VideoURL 필드에 저장된 <버킷이름>,<파일이름>을 Split으로 쪼개기
-// 	splitString := strings.Split(*video.VideoURL, ",")
-// 	if len(splitString) != 2 {
-// 		return database.Video{}, errors.New("error invalid videoURL : it must be in the form <bucketName>,<fileName>")
-// 	}
-
-// 	if cfg.s3Client == nil {
-// 		return database.Video{}, errors.New("error s3 client is nil")
-// 	}
-
-// 	// presigned URL 생성
-// 	presignedURL, err := generatePresignedURL(cfg.s3Client, splitString[0], splitString[1], time.Hour)
-// 	if err != nil {
-// 		return database.Video{}, fmt.Errorf("error creating presigned url: %w", err)
-// 	}
-
-// 	// VideoURL 필드에 생성한 presigned URL 입력
-// 	video.VideoURL = &presignedURL
-
-// 	return video, nil
-// }
+// @@@ generatePresignedURL은 storage.S3Store의 PresignGet 메소드로 옮김 (storage.Presigner 인터페이스)
+// @@@ dbVideoToSignedVideo는 s3 presigned url 대신 cloud front signed url을 쓰도록 signed_urls.go에 다시 구현
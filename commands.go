@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// go run . <command> [flags] 형태로 서버 대신 실행하는 관리자용 명령어들
+// ex: go run . gc -dry-run
+func runCommand(cfg *apiConfig, args []string) error {
+	switch args[0] {
+	case "gc":
+		return cfg.commandGC(args[1:])
+	case "migrate-thumbnails":
+		return cfg.commandMigrateThumbnails(args[1:])
+	case "archive":
+		return cfg.commandArchive(args[1:])
+	case "migrate-storage":
+		return cfg.commandMigrateStorage(args[1:])
+	case "rotate-master-key":
+		return cfg.commandRotateMasterKey(args[1:])
+	case "rewrite-keys":
+		return cfg.commandRewriteKeys(args[1:])
+	case "jobs":
+		return cfg.commandJobs(args[1:])
+	case "probe-videos":
+		return cfg.commandProbeVideos(args[1:])
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// gc 명령어 : 참조되지 않는 저장소 객체를 한번 정리하고 보고서를 JSON으로 출력
+func (cfg *apiConfig) commandGC(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report orphaned objects without deleting them")
+	grace := flags.Duration("grace", cfg.gcGracePeriod, "only collect objects older than this")
+	flags.Parse(args)
+
+	report, err := cfg.collectGarbage(context.Background(), *grace, *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+// migrate-thumbnails 명령어 : assetsRoot에 저장된 썸네일을 영상과 같은 저장소로 옮기고 thumbnail_url 갱신
+func (cfg *apiConfig) commandMigrateThumbnails(args []string) error {
+	flags := flag.NewFlagSet("migrate-thumbnails", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report thumbnails that would be migrated")
+	flags.Parse(args)
+
+	report, err := cfg.migrateThumbnails(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+// rewrite-keys 명령어 : 기존 객체를 VIDEO_KEY_TEMPLATE, THUMBNAIL_KEY_TEMPLATE layout으로 옮기고 보고서를 JSON으로 출력
+// @@@ template을 바꾸고 서버를 다시 시작한 뒤 실행 (그 전까지 올라온 영상은 이전 layout에 남아 있다)
+func (cfg *apiConfig) commandRewriteKeys(args []string) error {
+	flags := flag.NewFlagSet("rewrite-keys", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report objects that would be moved")
+	flags.Parse(args)
+
+	report, err := cfg.rewriteKeys(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d objects could not be moved, run the command again to retry", len(report.Errors))
+	}
+	return nil
+}
+
+// migrate-storage 명령어 : video들이 참조하는 객체를 다른 저장소로 복사하고 url을 바꾼 후 보고서를 JSON으로 출력
+// ex: go run . migrate-storage -to-backend s3 -to-bucket new-bucket -to-region us-east-1 -to-cf-distro https://xxx.cloudfront.net
+// @@@ 성공하면 STORAGE_BACKEND, S3_BUCKET 등 설정을 target으로 바꾸고 서버를 다시 시작해야 한다
+func (cfg *apiConfig) commandMigrateStorage(args []string) error {
+	flags := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	var target storageMigrationTarget
+	flags.StringVar(&target.Backend, "to-backend", "", "target backend (s3 or local)")
+	flags.StringVar(&target.Bucket, "to-bucket", "", "target s3 bucket")
+	flags.StringVar(&target.Region, "to-region", "", "target s3 region (defaults to S3_REGION)")
+	flags.StringVar(&target.CfDistribution, "to-cf-distro", "", "cloud front distribution serving the target bucket")
+	flags.StringVar(&target.Root, "to-root", "", "target directory for a local backend")
+	concurrency := flags.Int("concurrency", 4, "number of objects copied at the same time")
+	dryRun := flags.Bool("dry-run", false, "only report objects that would be migrated")
+	flags.Parse(args)
+
+	report, err := cfg.migrateStorage(context.Background(), target, *concurrency, *dryRun)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d objects could not be migrated, run the command again to resume", len(report.Errors))
+	}
+	return nil
+}
+
+// archive 명령어 : 오래 재생되지 않은 영상을 한번 보관하고 복원 중이던 영상을 마무리한 후 보고서를 JSON으로 출력
+func (cfg *apiConfig) commandArchive(args []string) error {
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report videos that would be archived")
+	after := flags.Duration("after", cfg.archiveAfter, "archive videos that have not been played for this long")
+	flags.Parse(args)
+
+	if cfg.archiveMode == "" {
+		return fmt.Errorf("ARCHIVE_MODE is not set")
+	}
+	report, err := cfg.applyLifecycle(context.Background(), *after, *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+// rotate-master-key 명령어 : 이전 master key로 암호화된 영상 객체들을 MEDIA_MASTER_KEY_ID의 key로 교체
+// @@@ MEDIA_MASTER_KEYS에 이전 key와 새 key를 모두 넣고 MEDIA_MASTER_KEY_ID를 새 key로 바꾼 뒤 실행
+// @@@ 실패한 객체가 없으면 MEDIA_MASTER_KEYS에서 이전 key를 지워도 된다
+func (cfg *apiConfig) commandRotateMasterKey(args []string) error {
+	flags := flag.NewFlagSet("rotate-master-key", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report objects that would be rotated")
+	flags.Parse(args)
+
+	report, err := cfg.rotateMasterKey(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d objects could not be rotated", len(report.Failed))
+	}
+	return nil
+}
+
+// jobs 명령어 : 대기 중이거나 처리 중인 영상 처리 job 목록을 JSON으로 출력
+func (cfg *apiConfig) commandJobs(args []string) error {
+	flags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	flags.Parse(args)
+
+	jobs, err := cfg.db.GetVideoJobs()
+	if err != nil {
+		return err
+	}
+	return printJSON(jobs)
+}
+
+// 명령어 결과를 보기 좋게 들여쓰기 한 JSON으로 출력하는 함수
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// probe-videos 명령어 : 영상 정보(길이, 해상도, codec 등)가 없는 video의 영상을 ffprobe로 읽어 채우고 보고서를 JSON으로 출력
+// @@@ 영상 정보 컬럼이 추가되기 전에 올라간 영상용
+// @@@ -all이면 이미 영상 정보가 있는 video도 다시 읽는다 (회전된 세로 영상의 크기 바로잡기)
+func (cfg *apiConfig) commandProbeVideos(args []string) error {
+	flags := flag.NewFlagSet("probe-videos", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report videos that would be probed")
+	all := flags.Bool("all", false, "probe videos that already have metadata too")
+	flags.Parse(args)
+
+	report, err := cfg.backfillVideoMetadata(context.Background(), *dryRun, *all)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d videos could not be probed, run the command again to retry", len(report.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// @@@ 일부 embed 파트너의 player는 dash만 재생할 수 있다
+// @@@ ==> PACKAGE_FORMATS에 dash가 있으면 fMP4 segment와 mpd manifest로 이루어진 dash package를 만든다
+// @@@ hls도 같이 설정되어 있으면 같은 fMP4 segment를 가리키는 hls playlist도 만들어서 인코딩과 저장을 한번만 한다
+
+// dash package의 manifest 파일 이름
+const dashManifest = "manifest.mpd"
+
+// 원본 영상을 renditions 화질들로 인코딩해서 outDir에 dash package(fMP4 segment)를 만드는 함수
+// outDir/manifest.mpd, outDir/init_<번호>.m4s, outDir/chunk_<번호>_00001.m4s, ... 형태
+// withHLS면 같은 segment를 쓰는 outDir/master.m3u8, outDir/media_<번호>.m3u8도 만든다
+// @@@ dash는 영상과 음성이 따로 adaptation set이므로 음성은 가장 높은 bitrate로 한번만 인코딩
+func transcodeDASH(filePath, outDir string, renditions []hlsRendition, portrait, hasAudio, withHLS bool, segmentSeconds int, onProgress func(percent float64)) error {
+	args := []string{"-y", "-i", filePath, "-filter_complex", renditionFilterGraph(renditions, portrait)}
+	audioBitrate := 0
+	for i, r := range renditions {
+		args = append(args, renditionVideoArgs(i, r)...)
+		audioBitrate = max(audioBitrate, r.AudioBitrate)
+	}
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		args = append(args,
+			"-map", "0:a:0",
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", audioBitrate),
+		)
+		adaptationSets += " id=1,streams=a"
+	}
+	args = append(args, segmentAlignArgs(segmentSeconds)...)
+	args = append(args,
+		"-f", "dash",
+		"-seg_duration", strconv.Itoa(segmentSeconds),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", "init_$RepresentationID$.m4s",
+		"-media_seg_name", "chunk_$RepresentationID$_$Number%05d$.m4s",
+	)
+	if withHLS {
+		// hls master playlist 이름은 ffmpeg 기본값(master.m3u8)을 그대로 쓴다
+		args = append(args, "-hls_playlist", "1")
+	}
+	args = append(args, filepath.Join(outDir, dashManifest))
+	return runFFmpeg(args, onProgress)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// 정수 환경변수를 읽는 함수, 설정 안 되어 있으면 기본값 반환
+func getEnvInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s environment variable must be an integer: %v", name, err)
+	}
+	return n
+}
+
+// true, false 환경변수를 읽는 함수, 설정 안 되어 있으면 기본값 반환
+func getEnvBool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s environment variable must be true or false: %v", name, err)
+	}
+	return b
+}
+
+// time.ParseDuration 형식(ex: 24h, 30m) 환경변수를 읽는 함수, 설정 안 되어 있으면 기본값 반환
+func getEnvDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s environment variable must be a duration (ex: 24h): %v", name, err)
+	}
+	return d
+}
+
+// s3 multipart upload 설정 환경변수를 읽는 함수 (part 크기 MB 단위)
+// @@@ migrate-storage 명령어가 target 버킷을 만들 때도 같은 설정을 쓰도록 분리
+func getMultipartOptions() storage.MultipartOptions {
+	return storage.MultipartOptions{
+		PartSize:    int64(getEnvInt("S3_MULTIPART_PART_SIZE_MB", 16)) << 20,
+		Concurrency: getEnvInt("S3_MULTIPART_CONCURRENCY", 4),
+		MaxRetries:  getEnvInt("S3_MULTIPART_MAX_RETRIES", 3),
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ffmpeg 명령어를 실행하는 함수 (실패하면 stderr를 에러에 포함)
+// onProgress가 nil이 아니면 -progress 출력으로 계산한 진행률(0~100)을 알려준다
+// @@@ 전체 길이는 ffmpeg가 처음에 stderr로 출력하는 입력 파일의 Duration을 쓴다 (ffprobe를 다시 실행하지 않도록)
+func runFFmpeg(args []string, onProgress func(percent float64)) error {
+	if onProgress == nil {
+		cmd := exec.Command("ffmpeg", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("error running ffmpeg command: %w\n%s", err, stderr.String())
+		}
+		return nil
+	}
+
+	// -progress pipe:1 ==> stdout에 key=value 줄로 진행 상황 출력, -nostats ==> stderr에 같은 내용을 또 출력하지 않음
+	cmd := exec.Command("ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error running ffmpeg command: %w", err)
+	}
+
+	// stderr는 에러 메시지용으로 모으면서 Duration 줄을 찾는다
+	var stderr bytes.Buffer
+	var duration atomic.Int64 // 마이크로초
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(io.TeeReader(stderrPipe, &stderr))
+		for scanner.Scan() {
+			if duration.Load() > 0 {
+				continue
+			}
+			if d, ok := parseFFmpegDuration(scanner.Text()); ok {
+				duration.Store(d.Microseconds())
+			}
+		}
+		io.Copy(io.Discard, stderrPipe)
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		// @@@ 예전 ffmpeg는 out_time_ms라는 이름으로 마이크로초를 출력한다
+		case "out_time_us", "out_time_ms":
+			outTime, err := strconv.ParseInt(value, 10, 64)
+			total := duration.Load()
+			if err != nil || total <= 0 || outTime < 0 {
+				continue
+			}
+			onProgress(min(float64(outTime)/float64(total)*100, 100))
+		case "progress":
+			if value == "end" {
+				onProgress(100)
+			}
+		}
+	}
+	io.Copy(io.Discard, stdout)
+	<-stderrDone
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("error running ffmpeg command: %w\n%s", err, stderr.String())
+	}
+	return nil
+}
+
+// ffmpeg stderr의 "  Duration: 00:01:02.03, start: ..." 줄에서 입력 파일 길이를 읽는 함수
+func parseFFmpegDuration(line string) (time.Duration, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "Duration: ")
+	if !ok {
+		return 0, false
+	}
+	value, _, _ := strings.Cut(rest, ",")
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		// Duration: N/A (길이를 알 수 없는 입력)
+		return 0, false
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+	return d, d > 0
+}
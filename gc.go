@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ 예전 getAssetPath, getS3AssetPath는 업로드마다 랜덤 이름을 만들었기 때문에
+// @@@ 썸네일이나 영상을 교체하면 이전 파일이 저장소에 그대로 남는다
+// @@@ ==> 저장소의 객체 목록과 db의 thumbnail_url, video_url, blobs를 비교해서 아무도 참조하지 않는 객체를 지운다
+
+// garbage collection 결과 보고서
+type gcReport struct {
+	DryRun         bool          `json:"dry_run"`
+	GracePeriod    string        `json:"grace_period"`
+	Scanned        int           `json:"scanned"`
+	Referenced     int           `json:"referenced"`
+	Orphans        []gcCandidate `json:"orphans"`
+	Deleted        int           `json:"deleted"`
+	FreedBytes     int64         `json:"freed_bytes"`
+	StaleUploads   []gcUpload    `json:"stale_uploads"` // 끝나지 않고 오래된 직접 업로드 multipart 세션 (part는 객체 목록에 보이지 않는다)
+	AbortedUploads int           `json:"aborted_uploads"`
+	Errors         []string      `json:"errors"`
+}
+
+// 끝나지 않은 multipart 세션 하나
+type gcUpload struct {
+	Key       string    `json:"key"`
+	UploadID  string    `json:"upload_id"`
+	Initiated time.Time `json:"initiated"`
+}
+
+// 참조되지 않는 객체 하나
+type gcCandidate struct {
+	Store        string    `json:"store"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// 참조되지 않고 gracePeriod보다 오래된 객체를 찾아 지우는 apiConfig method
+// dryRun이면 지우지 않고 보고서만 만든다
+// @@@ gracePeriod는 업로드가 저장소에 올라간 뒤 db가 갱신되기 전의 객체를 지우지 않기 위해 필요
+func (cfg apiConfig) collectGarbage(ctx context.Context, gracePeriod time.Duration, dryRun bool) (gcReport, error) {
+	report := gcReport{
+		DryRun:       dryRun,
+		GracePeriod:  gracePeriod.String(),
+		Orphans:      []gcCandidate{},
+		StaleUploads: []gcUpload{},
+		Errors:       []string{},
+	}
+
+	urls, err := cfg.db.GetAllVideoAssetURLs()
+	if err != nil {
+		return report, fmt.Errorf("error getting referenced urls: %w", err)
+	}
+
+	// 저장소 이름별로 참조되는 key 모으기
+	referenced := map[string]map[string]bool{
+		storeMedia:  {},
+		storeAssets: {},
+	}
+	for _, url := range urls {
+		storeName, key, ok := cfg.objectRefFromURL(url)
+		if !ok {
+			continue
+		}
+		referenced[storeName][key] = true
+	}
+
+	// hash key로 저장된 blob은 ref_count로 관리되므로 항상 참조 중으로 본다
+	blobs, err := cfg.db.GetBlobs()
+	if err != nil {
+		return report, fmt.Errorf("error getting blobs: %w", err)
+	}
+	for _, blob := range blobs {
+		if keys, ok := referenced[blob.Store]; ok {
+			keys[blob.Key] = true
+		}
+	}
+	// package(hls 등)의 segment, playlist는 url로 참조되지 않으므로 package 기록으로 확인
+	packageObjects, err := cfg.db.GetPackageObjects()
+	if err != nil {
+		return report, fmt.Errorf("error getting package objects: %w", err)
+	}
+	for _, obj := range packageObjects {
+		if keys, ok := referenced[obj.Store]; ok {
+			keys[obj.Key] = true
+		}
+	}
+
+	// local 저장소를 쓰면 cfg.store와 cfg.assetStore가 같은 디렉토리이므로 한번만 본다
+	storeNames := []string{storeAssets}
+	if cfg.store != cfg.assetStore {
+		storeNames = append(storeNames, storeMedia)
+	} else {
+		for key := range referenced[storeMedia] {
+			referenced[storeAssets][key] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-gracePeriod)
+	for _, storeName := range storeNames {
+		store, err := cfg.storeByName(storeName)
+		if err != nil {
+			return report, err
+		}
+		objects, err := store.List(ctx, "")
+		if err != nil {
+			return report, fmt.Errorf("error listing %s store: %w", storeName, err)
+		}
+
+		for _, obj := range objects {
+			report.Scanned++
+			if referenced[storeName][obj.Key] {
+				report.Referenced++
+				continue
+			}
+			if obj.LastModified.After(cutoff) {
+				continue
+			}
+
+			report.Orphans = append(report.Orphans, gcCandidate{
+				Store:        storeName,
+				Key:          obj.Key,
+				Size:         obj.Size,
+				LastModified: obj.LastModified,
+			})
+			if dryRun {
+				continue
+			}
+			if err := store.Delete(ctx, obj.Key); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+			report.Deleted++
+			report.FreedBytes += obj.Size
+		}
+	}
+
+	if err := cfg.abortStaleUploads(ctx, gracePeriod, dryRun, &report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// 직접 업로드(uploads/)의 multipart 세션 중 오래된 것을 abort 하는 apiConfig method
+// @@@ 클라이언트가 presign 받은 url로 part를 올리는 중일 수 있으므로 gracePeriod와 presign 만료 시간 중 긴 쪽보다 오래된 세션만
+func (cfg apiConfig) abortStaleUploads(ctx context.Context, gracePeriod time.Duration, dryRun bool, report *gcReport) error {
+	presigner, ok := cfg.store.(storage.Presigner)
+	if !ok {
+		return nil
+	}
+	uploads, err := presigner.ListMultipartUploads(ctx, "uploads/")
+	if err != nil {
+		return fmt.Errorf("error listing multipart uploads: %w", err)
+	}
+
+	cutoff := time.Now().Add(-max(gracePeriod, cfg.presignExpiry))
+	for _, upload := range uploads {
+		if upload.Initiated.After(cutoff) {
+			continue
+		}
+		report.StaleUploads = append(report.StaleUploads, gcUpload{
+			Key:       upload.Key,
+			UploadID:  upload.UploadID,
+			Initiated: upload.Initiated,
+		})
+		if dryRun {
+			continue
+		}
+		if err := presigner.AbortMultipartUpload(ctx, upload.Key, upload.UploadID); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		report.AbortedUploads++
+	}
+	return nil
+}
+
+// interval마다 garbage collection을 실행하는 apiConfig method
+// main에서 goroutine으로 실행
+func (cfg apiConfig) runGarbageCollector(ctx context.Context, interval, gracePeriod time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := cfg.collectGarbage(ctx, gracePeriod, false)
+		if err != nil {
+			log.Printf("error collecting garbage: %v", err)
+			continue
+		}
+		log.Printf("gc: scanned %d objects, deleted %d orphans (%d bytes), aborted %d uploads, %d errors",
+			report.Scanned, report.Deleted, report.FreedBytes, report.AbortedUploads, len(report.Errors))
+	}
+}
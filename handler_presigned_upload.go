@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// @@@ 영상 데이터가 서버를 거치지 않고 브라우저에서 버킷으로 바로 올라가는 업로드 방식
+// 1. POST /api/video_upload/{videoID}/presign 으로 pre-signed PUT url(큰 파일은 part별 url)을 받고
+// 2. 클라이언트가 그 url로 staging key(uploads/<videoID>/...)에 직접 PUT
+// 3. POST /api/video_upload/{videoID}/complete 로 서버에 알리면 서버가 HeadObject로 확인 후
+//    내려받아서 처리 job(화면비, faststart, 저장)을 만들고 staging 객체는 삭제 ==> 202 응답 후 worker가 처리
+// 업로드를 그만두면 POST /api/video_upload/{videoID}/abort 로 multipart 세션(또는 staging 객체)을 정리
+// @@@ 끝나지 않은 multipart 세션의 part는 객체 목록에 보이지 않아 gc가 못 지우고 계속 과금된다
+// @@@ ==> abort를 부르지 않고 사라진 클라이언트의 세션은 gc가 오래된 것부터 abort (collectGarbage)
+
+// staging key가 이 videoID의 것인지 확인할 때 쓰는 prefix
+func presignedUploadPrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("uploads/%s/", videoID)
+}
+
+// POST /api/video_upload/{videoID}/presign handler : 버킷에 직접 올릴 수 있는 pre-signed url 발급
+func (cfg *apiConfig) handlerPresignVideoUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	type presignedPart struct {
+		PartNumber int32  `json:"part_number"`
+		URL        string `json:"url"`
+	}
+	type response struct {
+		Key       string          `json:"key"`
+		URL       string          `json:"url,omitempty"`
+		UploadID  string          `json:"upload_id,omitempty"`
+		PartSize  int64           `json:"part_size,omitempty"`
+		Parts     []presignedPart `json:"parts,omitempty"`
+		ExpiresAt time.Time       `json:"expires_at"`
+	}
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	// pre-signed url은 s3 저장소만 지원
+	presigner, ok := cfg.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct upload is not supported by the storage backend", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !cfg.allowedVideoType(params.ContentType) {
+		respondWithError(w, http.StatusBadRequest, cfg.videoTypeError(), nil)
+		return
+	}
+	if params.Size <= 0 {
+		respondWithError(w, http.StatusBadRequest, "size is required", nil)
+		return
+	}
+	if params.Size > maxVideoUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Video file is too big", nil)
+		return
+	}
+
+	// 버킷에 올리기 전에 남은 용량 확인
+	if !cfg.checkUploadQuota(w, video, database.BlobKindVideo, params.Size) {
+		return
+	}
+
+	// staging key는 uploads/<videoID>/<randName>.<file_extension> 형태 (complete에서 확장자로 형식을 다시 찾는다)
+	randBytes := make([]byte, 16)
+	_, _ = rand.Read(randBytes)
+	key := presignedUploadPrefix(video.ID) + base64.RawURLEncoding.EncodeToString(randBytes) + mediaTypeToExt(params.ContentType)
+
+	resp := response{
+		Key:       key,
+		ExpiresAt: time.Now().UTC().Add(cfg.presignExpiry),
+	}
+
+	partSize, numParts := presigner.PartLayout(params.Size)
+	if numParts == 1 {
+		// 파일이 part 하나 크기 이하면 PUT url 하나
+		url, err := presigner.PresignPut(r.Context(), key, params.ContentType, cfg.presignExpiry)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload", err)
+			return
+		}
+		resp.URL = url
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// 큰 파일은 multipart upload 세션을 만들고 part별 url 발급
+	// 클라이언트는 파일을 part_size 단위로 잘라 각 url에 PUT 하고 응답의 ETag 헤더를 모아 complete에 보낸다
+	uploadID, err := presigner.CreateMultipartUpload(r.Context(), key, params.ContentType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create multipart upload", err)
+		return
+	}
+	resp.UploadID = uploadID
+	resp.PartSize = partSize
+
+	for i := 1; i <= numParts; i++ {
+		url, err := presigner.PresignUploadPart(r.Context(), key, uploadID, int32(i), cfg.presignExpiry)
+		if err != nil {
+			abortPresignedUpload(r.Context(), presigner, key, uploadID)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload part", err)
+			return
+		}
+		resp.Parts = append(resp.Parts, presignedPart{PartNumber: int32(i), URL: url})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// POST /api/video_upload/{videoID}/complete handler : 직접 업로드가 끝난 staging 객체를 확인하고 처리
+func (cfg *apiConfig) handlerCompleteVideoUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Key      string                  `json:"key"`
+		UploadID string                  `json:"upload_id"`
+		Parts    []storage.CompletedPart `json:"parts"`
+	}
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	presigner, ok := cfg.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct upload is not supported by the storage backend", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	// 다른 영상의 staging 객체나 임의의 key를 처리하지 못하도록 prefix 확인
+	if !strings.HasPrefix(params.Key, presignedUploadPrefix(video.ID)) || strings.Contains(params.Key, "..") {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload key", nil)
+		return
+	}
+
+	if params.UploadID != "" {
+		if len(params.Parts) == 0 {
+			respondWithError(w, http.StatusBadRequest, "parts are required for multipart upload", nil)
+			return
+		}
+		// complete 하기 전에 올라온 part 크기로 제한과 남은 용량 확인 ==> 넘으면 객체를 만들지 않고 세션을 abort
+		size, err := presigner.MultipartUploadSize(r.Context(), params.Key, params.UploadID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't find multipart upload", err)
+			return
+		}
+		if size > maxVideoUploadSize {
+			abortPresignedUpload(r.Context(), presigner, params.Key, params.UploadID)
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Video file is too big", nil)
+			return
+		}
+		if !cfg.checkUploadQuota(w, video, database.BlobKindVideo, size) {
+			abortPresignedUpload(r.Context(), presigner, params.Key, params.UploadID)
+			return
+		}
+		// @@@ complete가 실패하면 클라이언트가 part 목록을 고쳐 다시 부를 수 있도록 세션은 남겨둔다 (abort를 안 부르면 gc가 정리)
+		if err := presigner.CompleteMultipartUpload(r.Context(), params.Key, params.UploadID, params.Parts); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't complete multipart upload", err)
+			return
+		}
+	}
+
+	// HeadObject로 객체가 실제로 올라왔는지, 크기가 제한 이내인지 확인
+	info, err := cfg.store.Head(r.Context(), params.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusBadRequest, "Uploaded object not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify uploaded object", err)
+		return
+	}
+	if info.Size > maxVideoUploadSize {
+		cfg.store.Delete(r.Context(), params.Key)
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Video file is too big", nil)
+		return
+	}
+	// presign 때 보낸 size와 실제 크기가 다를 수 있으므로 다시 확인
+	if !cfg.checkUploadQuota(w, video, database.BlobKindVideo, info.Size) {
+		cfg.store.Delete(r.Context(), params.Key)
+		return
+	}
+
+	// ffprobe, ffmpeg는 로컬 파일이 필요하므로 staging 객체를 job 디렉토리로 내려받기
+	// @@@ staging 객체는 garbage collection 대상이므로 처리를 기다리는 동안 지워질 수 있다 ==> 로컬 파일을 job에 넘긴다
+	mediaType := videoTypeFromFileName(params.Key)
+	if !cfg.allowedVideoType(mediaType) {
+		cfg.store.Delete(r.Context(), params.Key)
+		respondWithError(w, http.StatusBadRequest, cfg.videoTypeError(), nil)
+		return
+	}
+	tempPath, err := downloadObjectToTempFile(r.Context(), cfg.store, params.Key, cfg.videoJobDir, "tubely-presigned_*"+mediaTypeToExt(mediaType))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download uploaded object", err)
+		return
+	}
+
+	// 화면비, faststart 인코딩(필요하면 H.264/AAC로 다시 인코딩), 저장은 worker가 처리 (runVideoJob)
+	video, err = cfg.enqueueVideoJob(video, tempPath, mediaType, "")
+	if err != nil {
+		os.Remove(tempPath)
+		if errors.Is(err, database.ErrQuotaExceeded) {
+			cfg.store.Delete(r.Context(), params.Key)
+		}
+		cfg.respondEnqueueError(w, video, info.Size, err)
+		return
+	}
+
+	// 내려받은 파일을 job에 넘겼으므로 staging 객체는 삭제
+	if err := cfg.store.Delete(r.Context(), params.Key); err != nil {
+		log.Printf("couldn't delete staging object %s: %v", params.Key, err)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, video)
+}
+
+// POST /api/video_upload/{videoID}/abort handler : 끝내지 않을 직접 업로드를 정리
+// upload_id가 있으면 multipart 세션을 abort, 없으면 이미 올라간 staging 객체를 삭제
+func (cfg *apiConfig) handlerAbortVideoUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Key      string `json:"key"`
+		UploadID string `json:"upload_id"`
+	}
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	presigner, ok := cfg.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct upload is not supported by the storage backend", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	// 다른 영상의 staging 객체나 세션을 정리하지 못하도록 prefix 확인
+	if !strings.HasPrefix(params.Key, presignedUploadPrefix(video.ID)) || strings.Contains(params.Key, "..") {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload key", nil)
+		return
+	}
+
+	if params.UploadID != "" {
+		if err := presigner.AbortMultipartUpload(r.Context(), params.Key, params.UploadID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't abort multipart upload", err)
+			return
+		}
+	} else if err := cfg.store.Delete(r.Context(), params.Key); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete uploaded object", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// multipart 세션을 abort 하는 함수 (실패하면 로그만 남기고 gc가 다시 시도)
+func abortPresignedUpload(ctx context.Context, presigner storage.Presigner, key, uploadID string) {
+	if err := presigner.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		log.Printf("couldn't abort multipart upload %s for %s: %v", uploadID, key, err)
+	}
+}
+
+// path의 videoID로 video를 찾고 JWT 유저가 소유자인지 확인하는 apiConfig method
+// 실패하면 에러 응답을 보내고 false 반환
+func (cfg *apiConfig) getOwnedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get the video's metadata", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the owner of the video", errors.New("not the owner of the video"))
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// 저장소의 객체를 dir 디렉토리의 임시파일로 내려받고 그 경로를 반환하는 함수 (파일 삭제는 호출한 쪽에서)
+// dir, pattern은 os.CreateTemp와 같다 (dir이 빈 문자열이면 시스템 임시 디렉토리)
+func downloadObjectToTempFile(ctx context.Context, store storage.ObjectStore, key, dir, pattern string) (string, error) {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tempFile, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, body); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("error downloading %s: %w", key, err)
+	}
+	return tempFile.Name(), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// @@@ cdn이 앞에 없는 경우(개발 환경, local 저장소, 서명 설정이 없는 private video)
+// @@@ 서버가 저장소의 객체를 그대로 중계해서 영상을 볼 수 있게 하는 엔드포인트
+// @@@ http.ServeContent가 Range, If-Range, If-None-Match, 206 Partial Content를 처리하고
+// @@@ storage.ObjectReader가 요청된 범위만 저장소에서 읽어오므로 파일 전체를 메모리에 올리지 않는다
+// @@@ 암호화된 영상(media_encryption.go)은 cdn으로 볼 수 없으므로 visibility와 상관없이 항상 이 엔드포인트로 전달
+
+// stream url 생성하는 apiConfig method
+// token은 private video용 stream 토큰 (빈 문자열이면 붙이지 않음)
+func (cfg apiConfig) getStreamURL(videoID uuid.UUID, token string) string {
+	streamURL := fmt.Sprintf("http://localhost:%s/api/videos/%s/stream", cfg.port, videoID)
+	if token != "" {
+		streamURL += "?token=" + token
+	}
+	return streamURL
+}
+
+// expires까지 유효한 stream 토큰을 붙인 stream url 생성하는 apiConfig method
+func (cfg apiConfig) getSignedStreamURL(videoID uuid.UUID, expires time.Time) (string, error) {
+	token, err := auth.MakeStreamToken(videoID, cfg.jwtSecret, time.Until(expires))
+	if err != nil {
+		return "", fmt.Errorf("error creating stream token: %w", err)
+	}
+	return cfg.getStreamURL(videoID, token), nil
+}
+
+// GET /api/videos/{videoID}/stream handler : 저장소의 영상을 Range 요청을 지원하며 중계
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !cfg.canStream(r, video) {
+		// @@@ private video가 있다는 사실도 알리지 않도록 403 대신 404
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has not been uploaded", nil)
+		return
+	}
+	if video.ArchiveStatus != "" {
+		// POST /api/videos/{videoID}/restore로 복원해야 재생 가능
+		respondWithError(w, http.StatusConflict, "Video is archived and must be restored before playback", nil)
+		return
+	}
+	cfg.touchVideo(video)
+
+	storeName, key, ok := cfg.objectRefFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Video is not stored by this server", nil)
+		return
+	}
+	// 암호화된 객체는 복호화하면서 읽는 reader, 아니면 storage.ObjectReader
+	reader, info, err := cfg.openMediaObject(r.Context(), storeName, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Video file not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video file", err)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	// ServeContent는 ETag 헤더가 있으면 If-Range, If-None-Match 비교에 사용
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if video.Visibility != database.VisibilityPublic {
+		// 공유 캐시에 남지 않도록
+		w.Header().Set("Cache-Control", "private")
+	}
+
+	http.ServeContent(w, r, "", info.LastModified, reader)
+}
+
+// 요청한 사람이 video를 stream 할 수 있는지 확인하는 apiConfig method
+// public, unlisted는 누구나, private은 소유자의 JWT 또는 이 video의 stream 토큰 필요
+func (cfg *apiConfig) canStream(r *http.Request, video database.Video) bool {
+	if video.Visibility != database.VisibilityPrivate {
+		return true
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		tokenVideoID, err := auth.ValidateStreamToken(token, cfg.jwtSecret)
+		return err == nil && tokenVideoID == video.ID
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	return err == nil && userID == video.UserID
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// POST /api/videos/{videoID}/thumbnail/from_frame?t=12.5 handler : 영상의 t초 위치 frame을 썸네일로 지정
+// @@@ 처리가 끝난 원본은 지워지므로 저장소의 영상을 임시파일로 받아서 frame을 뽑는다
+// @@@ 썸네일은 암호화하지 않고 올리므로 MEDIA_ENCRYPTION이 설정되어 있으면 기밀 영상의 frame이 평문으로 남지 않도록 거절
+// @@@ (썸네일 이미지를 직접 올리는 POST /api/thumbnail_upload/{videoID}는 그대로 쓸 수 있다)
+func (cfg *apiConfig) handlerThumbnailFromFrame(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	if cfg.mediaEncryption != "" {
+		respondWithError(w, http.StatusNotImplemented, "Thumbnails from video frames are disabled when media encryption is on", nil)
+		return
+	}
+
+	at, err := strconv.ParseFloat(r.URL.Query().Get("t"), 64)
+	if err != nil || at < 0 || math.IsNaN(at) || math.IsInf(at, 0) {
+		respondWithError(w, http.StatusBadRequest, "t must be a non-negative number of seconds", err)
+		return
+	}
+
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has not been uploaded", nil)
+		return
+	}
+	if video.ArchiveStatus != "" {
+		// POST /api/videos/{videoID}/restore로 복원해야 frame을 뽑을 수 있다
+		respondWithError(w, http.StatusConflict, "Video is archived and must be restored first", nil)
+		return
+	}
+	storeName, key, ok := cfg.objectRefFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Video is not stored by this server", nil)
+		return
+	}
+
+	reader, _, err := cfg.openMediaObject(r.Context(), storeName, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Video file not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video file", err)
+		return
+	}
+	defer reader.Close()
+
+	source, err := os.CreateTemp("", "tubely-frame-source_*.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		return
+	}
+	defer os.Remove(source.Name())
+	defer source.Close()
+	if _, err := io.Copy(source, reader); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to download the video file", err)
+		return
+	}
+
+	frame, err := os.CreateTemp("", "tubely-thumbnail_*.jpg")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		return
+	}
+	frame.Close()
+	defer os.Remove(frame.Name())
+
+	found, err := extractVideoFrame(source.Name(), frame.Name(), at)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to extract the frame", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("No frame at %gs, the video is shorter than that", at), nil)
+		return
+	}
+
+	stat, err := os.Stat(frame.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to stat the frame", err)
+		return
+	}
+	if !cfg.checkUploadQuota(w, video, database.BlobKindThumbnail, stat.Size()) {
+		return
+	}
+
+	video, _, err = cfg.attachFrameThumbnail(r.Context(), video, frame.Name(), database.ThumbnailSourceFrame)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to store thumbnail file", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
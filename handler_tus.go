@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// @@@ tus 1.0 이어받기 업로드 프로토콜 (https://tus.io/protocols/resumable-upload)
+// POST로 업로드를 만들고, PATCH로 Upload-Offset 위치부터 데이터를 이어서 보내고,
+// 연결이 끊기면 HEAD로 서버가 받은 offset을 물어본 뒤 그 위치부터 다시 PATCH 한다
+// 다 받으면 handlerUploadVideo와 같이 처리 job을 만들어 worker가 processUploadedVideo 과정으로 처리
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	// handlerUploadVideo와 같은 1GB 제한
+	maxVideoUploadSize = 1 << 30
+)
+
+// tus 응답에 공통으로 들어가는 헤더 설정
+func setTusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// 요청의 Tus-Resumable 헤더가 서버 버전과 같은지 확인, 다르면 412 응답 후 false 반환
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "Unsupported tus version", nil)
+		return false
+	}
+	return true
+}
+
+// OPTIONS /api/tus handler : 서버가 지원하는 tus 버전, 확장, 최대 크기 알려주기
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxVideoUploadSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/tus handler : 새 업로드 생성 (creation 확장)
+// Upload-Length 헤더에 전체 크기, Upload-Metadata 헤더에 video_id(필수)와 filetype을 받는다
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	uploadLength, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || uploadLength < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Length", err)
+		return
+	}
+	// 빈 파일은 영상으로 처리할 수 없으므로 job을 만들기 전에 거절
+	if uploadLength == 0 {
+		respondWithError(w, http.StatusBadRequest, "Upload-Length must be greater than 0", nil)
+		return
+	}
+	if uploadLength > maxVideoUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Video file is too big", nil)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+
+	videoID, err := uuid.Parse(metadata["video_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video_id in Upload-Metadata", err)
+		return
+	}
+
+	mediaType := metadata["filetype"]
+	if mediaType == "" {
+		// 브라우저가 형식을 모르는 파일은 파일 이름의 확장자로 찾는다
+		mediaType = videoTypeFromFileName(metadata["filename"])
+	}
+	if mediaType == "" {
+		mediaType = "video/mp4"
+	}
+	if !cfg.allowedVideoType(mediaType) {
+		respondWithError(w, http.StatusBadRequest, cfg.videoTypeError(), nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get the video's metadata", err)
+		return
+	}
+	// 만약 video 원 업로더 아이디와 현재 아이디가 일치하지 않는 경우 에러
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the owner of the video", errors.New("not the owner of the video"))
+		return
+	}
+
+	// Upload-Length가 남은 용량보다 크면 데이터를 받기 전에 거절
+	if !cfg.checkUploadQuota(w, video, database.BlobKindVideo, uploadLength) {
+		return
+	}
+
+	// 받은 데이터를 이어 붙일 빈 파일 생성
+	dataFile, err := os.CreateTemp(cfg.tusUploadDir, "tus_*.upload")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create upload file", err)
+		return
+	}
+	dataFile.Close()
+
+	upload, err := cfg.db.CreateTusUpload(database.CreateTusUploadParams{
+		VideoID:      videoID,
+		UserID:       userID,
+		UploadLength: uploadLength,
+		MediaType:    mediaType,
+		FilePath:     dataFile.Name(),
+		ExpiresAt:    time.Now().UTC().Add(cfg.tusUploadExpiry),
+	})
+	if err != nil {
+		os.Remove(dataFile.Name())
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/tus/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HEAD /api/tus/{uploadID} handler : 지금까지 서버가 받은 offset 알려주기
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	upload, ok := cfg.getAuthorizedTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.UploadLength, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// PATCH /api/tus/{uploadID} handler : Upload-Offset 위치부터 body 데이터를 이어서 저장
+// 마지막 데이터까지 받으면 영상 처리 후 저장소에 업로드
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+
+	// 같은 업로드에 PATCH가 동시에 들어오면 파일이 꼬이므로 업로드 id별로 잠금
+	unlock := cfg.tusLocks.Lock(r.PathValue("uploadID"))
+	defer unlock()
+
+	upload, ok := cfg.getAuthorizedTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset", err)
+		return
+	}
+	// 클라이언트가 알고 있는 offset과 서버가 받은 offset이 다르면 409 ==> 클라이언트는 HEAD로 다시 확인해야 한다
+	if offset != upload.UploadOffset {
+		respondWithError(w, http.StatusConflict, "Upload-Offset does not match", nil)
+		return
+	}
+
+	dataFile, err := os.OpenFile(upload.FilePath, os.O_WRONLY, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to open upload file", err)
+		return
+	}
+	defer dataFile.Close()
+
+	if _, err := dataFile.Seek(offset, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to seek upload file", err)
+		return
+	}
+
+	// Upload-Length를 넘는 데이터는 받지 않는다
+	remaining := upload.UploadLength - offset
+	written, copyErr := io.Copy(dataFile, io.LimitReader(r.Body, remaining))
+	// @@@ 연결이 중간에 끊겨도(copyErr != nil) 그때까지 받은 written 만큼은 offset에 반영해야
+	// @@@ 클라이언트가 HEAD로 offset을 확인한 뒤 그 위치부터 이어서 보낼 수 있다
+	newOffset := offset + written
+	expiresAt := time.Now().UTC().Add(cfg.tusUploadExpiry)
+	if err := cfg.db.UpdateTusUploadOffset(upload.ID, newOffset, expiresAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save upload offset", err)
+		return
+	}
+	if copyErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to write upload data", copyErr)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	w.Header().Set("Upload-Expires", expiresAt.Format(http.TimeFormat))
+
+	if newOffset < upload.UploadLength {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// @@@ 마지막 데이터까지 다 받음 ==> 처리 job 생성 (처리 상태는 video의 processing_status로 확인)
+	// job을 만들지 못하면 업로드 파일은 남겨두므로 클라이언트가 빈 PATCH를 다시 보내 재시도할 수 있다
+	// @@@ 용량이 모자라면(507) 업로드 파일은 남아 있으므로 용량을 비운 뒤 빈 PATCH로 다시 시도할 수 있다
+	if err := cfg.completeTusUpload(upload); err != nil {
+		if errors.Is(err, errTusVideoDeleted) {
+			respondWithError(w, http.StatusNotFound, "Video not found", err)
+			return
+		}
+		cfg.respondEnqueueError(w, database.Video{ID: upload.VideoID}, upload.UploadLength, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/tus/{uploadID} handler : 진행중인 업로드 취소 (termination 확장)
+func (cfg *apiConfig) handlerTusDelete(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	unlock := cfg.tusLocks.Lock(r.PathValue("uploadID"))
+	defer unlock()
+
+	upload, ok := cfg.getAuthorizedTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.removeTusUpload(upload); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// path의 uploadID로 업로드를 찾고 JWT 유저가 업로드를 만든 유저인지 확인하는 apiConfig method
+// 실패하면 에러 응답을 보내고 false 반환
+func (cfg *apiConfig) getAuthorizedTusUpload(w http.ResponseWriter, r *http.Request) (database.TusUpload, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.TusUpload{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.TusUpload{}, false
+	}
+
+	upload, err := cfg.db.GetTusUpload(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.TusUpload{}, false
+	}
+	// 없는 업로드와 만료된 업로드는 둘 다 404
+	if upload.ID == "" || time.Now().After(upload.ExpiresAt) {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return database.TusUpload{}, false
+	}
+	if upload.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the owner of the upload", errors.New("not the owner of the upload"))
+		return database.TusUpload{}, false
+	}
+	return upload, true
+}
+
+// 업로드하는 동안 video가 삭제되어 처리할 수 없는 경우
+var errTusVideoDeleted = errors.New("video was deleted during the upload")
+
+// 다 받은 업로드 파일을 job 디렉토리로 옮겨 처리 job을 만들고 업로드 기록을 지우는 apiConfig method
+// @@@ 업로드 파일을 그대로 두면 만료된 업로드 정리(cleanupExpiredTusUploads)가 처리 전에 지울 수 있다
+func (cfg *apiConfig) completeTusUpload(upload database.TusUpload) error {
+	// 업로드하는 동안 video가 바뀌었을 수 있으므로 다시 불러오고 소유자도 다시 확인
+	video, err := cfg.db.GetVideo(upload.VideoID)
+	if err != nil {
+		return fmt.Errorf("unable to get the video's metadata: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		// 다시 시도해도 처리할 video가 없으므로 만료될 때까지 두지 않고 업로드 파일과 기록을 바로 지운다
+		if err := cfg.removeTusUpload(upload); err != nil {
+			log.Printf("couldn't remove tus upload %s of deleted video %s: %v", upload.ID, upload.VideoID, err)
+		}
+		return errTusVideoDeleted
+	}
+	if video.UserID != upload.UserID {
+		return errors.New("not the owner of the video")
+	}
+
+	jobFile, err := os.CreateTemp(cfg.videoJobDir, "tubely-tus_*"+mediaTypeToExt(upload.MediaType))
+	if err != nil {
+		return err
+	}
+	jobFile.Close()
+	if err := os.Rename(upload.FilePath, jobFile.Name()); err != nil {
+		os.Remove(jobFile.Name())
+		return fmt.Errorf("unable to move the upload file: %w", err)
+	}
+	if _, err := cfg.enqueueVideoJob(video, jobFile.Name(), upload.MediaType, ""); err != nil {
+		// 다시 PATCH로 재시도할 수 있도록 업로드 파일 되돌리기
+		if renameErr := os.Rename(jobFile.Name(), upload.FilePath); renameErr != nil {
+			log.Printf("couldn't move %s back to tus upload %s: %v", jobFile.Name(), upload.ID, renameErr)
+		}
+		return err
+	}
+
+	// 업로드 파일은 job으로 옮겼으므로 기록만 지운다
+	return cfg.db.DeleteTusUpload(upload.ID)
+}
+
+// 업로드 파일과 db 기록을 삭제하는 apiConfig method
+func (cfg *apiConfig) removeTusUpload(upload database.TusUpload) error {
+	if err := os.Remove(upload.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return cfg.db.DeleteTusUpload(upload.ID)
+}
+
+// 만료된 업로드를 interval마다 지우는 apiConfig method (expiration 확장)
+// main에서 goroutine으로 실행
+func (cfg *apiConfig) cleanupExpiredTusUploads(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		uploads, err := cfg.db.GetExpiredTusUploads(time.Now().UTC())
+		if err != nil {
+			log.Printf("error getting expired tus uploads: %v", err)
+		}
+		for _, upload := range uploads {
+			unlock := cfg.tusLocks.Lock(upload.ID)
+			if err := cfg.removeTusUpload(upload); err != nil {
+				log.Printf("error removing expired tus upload %s: %v", upload.ID, err)
+			}
+			unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Upload-Metadata 헤더를 map으로 변환하는 함수
+// 헤더 형태는 "key1 base64(value1),key2 base64(value2),key3" (value 없는 key 가능)
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value for %q: %w", parts[0], err)
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+	}
+	return metadata, nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +11,7 @@ import (
 	"os"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -129,44 +132,50 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	// }
 	// randName := base64.RawURLEncoding.EncodeToString(randBytes)
 	// assetName := getAssetPath(randName, mediaType)
-	assetName := getAssetPath(mediaType)
-	// @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+	// @@@ 랜덤 이름 대신 내용의 sha256 hash를 이름으로 사용하도록 변경 ==> 같은 썸네일은 한번만 저장
+	// @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+
+	// 파일 크기가 남은 용량보다 크면 저장소에 올리기 전에 거절
+	if !cfg.checkUploadQuota(w, video, database.BlobKindThumbnail, header.Size) {
+		return
+	}
 
-	// ./assets 과 <videoID>.<file_extension> 를 filepath.join으로 경로 합치기
-	// ==> ./assets/<videoID>.<file_extension>
-	// assetPath := filepath.Join(cfg.assetsRoot, assetName)
-	// @@@ assets.go의 cfg.getAssetDiskPath 대신 사용
-	assetPath := cfg.getAssetDiskPath(assetName)
+	// hash는 다 읽어야 알 수 있으므로 임시파일에 받으면서 hash 계산
+	tempFile, err := os.CreateTemp("", "tubely-thumbnail_*"+mediaTypeToExt(mediaType))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		return
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
 
-	// asset 경로에 빈 파일 컨테이너 생성
-	assetFile, err := os.Create(assetPath)
+	hasher := sha256.New()
+	size, err := io.Copy(tempFile, io.TeeReader(file, hasher))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create asset file", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to copy temp file", err)
 		return
 	}
-	// @@@ 해답처럼 *os.File 도 Close를 defer로 걸어두기
-	defer assetFile.Close()
-
-	// 썸네일 데이터를 asset 경로에 복사
-	_, err = io.Copy(assetFile, file)
-	// file multipart.File은 io.Reader 인터페이스를 구현하고
-	// assetFile *os.File은 io.Writer 인터페이스를 구현
-	// 복사 후 몇 바이트를 복사했는지 반환하는 것은 필요 없으므로 _ 처리
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+
+	// @@@ 직접 os.Create, io.Copy 하던 것을 저장소 인터페이스로 변경
+	// @@@ 같은 내용의 썸네일이 이미 있으면 올리지 않는다 (자동 썸네일, from_frame과 같이 storeThumbnailBlob 사용)
+	blob, err := cfg.storeThumbnailBlob(r.Context(), video, tempFile, size, contentHash, mediaType)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to copy asset file", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to store thumbnail file", err)
 		return
 	}
 
 	// 썸네일 url 생성
 	// newThumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, assetName)
 	// @@@ assets.go의 cfg.getAssetURL 대신 사용
-	newThumbnailURL := cfg.getAssetURL(assetName)
-
-	// video의 ThumbnailURL 필드 갱신
-	video.ThumbnailURL = &newThumbnailURL
-
-	// 갱신된 video를 db에 입력해 db 갱신
-	if err := cfg.db.UpdateVideo(video); err != nil {
+	// @@@ s3 저장소면 getCFURL로 cloud front url, local 저장소면 /assets url
+	// @@@ 이미 있던 blob이 아직 assets 저장소에 있으면(migrate-thumbnails 전) 그 url 사용
+	newThumbnailURL := cfg.objectURL(blob.Store, blob.Key)
+
+	// blob 참조 연결과 thumbnail_url 갱신을 하나의 transaction으로 처리
+	// @@@ 이전 썸네일의 blob은 참조가 0이 되면 삭제 예약된다
+	// @@@ 사용자가 올린 썸네일은 영상을 다시 올려도 자동 썸네일로 바뀌지 않는다
+	if _, err := cfg.db.AttachThumbnailBlob(video.ID, blob.CreateBlobParams, newThumbnailURL, database.ThumbnailSourceUpload); err != nil {
 		// @@@ 해답처럼 map에 이미 추가된 videoID key를 다시 삭제해주어야 한다
 		// @@@ (∵ 썸네일 생성이 실패했으므로)
 		// delete(videoThumbnails, videoID) // @@@ base64 도입 후 글로벌 맵 삭제
@@ -175,5 +184,9 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// video의 ThumbnailURL 필드 갱신
+	video.ThumbnailURL = &newThumbnailURL
+	video.ThumbnailSource = database.ThumbnailSourceUpload
+
 	respondWithJSON(w, http.StatusOK, video)
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -8,16 +10,16 @@ import (
 	"net/http"
 	"os"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
-// POST /api/video_upload/{videoID} handler : 전달 받은 비디오 파일을 s3에 저장
+// POST /api/video_upload/{videoID} handler : 전달 받은 비디오 파일을 처리 job으로 넘기고 202 응답
+// 저장소(s3 또는 local)에 저장하는 것은 worker가 처리 (video_jobs.go)
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	// request 바디 최대 용량 제한 (1 << 30은 1 * 2^30 즉 1GB)
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<30)
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoUploadSize)
 	// 이 용량 제한을 넘으면 내부적으로 MaxBytesError 발생
 	// 이 에러는 io.ReadAll(r.Body)나 r.ParseMultipartForm(~)가 반환하면서 서버가 연결을 종료한다
 
@@ -58,7 +60,12 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	fmt.Println("uploading video file to s3 for video", videoID, "by user", userID)
+	// 남은 용량이 없으면 body를 읽기 전에 거절
+	if !cfg.checkUploadQuota(w, video, database.BlobKindVideo, 0) {
+		return
+	}
+
+	fmt.Println("uploading video file to storage for video", videoID, "by user", userID)
 
 	const maxMemory = 10 << 20
 	// << 20는 bit shift to left를 20번 시행한다는 의미
@@ -89,20 +96,31 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	// file이 무슨 파일인지 header에서 정보 가져오기 (이 header는 썸네일 파일의 헤더 *multipart.FileHeader)
 	// @@@ Content-Type 헤더 안에 MIME type 형태로 데이터가 들어 있으므로 mime.ParseMediaType 사용
-	mediaType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	// @@@ 브라우저가 Content-Type을 모르는 파일(.mkv 등)은 비워서 보내므로 파일 확장자로 찾는다
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = videoTypeFromFileName(header.Filename)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "invalid Content-Type", err)
 		return
 	}
-	// 썸네일이 image/jpeg나 image/png이 아닌 경우 에러 예외 처리
-	if mediaType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "video file type must be mp4", err)
+	// VIDEO_UPLOAD_TYPES에 없는 형식이면 에러 예외 처리
+	if !cfg.allowedVideoType(mediaType) {
+		respondWithError(w, http.StatusBadRequest, cfg.videoTypeError(), nil)
+		return
+	}
+
+	// 파일 크기가 남은 용량보다 크면 저장소에 올리기 전에 거절
+	if !cfg.checkUploadQuota(w, video, database.BlobKindVideo, header.Size) {
 		return
 	}
 
 	// 임시파일 생성
-	tempFile, err := os.CreateTemp("", "tubely-upload_*.mp4")
+	tempFile, err := os.CreateTemp(cfg.videoJobDir, "tubely-upload_*"+mediaTypeToExt(mediaType))
 	// dir은 ""로 두면 시스템 기본 임시파일 폴더에 저장
+	// @@@ 처리 job이 끝날 때까지 남아 있어야 하므로 VIDEO_JOB_DIR에 저장
 	// pattern으로 제공된 string 뒤에 임의의 문자열을 붙인 뒤 파일이름으로 사용
 	// // pattern에 *이 포함되면 임의의 문자열을 pattern 마지막에 붙이는 대신
 	// // 마지막 *을 임의의 문자열로 치환한 것을 파일이름으로 사용
@@ -114,14 +132,22 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 임시 파일 삭제를 defer 걸어두기
-	defer os.Remove(tempFile.Name())
+	// @@@ 처리 job에 넘긴 뒤에는 job이 끝날 때 worker가 지운다
+	queued := false
+	defer func() {
+		if !queued {
+			os.Remove(tempFile.Name())
+		}
+	}()
 	// 임시 파일 Close defer 해서 메모리 누수 방지
 	defer tempFile.Close()
 	// @@@ defer는 LIFO
 	// // @@@ 따라서 tempFile.Close()가 먼저 실행되고 그 다음에 os.Remove가 실행된다
 
 	// 비디오 데이터를 임시파일로 복사
-	_, err = io.Copy(tempFile, file)
+	// @@@ io.TeeReader로 임시파일에 쓰는 동시에 sha256 hash 계산 ==> 파일을 다시 읽지 않아도 된다
+	hasher := sha256.New()
+	_, err = io.Copy(tempFile, io.TeeReader(file, hasher))
 	// file multipart.File은 io.Reader 인터페이스를 구현하고
 	// tempFile *os.File은 io.Writer 인터페이스를 구현(Write 함수)
 	// 복사 후 몇 바이트를 복사했는지 반환하는 것은 필요 없으므로 _ 처리
@@ -129,88 +155,23 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Unable to copy temp file", err)
 		return
 	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
 
-	// 임시파일을 ffprobe명령어로 살펴보고 화면비를 얻기
-	// 반드시 io.Copy 뒤에 있어야 실제로 디스크에 저장된 임시파일의 데이터를 가져올 수 있음
-	videoAspectRatio, err := getVideoAspectRatio(tempFile.Name())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to compute aspect ratio", err)
-		return
-	}
-
-	// tempFile은 io.Copy로 데이터를 복사받으면서 내부 포인터가 복사받은 데이터 끝부분을 가리키고 있음
-	// ==> Seek(0, io.SeekStart)로 데이터 첫부분을 가리키도록 변경
-	// // @@@ tempFile을 다시 사용해 s3에 복사하므로 포인터가 데이터 첫부분을 가리켜야 한다
-	tempFile.Seek(0, io.SeekStart)
-	// 두번째 인자 whence가 0(io.SeekStart)이면 파일 첫부분, 1는 현재 포인터 위치, 2는 파일 끝부분
-	// 첫번째 인자 offset은 whence에서 지정한 위치에 offset만큼 포인터 위치 이동
-	// @@@ 해답은
-	// _, err = tempFile.Seek(0, io.SeekStart)
-	// if err != nil {
-	// 	respondWithError(w, http.StatusInternalServerError, "Could not reset file pointer", err)
-	// 	return
-	// } 로 에러처리 하고 있음
-
-	// @@@ faststart 인코딩인 새파일 생성
-	newFilePath, err := processVideoForFastStart(tempFile.Name())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create a new faststart encoding video file", err)
+	if err := tempFile.Close(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save temp file", err)
 		return
 	}
 
-	newTempFile, err := os.Open(newFilePath)
+	// ffprobe, faststart 인코딩, 저장소 업로드, db 갱신은 worker가 processUploadedVideo로 처리
+	// @@@ 큰 영상도 요청이 바로 끝난다 ==> 클라이언트는 processing_status가 ready 또는 failed가 될 때까지 GET으로 확인
+	video, err = cfg.enqueueVideoJob(video, tempFile.Name(), mediaType, contentHash)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to open the new faststart encoding video file", err)
-		return
-	}
-	// 임시 파일 삭제를 defer 걸어두기
-	defer os.Remove(newFilePath)
-	// 임시 파일 Close defer 해서 메모리 누수 방지
-	defer newTempFile.Close()
-	// @@@ defer는 LIFO
-	// // @@@ 따라서 newTempFile.Close()가 먼저 실행되고 그 다음에 os.Remove가 실행된다
-
-	// @@@ s3에 파일 업로드 @@@
-
-	// 업로드에 필요한 정보를 담은 s3.PutObjectInput 구조체 생성
-	fileName := getS3AssetPath(mediaType, videoAspectRatio)
-	// 파일이름은 <prefix>/<randName>.<file_extension> 형태
-	putObjectInput := s3.PutObjectInput{
-		// Bucket: &cfg.s3Bucket, // bucket 이름은 cfg.s3Bucket 또는 .env에 S3_BUCKET로 저장되어 있음
-		// @@@ 해답처럼 aws.String 활용하기
-		Bucket: aws.String(cfg.s3Bucket),
-		// Key:    &fileName,
-		Key:  aws.String(fileName),
-		Body: newTempFile,
-		// tempFile은 io.Reader 인터페이스도 구현(Read함수)
-		// ContentType: &mediaType,
-		ContentType: aws.String(mediaType),
-	}
-	// s3.Client의 PutObject 메소드로 s3에 파일 업로드
-	_, err = cfg.s3Client.PutObject(r.Context(), &putObjectInput)
-	// @@@ 해답은 &s3.PutObjectInput{~~}로 함수 인자 입력안에서 구조체 바로 생성하고 그 포인터 입력
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to upload the file to S3", err)
-		return
-	}
-
-	// newVideoURL는 "<cloud front domain name>/<fileName>" 형태
-	newVideoURL := cfg.getCFURL(fileName)
-	video.VideoURL = &newVideoURL
-
-	// @@@ cloud front 사용하면서 signed url 미사용
-	// // @@@ db에 저장되는 VideoURL은 <bucketName>,<fileName> 형태를 유지해야 handlerVideoGet과 같은 다른 함수에서도
-	// // @@@ <bucketName>,<fileName> 값을 접근해 dbVideoToSignedVideo가 사용가능해진다
-	// // @@@ 여기서 presignedVideo, err := cfg.dbVideoToSignedVideo(video)를 하고
-	// // @@@ db에 저장되는 VideoURL값을 presigned URL로 변경해서 입력하면 안된다
-
-	// 갱신된 video를 db에 입력해 db 갱신
-	if err := cfg.db.UpdateVideo(video); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update the video's metadata", err)
+		cfg.respondEnqueueError(w, video, header.Size, err)
 		return
 	}
+	queued = true
 
-	respondWithJSON(w, http.StatusOK, video)
+	respondWithJSON(w, http.StatusAccepted, video)
 
 	// @@@ cloud front 사용하면서 signed url 미사용
 	// // @@@ db가 아닌 http response에 보내는 databse.Video 구조체만 VideoURL 필드를 presigned url로 변경
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// @@@ 업로드 후 처리가 끝날 때까지 GET /api/videos/{videoID}로 계속 확인하지 않아도 되도록
+// @@@ Server-Sent Events로 처리 단계와 진행률을 보낸다 (event 종류는 video_events.go)
+// @@@ 처리가 끝나면(ready, failed) 마지막 event를 보내고 연결을 닫는다
+
+// 연결이 중간의 proxy에서 끊기지 않도록 보내는 주석 줄 간격
+const videoEventsHeartbeat = 15 * time.Second
+
+// GET /api/videos/{videoID}/events handler : video 처리 진행 상황을 SSE로 전달
+func (cfg *apiConfig) handlerVideoEvents(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	// @@@ 구독한 뒤에 db 상태를 다시 읽어야 그 사이에 끝난 처리의 마지막 event를 놓치지 않는다
+	events, last, unsubscribe := cfg.videoEvents.subscribe(video.ID)
+	defer unsubscribe()
+	video, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get the video's metadata", err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// 지금 상태부터 보낸다
+	current := last
+	switch video.ProcessingStatus {
+	case database.ProcessingStatusReady:
+		current = videoEvent{Type: videoEventReady}
+	case database.ProcessingStatusFailed:
+		current = videoEvent{Type: videoEventFailed}
+		if video.ProcessingError != nil {
+			current.Error = *video.ProcessingError
+		}
+	case "":
+		// 아직 업로드하지 않은 video ==> 업로드가 시작되면 event가 온다
+	default:
+		if current.Type == "" {
+			// 서버를 다시 시작해서 메모리에 진행 상황이 없는 경우
+			current = videoEvent{Type: video.ProcessingStatus}
+		}
+	}
+	if current.Type != "" {
+		if err := writeVideoEvent(w, rc, current); err != nil || current.final() {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(videoEventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case event := <-events:
+			if err := writeVideoEvent(w, rc, event); err != nil || event.final() {
+				return
+			}
+		}
+	}
+}
+
+// event 하나를 SSE 형식(event: 종류, data: json)으로 쓰고 바로 보내는 함수
+func writeVideoEvent(w http.ResponseWriter, rc *http.ResponseController, event videoEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
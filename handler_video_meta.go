@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -33,6 +38,20 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	// visibility를 보내지 않으면 CreateVideo에서 private으로 생성
+	if params.Visibility != "" && !database.ValidVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "visibility must be public, unlisted or private", nil)
+		return
+	}
+
+	usage, err := cfg.db.GetUserUsage(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if !cfg.checkVideoCountQuota(w, usage) {
+		return
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -72,12 +91,40 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	// video row 삭제와 영상, 썸네일 객체 삭제 예약을 한 transaction으로 처리
+	// ==> 저장소가 잠시 죽어 있어도 예약이 남아 있으므로 runPendingDeletions가 나중에 다시 지운다
+	queued, err := cfg.db.DeleteVideoAndQueueObjects(videoID, cfg.videoObjects(video))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
 
+	// 예약된 객체들은 바로 한번 지워보고 실패한 것만 응답에 알려준다
+	type pendingObject struct {
+		Store string `json:"store"`
+		Key   string `json:"key"`
+		Error string `json:"error"`
+	}
+	type response struct {
+		Pending []pendingObject `json:"pending"`
+	}
+	resp := response{Pending: []pendingObject{}}
+	for _, pd := range queued {
+		if err := cfg.attemptPendingDeletion(r.Context(), pd); err != nil {
+			resp.Pending = append(resp.Pending, pendingObject{
+				Store: pd.Store,
+				Key:   pd.Key,
+				Error: err.Error(),
+			})
+		}
+	}
+
+	if len(resp.Pending) > 0 {
+		// video는 삭제되었지만 일부 객체는 아직 삭제되지 않았고 재시도 예정 ==> 202
+		respondWithJSON(w, http.StatusAccepted, resp)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -94,20 +141,45 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, video)
+	// GetVideo는 row가 없으면 빈 Video와 nil 에러를 반환
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	// public, unlisted는 링크만 있으면 누구나 볼 수 있고 private은 소유자의 JWT 필요
+	if video.Visibility == database.VisibilityPrivate {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+			return
+		}
+		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+		if video.UserID != userID {
+			// @@@ private video가 있다는 사실도 알리지 않도록 403 대신 404
+			respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+			return
+		}
+	}
+
+	// 영상 url을 받아가는 조회도 재생으로 본다 (cdn으로 재생하면 서버를 거치지 않으므로)
+	cfg.touchVideo(video)
 
-	// @@@ cloud front 사용하면서 signed url 미사용
-	// // dbVideoToSignedVideo 메소드는
-	// // VideoURL 필드에 변환된 presigned URL을 담은 새 database.Video 구조체를 반환
-	// // @@@ video.VideoURL은 "<bucketName>,<fileName>" 형태
-	// presignedVideo, err := cfg.dbVideoToSignedVideo(video)
-	// if err != nil {
-	// 	respondWithError(w, http.StatusInternalServerError, "Unable to create presigned url", err)
-	// 	return
-	// }
-
-	// // 반환되는 presignedVideo는 db와 다르게 VideoURL 필드가 presigned URL
-	// respondWithJSON(w, http.StatusOK, presignedVideo)
+	// @@@ cloud front signed url 도입 후 다시 dbVideoToSignedVideo 사용
+	// dbVideoToSignedVideo 메소드는
+	// VideoURL, ThumbnailURL 필드에 visibility에 맞는 url(public은 그대로, 나머지는 signed url)을 담은 새 database.Video 구조체를 반환
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create signed url", err)
+		return
+	}
+
+	// 반환되는 signedVideo는 db와 다르게 url 필드가 유효 기간이 있는 signed url
+	respondWithJSON(w, http.StatusOK, signedVideo)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -122,28 +194,95 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	// ?orientation=portrait&min_duration=10&max_duration=60 처럼 영상 정보로 거르기
+	filter, err := parseVideoFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	videos, err := cfg.db.GetVideos(userID, filter)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
+	// @@@ cloud front signed url 도입 후 다시 dbVideoToSignedVideo 사용
+	// VideoURL 필드에 signed url을 저장한 signed video를 담을 새로운 슬라이스
+	// @@@ make([]database.Video, len(videos))에 append하면 앞쪽에 빈 video들이 남으므로 cap만 지정
+	signedVideos := make([]database.Video, 0, len(videos))
+
+	for _, video := range videos {
+		signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to create signed url", err)
+			return
+		}
+
+		signedVideos = append(signedVideos, signedVideo)
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideos)
+}
+
+// GET /api/videos의 query parameter를 database.VideoFilter로 읽는 함수
+func parseVideoFilter(query url.Values) (database.VideoFilter, error) {
+	filter := database.VideoFilter{Orientation: query.Get("orientation")}
+	if filter.Orientation != "" && !database.ValidOrientation(filter.Orientation) {
+		return filter, fmt.Errorf("orientation must be one of %s, %s, %s",
+			database.OrientationLandscape, database.OrientationPortrait, database.OrientationSquare)
+	}
+	for name, dest := range map[string]*float64{
+		"min_duration": &filter.MinDuration,
+		"max_duration": &filter.MaxDuration,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return filter, fmt.Errorf("%s must be a non-negative number of seconds", name)
+		}
+		*dest = seconds
+	}
+	if filter.MaxDuration > 0 && filter.MinDuration > filter.MaxDuration {
+		return filter, errors.New("min_duration must not be greater than max_duration")
+	}
+	return filter, nil
+}
+
+// PUT /api/videos/{videoID}/visibility handler : video의 visibility 변경 (소유자만)
+func (cfg *apiConfig) handlerVideoVisibilityUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Visibility string `json:"visibility"`
+	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
 
-	// @@@ cloud front 사용하면서 signed url 미사용
-	// // 기존의 "<bucketName>,<fileName>" 형태를 VideoURL 필드에 가진 video들의 슬라이스 videos 대신
-	// // VideoURL 필드에 presigned url을 저장한 presigned video를 담을 새로운 슬라이스
-	// presignedVideos := make([]database.Video, len(videos))
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !database.ValidVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "visibility must be public, unlisted or private", nil)
+		return
+	}
 
-	// for _, video := range videos {
-	// 	presignedVideo, err := cfg.dbVideoToSignedVideo(video)
-	// 	if err != nil {
-	// 		respondWithError(w, http.StatusInternalServerError, "Unable to create presigned url", err)
-	// 		return
-	// 	}
+	if err := cfg.db.SetVideoVisibility(video.ID, params.Visibility); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
 
-	// 	presignedVideos = append(presignedVideos, presignedVideo)
-	// }
+	video, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
 
-	// respondWithJSON(w, http.StatusOK, presignedVideos)
+	respondWithJSON(w, http.StatusOK, video)
 }
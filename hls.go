@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// @@@ faststart mp4 하나만 있으면 느린 회선에서는 재생이 계속 멈춘다
+// @@@ ==> HLS_LADDER가 설정되어 있으면 화질별로 인코딩한 hls package(master playlist, 화질별 playlist, segment)도 만든다
+// @@@ 화질 ladder는 dash package(dash.go)도 같이 쓴다, 저장소에 올리는 과정은 video_packages.go
+
+// hls 화질 하나 (ladder의 한 칸)
+type hlsRendition struct {
+	Height       int // 짧은 변 기준 해상도 (1080, 720, ...) ==> 세로 영상은 가로 길이
+	VideoBitrate int // kbps
+	AudioBitrate int // kbps
+}
+
+func (r hlsRendition) name() string {
+	return fmt.Sprintf("%dp", r.Height)
+}
+
+// audio bitrate를 정하지 않은 화질의 기본값 (kbps)
+const defaultHLSAudioBitrate = 128
+
+// hls package의 master playlist 파일 이름
+const hlsMasterPlaylist = "master.m3u8"
+
+// HLS_LADDER 값을 읽는 함수
+// "<높이>:<영상 bitrate>[:<음성 bitrate>]"를 쉼표로 이어 쓴다 (ex: 1080:5000k:192k,720:2800k,480:1400k,360:800k:96k)
+func parseHLSLadder(spec string) ([]hlsRendition, error) {
+	ladder := []hlsRendition{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid rendition %q (must be <height>:<video bitrate>[:<audio bitrate>])", entry)
+		}
+		height, err := strconv.Atoi(parts[0])
+		if err != nil || height <= 0 || height%2 != 0 {
+			return nil, fmt.Errorf("invalid height %q in rendition %q (must be a positive even number)", parts[0], entry)
+		}
+		r := hlsRendition{Height: height, AudioBitrate: defaultHLSAudioBitrate}
+		if r.VideoBitrate, err = parseKbps(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid video bitrate in rendition %q: %w", entry, err)
+		}
+		if len(parts) == 3 {
+			if r.AudioBitrate, err = parseKbps(parts[2]); err != nil {
+				return nil, fmt.Errorf("invalid audio bitrate in rendition %q: %w", entry, err)
+			}
+		}
+		if slices.ContainsFunc(ladder, func(other hlsRendition) bool { return other.Height == height }) {
+			return nil, fmt.Errorf("duplicate rendition height %d", height)
+		}
+		ladder = append(ladder, r)
+	}
+	// 높은 화질부터 (master playlist에도 이 순서로 나온다)
+	slices.SortFunc(ladder, func(a, b hlsRendition) int { return b.Height - a.Height })
+	return ladder, nil
+}
+
+// "800k", "5M", "800" 같은 bitrate를 kbps로 바꾸는 함수
+func parseKbps(value string) (int, error) {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "k"), strings.HasSuffix(value, "K"):
+		value = value[:len(value)-1]
+	case strings.HasSuffix(value, "M"), strings.HasSuffix(value, "m"):
+		value = value[:len(value)-1]
+		multiplier = 1000
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bitrate %q must be a positive number with an optional k or M suffix", value)
+	}
+	return n * multiplier, nil
+}
+
+// 원본보다 큰 화질은 빼고 인코딩할 화질 목록을 반환하는 함수
+// 원본이 가장 낮은 화질보다 작으면 그 화질의 bitrate로 원본 해상도 하나만 만든다
+func selectHLSRenditions(ladder []hlsRendition, shortSide int) []hlsRendition {
+	selected := []hlsRendition{}
+	for _, r := range ladder {
+		if r.Height <= shortSide {
+			selected = append(selected, r)
+		}
+	}
+	if len(selected) == 0 && len(ladder) > 0 {
+		lowest := ladder[len(ladder)-1]
+		lowest.Height = shortSide - shortSide%2
+		selected = append(selected, lowest)
+	}
+	return selected
+}
+
+// hls 인코딩에 필요한 원본 정보 (해상도, 음성 유무)를 ffprobe로 읽는 함수
+// @@@ ffmpeg는 회전 정보가 있는 영상을 돌려서 인코딩하므로 화면에 보이는 크기(probeVideoFile)로 세로 영상인지 판단한다
+func probeHLSSource(filePath string) (width, height int, hasAudio bool, err error) {
+	probe, err := probeVideoFile(filePath)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return probe.Width, probe.Height, probe.AudioCodec != "", nil
+}
+
+// 화질별로 원본을 나눠서 짧은 변을 화질 높이에 맞추는 ffmpeg filter graph
+// ex: [0:v]split=2[s0][s1];[s0]scale=-2:1080[v0];[s1]scale=-2:720[v1]
+// @@@ 세로 영상은 가로 길이를 맞추고 긴 변은 비율대로 (짝수)
+func renditionFilterGraph(renditions []hlsRendition, portrait bool) string {
+	filters := []string{fmt.Sprintf("[0:v]split=%d", len(renditions))}
+	for i := range renditions {
+		filters[0] += fmt.Sprintf("[s%d]", i)
+	}
+	for i, r := range renditions {
+		scale := fmt.Sprintf("scale=-2:%d", r.Height)
+		if portrait {
+			scale = fmt.Sprintf("scale=%d:-2", r.Height)
+		}
+		filters = append(filters, fmt.Sprintf("[s%d]%s[v%d]", i, scale, i))
+	}
+	return strings.Join(filters, ";")
+}
+
+// i번째 화질의 영상 출력 stream 인코딩 옵션 (renditionFilterGraph의 [v<i>]를 사용)
+func renditionVideoArgs(i int, r hlsRendition) []string {
+	return []string{
+		"-map", fmt.Sprintf("[v%d]", i),
+		fmt.Sprintf("-c:v:%d", i), "libx264",
+		fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+		fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+		fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+	}
+}
+
+// 모든 화질의 segment 경계(key frame)를 segmentSeconds마다 맞추는 인코딩 옵션
+// @@@ 화질끼리 경계가 같아야 재생 중 화질 전환이 끊기지 않는다
+func segmentAlignArgs(segmentSeconds int) []string {
+	return []string{
+		"-preset", "veryfast",
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+	}
+}
+
+// 원본 영상을 renditions 화질들로 인코딩해서 outDir에 hls package(MPEG-TS segment)를 만드는 함수
+// outDir/master.m3u8, outDir/<화질>/index.m3u8, outDir/<화질>/segment_000.ts, ... 형태
+// @@@ ffmpeg 한번 실행으로 모든 화질을 만든다 (onProgress로 진행률)
+func transcodeHLS(filePath, outDir string, renditions []hlsRendition, portrait, hasAudio bool, segmentSeconds int, onProgress func(percent float64)) error {
+	args := []string{"-y", "-i", filePath, "-filter_complex", renditionFilterGraph(renditions, portrait)}
+	streamMap := []string{}
+	for i, r := range renditions {
+		args = append(args, renditionVideoArgs(i, r)...)
+		entry := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			// hls 화질 playlist는 영상과 음성을 같이 담으므로 화질마다 음성 stream을 하나씩 만든다
+			args = append(args,
+				"-map", "0:a:0",
+				fmt.Sprintf("-c:a:%d", i), "aac",
+				fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", r.AudioBitrate),
+			)
+			entry += fmt.Sprintf(",a:%d", i)
+		}
+		streamMap = append(streamMap, entry+",name:"+r.name())
+	}
+	args = append(args, segmentAlignArgs(segmentSeconds)...)
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(outDir, "%v", "segment_%03d.ts"),
+		"-master_pl_name", hlsMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outDir, "%v", "index.m3u8"),
+	)
+	return runFFmpeg(args, onProgress)
+}
@@ -19,6 +19,7 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "tubely-access"
+	TokenTypeStream TokenType = "tubely-stream" // 영상 하나를 stream 하는데만 쓰는 토큰
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -112,6 +113,50 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// video 하나의 stream url에 붙이는 토큰 생성함수
+// @@@ <video> 태그는 Authorization 헤더를 보낼 수 없으므로 private video는 url의 token 파라미터로 인증
+// @@@ subject가 userID가 아니라 videoID이고 Issuer가 다르므로 access token으로는 쓸 수 없다
+func MakeStreamToken(videoID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeStream),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   videoID.String(),
+	})
+	return token.SignedString([]byte(tokenSecret))
+}
+
+// stream 토큰 검증함수, 검증 후 videoID 반환
+func ValidateStreamToken(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claimsStruct := jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&claimsStruct,
+		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if issuer != string(TokenTypeStream) {
+		return uuid.Nil, errors.New("invalid issuer")
+	}
+
+	videoIDString, err := token.Claims.GetSubject()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(videoIDString)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid video ID: %w", err)
+	}
+	return id, nil
+}
+
 // Authorization header에 들어있는 인증 정보에서 tokenString만 추출해서 반환하는 함수
 func GetBearerToken(headers http.Header) (string, error) {
 	// http.Header에서 Get으로 정보 불러오기
@@ -0,0 +1,348 @@
+package cfsign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cloud front signed url, signed cookie 생성과 검증
+// @@@ cloud front는 RSA-SHA1 서명만 지원한다
+// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/private-content-signed-urls.html
+
+var (
+	ErrExpired          = errors.New("signature expired")
+	ErrNotYetValid      = errors.New("signature not yet valid")
+	ErrResourceMismatch = errors.New("policy resource does not match url")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// cloud front signed url 파라미터와 signed cookie 이름
+const (
+	CookiePolicy    = "CloudFront-Policy"
+	CookieSignature = "CloudFront-Signature"
+	CookieKeyPairID = "CloudFront-Key-Pair-Id"
+)
+
+// cloud front policy 문서
+// @@@ 필드 순서와 공백이 서명 대상이므로 marshalPolicy 결과를 그대로 서명한다
+type Policy struct {
+	Statement []Statement `json:"Statement"`
+}
+
+type Statement struct {
+	Resource  string    `json:"Resource"`
+	Condition Condition `json:"Condition"`
+}
+
+type Condition struct {
+	DateLessThan    epochTime  `json:"DateLessThan"`
+	DateGreaterThan *epochTime `json:"DateGreaterThan,omitempty"`
+	IPAddress       *sourceIP  `json:"IpAddress,omitempty"`
+}
+
+type epochTime struct {
+	EpochTime int64 `json:"AWS:EpochTime"`
+}
+
+type sourceIP struct {
+	SourceIP string `json:"AWS:SourceIp"`
+}
+
+// resource를 expires까지 허용하는 canned policy
+// signed url에는 policy 대신 Expires 파라미터만 들어간다
+func NewCannedPolicy(resource string, expires time.Time) Policy {
+	return Policy{Statement: []Statement{{
+		Resource:  resource,
+		Condition: Condition{DateLessThan: epochTime{expires.Unix()}},
+	}}}
+}
+
+// resource에 와일드카드(*), 시작 시간, 접속 IP 제한을 쓸 수 있는 custom policy
+// notBefore가 zero거나 ipRange가 빈 문자열이면 해당 조건은 넣지 않는다
+func NewCustomPolicy(resource string, notBefore, expires time.Time, ipRange string) Policy {
+	cond := Condition{DateLessThan: epochTime{expires.Unix()}}
+	if !notBefore.IsZero() {
+		cond.DateGreaterThan = &epochTime{notBefore.Unix()}
+	}
+	if ipRange != "" {
+		cond.IPAddress = &sourceIP{ipRange}
+	}
+	return Policy{Statement: []Statement{{
+		Resource:  resource,
+		Condition: cond,
+	}}}
+}
+
+// canned policy로 표현할 수 있는지 (DateLessThan 조건만 있는 경우)
+func (p Policy) isCanned() bool {
+	return len(p.Statement) == 1 &&
+		p.Statement[0].Condition.DateGreaterThan == nil &&
+		p.Statement[0].Condition.IPAddress == nil &&
+		!strings.Contains(p.Statement[0].Resource, "*")
+}
+
+// key pair id와 RSA private key로 서명하는 구조체
+type Signer struct {
+	keyPairID string
+	key       *rsa.PrivateKey
+}
+
+func NewSigner(keyPairID string, key *rsa.PrivateKey) *Signer {
+	return &Signer{keyPairID: keyPairID, key: key}
+}
+
+// PEM 파일(PKCS#1 또는 PKCS#8)에서 RSA private key를 읽는 함수
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key in %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+func (s *Signer) KeyPairID() string {
+	return s.keyPairID
+}
+
+// rawURL을 expires까지 유효한 canned policy signed url로 만드는 메소드
+func (s *Signer) SignURL(rawURL string, expires time.Time) (string, error) {
+	return s.SignURLWithPolicy(rawURL, NewCannedPolicy(rawURL, expires))
+}
+
+// rawURL에 policy로 서명한 파라미터를 붙이는 메소드
+// canned policy면 Expires, 아니면 Policy 파라미터를 사용
+func (s *Signer) SignURLWithPolicy(rawURL string, policy Policy) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	policyJSON, signature, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+
+	// @@@ url.Values.Encode는 키를 정렬하고 ~ 같은 문자를 다시 escape하므로 직접 붙인다
+	params := []string{}
+	if u.RawQuery != "" {
+		params = append(params, u.RawQuery)
+	}
+	if policy.isCanned() {
+		params = append(params, "Expires="+strconv.FormatInt(policy.Statement[0].Condition.DateLessThan.EpochTime, 10))
+	} else {
+		params = append(params, "Policy="+encode(policyJSON))
+	}
+	params = append(params, "Signature="+signature, "Key-Pair-Id="+s.keyPairID)
+	u.RawQuery = strings.Join(params, "&")
+	return u.String(), nil
+}
+
+// policy로 서명한 signed cookie 3개를 만드는 메소드
+// @@@ hls처럼 여러 파일을 받아야 하는 경우 resource에 "<디렉토리>/*" 와일드카드를 쓴 custom policy 사용
+func (s *Signer) SignCookies(policy Policy) ([]*http.Cookie, error) {
+	policyJSON, signature, err := s.sign(policy)
+	if err != nil {
+		return nil, err
+	}
+	return []*http.Cookie{
+		{Name: CookiePolicy, Value: encode(policyJSON)},
+		{Name: CookieSignature, Value: signature},
+		{Name: CookieKeyPairID, Value: s.keyPairID},
+	}, nil
+}
+
+// policy를 JSON으로 만들고 RSA-SHA1 서명을 cloud front base64로 인코딩해서 반환
+func (s *Signer) sign(policy Policy) ([]byte, string, error) {
+	if len(policy.Statement) == 0 {
+		return nil, "", errors.New("policy has no statements")
+	}
+	policyJSON, err := marshalPolicy(policy)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha1.Sum(policyJSON)
+	sig, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA1, hash[:])
+	if err != nil {
+		return nil, "", fmt.Errorf("error signing policy: %w", err)
+	}
+	return policyJSON, encode(sig), nil
+}
+
+// policy를 서명할 JSON 문서로 만드는 함수
+// @@@ json.Marshal은 &, <, >를 \u0026 처럼 escape하지만 cloud front는 policy 원문에 서명하므로
+// @@@ query string이 있는 resource url의 서명이 맞지 않는다 ==> escape하지 않는 Encoder 사용
+func marshalPolicy(policy Policy) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(policy); err != nil {
+		return nil, err
+	}
+	// Encoder는 끝에 줄바꿈을 붙인다
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// signed url을 public key로 검증하는 함수 (cloud front 없이 오프라인으로 확인 가능)
+// 서명, 만료 시간, resource가 url과 맞는지 확인
+func VerifyURL(signedURL string, pub *rsa.PublicKey, now time.Time) error {
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	signature := query.Get("Signature")
+	if signature == "" || query.Get("Key-Pair-Id") == "" {
+		return errors.New("missing signature parameters")
+	}
+
+	// 서명 파라미터를 뺀 원래 url
+	params := []string{}
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		switch name {
+		case "Expires", "Policy", "Signature", "Key-Pair-Id":
+			continue
+		}
+		params = append(params, param)
+	}
+	u.RawQuery = strings.Join(params, "&")
+	resourceURL := u.String()
+
+	var policyJSON []byte
+	if expires := query.Get("Expires"); expires != "" {
+		epoch, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Expires: %w", err)
+		}
+		policyJSON, err = marshalPolicy(NewCannedPolicy(resourceURL, time.Unix(epoch, 0)))
+		if err != nil {
+			return err
+		}
+	} else {
+		policyJSON, err = decode(query.Get("Policy"))
+		if err != nil {
+			return fmt.Errorf("invalid Policy: %w", err)
+		}
+	}
+	return verify(policyJSON, signature, resourceURL, pub, now)
+}
+
+// signed cookie 값들을 public key로 검증하는 함수
+// resourceURL은 cookie로 요청하는 파일의 url
+func VerifyCookies(cookies []*http.Cookie, resourceURL string, pub *rsa.PublicKey, now time.Time) error {
+	values := map[string]string{}
+	for _, c := range cookies {
+		values[c.Name] = c.Value
+	}
+	if values[CookieKeyPairID] == "" {
+		return errors.New("missing key pair id cookie")
+	}
+	policyJSON, err := decode(values[CookiePolicy])
+	if err != nil {
+		return fmt.Errorf("invalid policy cookie: %w", err)
+	}
+	return verify(policyJSON, values[CookieSignature], resourceURL, pub, now)
+}
+
+func verify(policyJSON []byte, signature, resourceURL string, pub *rsa.PublicKey, now time.Time) error {
+	sig, err := decode(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	hash := sha1.Sum(policyJSON)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA1, hash[:], sig); err != nil {
+		return ErrInvalidSignature
+	}
+
+	policy := Policy{}
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		return fmt.Errorf("invalid policy: %w", err)
+	}
+	if len(policy.Statement) == 0 {
+		return errors.New("policy has no statements")
+	}
+	stmt := policy.Statement[0]
+	if !matchResource(stmt.Resource, resourceURL) {
+		return ErrResourceMismatch
+	}
+	if now.Unix() >= stmt.Condition.DateLessThan.EpochTime {
+		return ErrExpired
+	}
+	if stmt.Condition.DateGreaterThan != nil && now.Unix() <= stmt.Condition.DateGreaterThan.EpochTime {
+		return ErrNotYetValid
+	}
+	return nil
+}
+
+// cloud front resource 패턴 비교 (* 는 0개 이상의 아무 문자, ? 는 문자 하나)
+func matchResource(pattern, s string) bool {
+	if pattern == "" {
+		return false
+	}
+	if pattern == "*" {
+		return true
+	}
+	p, str := 0, 0
+	star, match := -1, 0
+	for str < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[str]):
+			p++
+			str++
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, str
+			p++
+		case star != -1:
+			p = star + 1
+			match++
+			str = match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// cloud front용 base64: 표준 base64에서 + ==> -, = ==> _, / ==> ~ 로 치환
+var cfReplacer = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+var cfUnreplacer = strings.NewReplacer("-", "+", "_", "=", "~", "/")
+
+func encode(b []byte) string {
+	return cfReplacer.Replace(base64.StdEncoding.EncodeToString(b))
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(cfUnreplacer.Replace(s))
+}
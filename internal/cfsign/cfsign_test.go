@@ -0,0 +1,239 @@
+package cfsign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	keyOnce  sync.Once
+	testKey  *rsa.PrivateKey
+	otherKey *rsa.PrivateKey
+)
+
+// 테스트마다 RSA key를 만들면 느리므로 한번만 만든다
+func testKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+	keyOnce.Do(func() {
+		var err error
+		if testKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+		if otherKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return testKey, otherKey
+}
+
+func TestVerifyURL(t *testing.T) {
+	key, other := testKeys(t)
+	signer := NewSigner("K2JCJMDEHXQW5F", key)
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+
+	canned, err := signer.SignURL("https://d111.cloudfront.net/landscape/abc.mp4", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := signer.SignURLWithPolicy("https://d111.cloudfront.net/landscape/abc.mp4",
+		NewCustomPolicy("https://d111.cloudfront.net/landscape/*", now.Add(-time.Minute), expires, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	narrow, err := signer.SignURLWithPolicy("https://d111.cloudfront.net/landscape/abc.mp4",
+		NewCustomPolicy("https://d111.cloudfront.net/portrait/*", time.Time{}, expires, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		pub     *rsa.PublicKey
+		now     time.Time
+		wantErr error
+	}{
+		{name: "canned", url: canned, pub: &key.PublicKey, now: now},
+		{name: "custom wildcard", url: custom, pub: &key.PublicKey, now: now},
+		{name: "canned expired", url: canned, pub: &key.PublicKey, now: expires, wantErr: ErrExpired},
+		{name: "custom expired", url: custom, pub: &key.PublicKey, now: expires.Add(time.Second), wantErr: ErrExpired},
+		{name: "custom not yet valid", url: custom, pub: &key.PublicKey, now: now.Add(-time.Hour), wantErr: ErrNotYetValid},
+		// canned policy는 url로 policy를 다시 만들므로 다른 파일이면 서명이 맞지 않는다
+		{name: "canned wrong resource", url: strings.Replace(canned, "abc.mp4", "def.mp4", 1), pub: &key.PublicKey, now: now, wantErr: ErrInvalidSignature},
+		{name: "custom wrong resource", url: strings.Replace(custom, "/landscape/", "/portrait/", 1), pub: &key.PublicKey, now: now, wantErr: ErrResourceMismatch},
+		{name: "wildcard does not match", url: narrow, pub: &key.PublicKey, now: now, wantErr: ErrResourceMismatch},
+		{name: "tampered signature", url: tamperParam(t, canned, "Signature"), pub: &key.PublicKey, now: now, wantErr: ErrInvalidSignature},
+		{name: "wrong public key", url: canned, pub: &other.PublicKey, now: now, wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyURL(tt.url, tt.pub, tt.now)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("VerifyURL() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyURL() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCookies(t *testing.T) {
+	key, other := testKeys(t)
+	signer := NewSigner("K2JCJMDEHXQW5F", key)
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+	const prefix = "https://d111.cloudfront.net/packages/3f1c/"
+
+	wildcard, err := signer.SignCookies(NewCustomPolicy(prefix+"*", time.Time{}, expires, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canned, err := signer.SignCookies(NewCannedPolicy(prefix+"hls/master.m3u8", expires))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cookies  []*http.Cookie
+		resource string
+		pub      *rsa.PublicKey
+		now      time.Time
+		wantErr  error
+	}{
+		{name: "custom wildcard", cookies: wildcard, resource: prefix + "hls/720p/segment_001.ts", pub: &key.PublicKey, now: now},
+		{name: "canned", cookies: canned, resource: prefix + "hls/master.m3u8", pub: &key.PublicKey, now: now},
+		{name: "expired", cookies: wildcard, resource: prefix + "hls/master.m3u8", pub: &key.PublicKey, now: expires, wantErr: ErrExpired},
+		{name: "wildcard does not match", cookies: wildcard, resource: "https://d111.cloudfront.net/packages/9a2b/hls/master.m3u8", pub: &key.PublicKey, now: now, wantErr: ErrResourceMismatch},
+		{name: "canned wrong resource", cookies: canned, resource: prefix + "hls/720p/index.m3u8", pub: &key.PublicKey, now: now, wantErr: ErrResourceMismatch},
+		{name: "tampered signature", cookies: tamperCookie(wildcard, CookieSignature), resource: prefix + "hls/master.m3u8", pub: &key.PublicKey, now: now, wantErr: ErrInvalidSignature},
+		{name: "wrong public key", cookies: wildcard, resource: prefix + "hls/master.m3u8", pub: &other.PublicKey, now: now, wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyCookies(tt.cookies, tt.resource, tt.pub, tt.now)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("VerifyCookies() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyCookies() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// query string이 있는 url은 policy 원문(&를 escape하지 않은 JSON)에 서명해야 cloud front가 받아준다
+func TestSignURLQueryStringPolicy(t *testing.T) {
+	key, _ := testKeys(t)
+	signer := NewSigner("K2JCJMDEHXQW5F", key)
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+	const resource = "https://d111.cloudfront.net/landscape/abc.mp4?response-content-disposition=inline&x=<1>"
+
+	signed, err := signer.SignURL(resource, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyURL(signed, &key.PublicKey, now); err != nil {
+		t.Fatalf("VerifyURL() error = %v", err)
+	}
+
+	// cloud front 문서의 canned policy 형식 그대로 만든 원문으로 서명 확인
+	raw := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, resource, expires.Unix())
+	verifyRaw(t, raw, queryParam(t, signed, "Signature"), &key.PublicKey)
+
+	// custom policy도 Policy 파라미터에 escape하지 않은 원문이 들어간다
+	signed, err = signer.SignURLWithPolicy(resource, NewCustomPolicy(resource, time.Time{}, expires, "192.0.2.0/24"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyJSON, err := decode(queryParam(t, signed, "Policy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(policyJSON), `\u00`) || !strings.Contains(string(policyJSON), "inline&x=<1>") {
+		t.Fatalf("policy is HTML-escaped: %s", policyJSON)
+	}
+	verifyRaw(t, string(policyJSON), queryParam(t, signed, "Signature"), &key.PublicKey)
+	if err := VerifyURL(signed, &key.PublicKey, now); err != nil {
+		t.Fatalf("VerifyURL() error = %v", err)
+	}
+}
+
+func TestMatchResource(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"https://d/a/*", "https://d/a/b/c.ts", true},
+		{"https://d/a/*", "https://d/b/c.ts", false},
+		{"https://d/a/?.ts", "https://d/a/1.ts", true},
+		{"https://d/a/?.ts", "https://d/a/12.ts", false},
+		{"*", "https://d/anything", true},
+		{"", "https://d/a", false},
+	}
+	for _, tt := range tests {
+		if got := matchResource(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchResource(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func verifyRaw(t *testing.T, policy, signature string, pub *rsa.PublicKey) {
+	t.Helper()
+	sig, err := decode(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha1.Sum([]byte(policy))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA1, hash[:], sig); err != nil {
+		t.Fatalf("signature does not match policy %s: %v", policy, err)
+	}
+}
+
+func queryParam(t *testing.T, signedURL, name string) string {
+	t.Helper()
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get(name)
+}
+
+// 서명 파라미터 값의 첫 글자를 바꾼 url
+func tamperParam(t *testing.T, signedURL, name string) string {
+	t.Helper()
+	value := queryParam(t, signedURL, name)
+	return strings.Replace(signedURL, name+"="+value, name+"="+flipFirst(value), 1)
+}
+
+func tamperCookie(cookies []*http.Cookie, name string) []*http.Cookie {
+	tampered := []*http.Cookie{}
+	for _, c := range cookies {
+		copied := *c
+		if c.Name == name {
+			copied.Value = flipFirst(c.Value)
+		}
+		tampered = append(tampered, &copied)
+	}
+	return tampered
+}
+
+func flipFirst(s string) string {
+	if s[0] == 'A' {
+		return "B" + s[1:]
+	}
+	return "A" + s[1:]
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sqlite CURRENT_TIMESTAMP와 같은 형식 (created_at과 문자열로 비교하기 위해 사용)
+const sqliteTimestampLayout = "2006-01-02 15:04:05"
+
+// video의 last_accessed_at을 지금으로 바꾸는 함수
+// @@@ Range 요청마다 db에 쓰지 않도록 마지막 기록이 interval보다 오래됐을 때만 갱신
+func (c Client) TouchVideo(id uuid.UUID, interval time.Duration) error {
+	query := `
+	UPDATE videos
+	SET last_accessed_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND (last_accessed_at IS NULL OR last_accessed_at < ?)
+	`
+	_, err := c.db.Exec(query, id, time.Now().UTC().Add(-interval).Format(sqliteTimestampLayout))
+	return err
+}
+
+// 영상 blob 중 참조하는 모든 video가 cutoff 이후로 재생되지 않은 보관 전 blob 목록 (오래된 순, 최대 limit개)
+// @@@ 같은 내용을 여러 video가 공유하면 그중 하나라도 최근에 재생됐으면 보관하지 않는다
+func (c Client) GetStaleVideoBlobs(cutoff time.Time, limit int) ([]Blob, error) {
+	query := `
+	SELECT` + blobColumns + `
+	FROM blobs
+	WHERE archive_status = ''
+		AND EXISTS (
+			SELECT 1 FROM video_blobs vb
+			WHERE vb.blob_hash = blobs.hash AND vb.kind = ?
+		)
+		AND NOT EXISTS (
+			SELECT 1
+			FROM video_blobs vb
+			JOIN videos v ON v.id = vb.video_id
+			WHERE vb.blob_hash = blobs.hash AND COALESCE(v.last_accessed_at, v.created_at) >= ?
+		)
+	ORDER BY created_at
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, BlobKindVideo, cutoff.UTC().Format(sqliteTimestampLayout), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlobs(rows)
+}
+
+// archive_status가 status인 blob 목록
+func (c Client) GetBlobsByArchiveStatus(status string) ([]Blob, error) {
+	query := `
+	SELECT` + blobColumns + `
+	FROM blobs
+	WHERE archive_status = ?
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlobs(rows)
+}
+
+// blob의 보관 상태를 바꿀 때 쓰는 값
+type UpdateBlobArchiveParams struct {
+	Status       string // ArchiveStatusArchived, ArchiveStatusRestoring, 빈 문자열(복원 완료)
+	StorageClass string
+	ArchivedFrom string
+	// 객체를 다른 위치로 복사했으면 새 위치 (빈 문자열이면 위치 그대로)
+	Store string
+	Key   string
+}
+
+// blob의 보관 상태와 위치를 갱신하는 함수 (하나의 transaction)
+// 위치가 바뀌면 이전 객체는 삭제 예약하고 반환
+// @@@ videos의 url 컬럼은 바꾸지 않는다 ==> 보관 중에도 원래 위치의 url을 유지하고 복원하면 그 위치로 돌아온다
+func (c Client) UpdateBlobArchive(hash string, params UpdateBlobArchiveParams) ([]PendingDeletion, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var queued []PendingDeletion
+	if params.Store != "" {
+		queued, err = moveBlob(tx, hash, params.Store, params.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+	UPDATE blobs
+	SET
+		archive_status = ?,
+		archived_at = CASE WHEN ? = '' THEN NULL WHEN archived_at IS NULL THEN CURRENT_TIMESTAMP ELSE archived_at END,
+		storage_class = ?,
+		archived_from = ?
+	WHERE hash = ?
+	`, params.Status, params.Status, params.StorageClass, params.ArchivedFrom, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
@@ -0,0 +1,486 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// video_blobs.kind 값
+const (
+	BlobKindVideo     = "video"
+	BlobKindThumbnail = "thumbnail"
+)
+
+// blob을 참조할 때 갱신되는 videos 테이블의 url 컬럼
+var blobKindURLColumns = map[string]string{
+	BlobKindVideo:     "video_url",
+	BlobKindThumbnail: "thumbnail_url",
+}
+
+// blobs.archive_status 값 (빈 문자열이면 보관되지 않은 상태)
+const (
+	ArchiveStatusArchived  = "archived"  // 보관 저장소(storage class, prefix, backend)로 옮겨져 재생할 수 없음
+	ArchiveStatusRestoring = "restoring" // 복원 요청 후 저장소가 객체를 꺼내는 중 (GLACIER 등)
+)
+
+// sha256 hash로 식별되는 저장소 객체 하나
+// @@@ key template(VIDEO_KEY_TEMPLATE 등)에 {user_id}, {video_id}가 있으면 Hash 뒤에 @user:<id>, @video:<id>가 붙어 그 범위 안에서만 공유된다
+type Blob struct {
+	CreatedAt     time.Time  `json:"created_at"`
+	RefCount      int        `json:"ref_count"`
+	ArchiveStatus string     `json:"archive_status"`
+	ArchivedAt    *time.Time `json:"archived_at"`
+	StorageClass  string     `json:"storage_class"` // 기본 storage class가 아니면 그 class (빈 문자열이면 기본)
+	ArchivedFrom  string     `json:"archived_from"` // 보관하면서 옮겼으면 옮기기 전 media 저장소 key
+	CreateBlobParams
+}
+
+type CreateBlobParams struct {
+	Hash        string `json:"hash"`
+	Store       string `json:"store"`
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Aspect      string `json:"aspect"` // 영상 화면비 (square, standard, landscape, portrait, ultrawide, other), 썸네일은 빈 문자열
+}
+
+// blobs 테이블을 SELECT 할 때 쓰는 컬럼 목록 (scanBlob과 순서가 같아야 한다)
+const blobColumns = `
+		hash,
+		created_at,
+		store,
+		object_key,
+		size,
+		content_type,
+		ref_count,
+		archive_status,
+		archived_at,
+		storage_class,
+		archived_from,
+		aspect
+`
+
+// blobColumns 순서대로 한 row를 Blob으로 읽는 함수
+func scanBlob(row scanner) (Blob, error) {
+	var blob Blob
+	err := row.Scan(
+		&blob.Hash,
+		&blob.CreatedAt,
+		&blob.Store,
+		&blob.Key,
+		&blob.Size,
+		&blob.ContentType,
+		&blob.RefCount,
+		&blob.ArchiveStatus,
+		&blob.ArchivedAt,
+		&blob.StorageClass,
+		&blob.ArchivedFrom,
+		&blob.Aspect,
+	)
+	return blob, err
+}
+
+// 쿼리 결과 row들을 Blob 슬라이스로 읽는 함수
+func scanBlobs(rows *sql.Rows) ([]Blob, error) {
+	defer rows.Close()
+
+	blobs := []Blob{}
+	for rows.Next() {
+		blob, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+// hash에 해당하는 blob이 없으면 Hash가 빈 Blob 반환
+func (c Client) GetBlob(hash string) (Blob, error) {
+	query := `
+	SELECT` + blobColumns + `
+	FROM blobs
+	WHERE hash = ?
+	`
+	blob, err := scanBlob(c.db.QueryRow(query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Blob{}, nil
+		}
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// video가 kind 용도로 참조하는 blob (연결된 blob이 없으면 Hash가 빈 Blob)
+func (c Client) GetVideoBlob(videoID uuid.UUID, kind string) (Blob, error) {
+	query := `
+	SELECT` + blobColumns + `
+	FROM blobs
+	WHERE hash = (SELECT blob_hash FROM video_blobs WHERE video_id = ? AND kind = ?)
+	`
+	blob, err := scanBlob(c.db.QueryRow(query, videoID.String(), kind))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Blob{}, nil
+		}
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// store의 key 객체를 쓰는 blob (없으면 Hash가 빈 Blob)
+func (c Client) GetBlobByKey(store, key string) (Blob, error) {
+	query := `
+	SELECT` + blobColumns + `
+	FROM blobs
+	WHERE store = ? AND object_key = ?
+	`
+	blob, err := scanBlob(c.db.QueryRow(query, store, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Blob{}, nil
+		}
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// video 하나가 kind 용도로 blob 하나를 참조하는 관계
+type VideoBlobRef struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"` // video 소유자
+	Kind    string    `json:"kind"`
+	Blob    Blob      `json:"blob"`
+}
+
+// 모든 video의 blob 참조 목록 (blob hash 순서)
+func (c Client) GetVideoBlobRefs() ([]VideoBlobRef, error) {
+	// @@@ videos를 JOIN하면 created_at 컬럼 이름이 겹치므로 user_id는 subquery로 가져온다
+	query := `
+	SELECT vb.video_id, (SELECT user_id FROM videos WHERE id = vb.video_id), vb.kind,` + blobColumns + `
+	FROM video_blobs vb
+	JOIN blobs ON blobs.hash = vb.blob_hash
+	ORDER BY vb.blob_hash, vb.video_id, vb.kind
+	`
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []VideoBlobRef{}
+	for rows.Next() {
+		var ref VideoBlobRef
+		ref.Blob, err = scanBlob(prefixScanner{row: rows, prefix: []any{&ref.VideoID, &ref.UserID, &ref.Kind}})
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// blobColumns 앞에 다른 컬럼을 더 SELECT 했을 때 scanBlob을 그대로 쓰기 위한 scanner
+type prefixScanner struct {
+	row    scanner
+	prefix []any
+}
+
+func (p prefixScanner) Scan(dest ...any) error {
+	return p.row.Scan(append(p.prefix, dest...)...)
+}
+
+// 화면비를 모르던 blob(aspect 컬럼 추가 전에 올라간 영상)에 화면비를 기록
+func (c Client) SetBlobAspect(hash, aspect string) error {
+	_, err := c.db.Exec(`UPDATE blobs SET aspect = ? WHERE hash = ?`, aspect, hash)
+	return err
+}
+
+// 모든 blob 목록 (garbage collection에서 참조 중인 key 확인용)
+func (c Client) GetBlobs() ([]Blob, error) {
+	query := `
+	SELECT` + blobColumns + `
+	FROM blobs
+	`
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlobs(rows)
+}
+
+// store의 key 객체가 어떤 blob으로 쓰이고 있는지 확인
+// @@@ 삭제 예약된 객체와 같은 내용이 그 사이에 다시 업로드되면 key가 같으므로 지우면 안 된다
+func (c Client) IsBlobKey(store, key string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM blobs WHERE store = ? AND object_key = ?
+	)
+	`
+	var exists bool
+	err := c.db.QueryRow(query, store, key).Scan(&exists)
+	return exists, err
+}
+
+// store의 key 객체(url로 참조될 때는 url)를 인증 없이 내려줘도 되는지 확인
+// 썸네일로 쓰이거나 public video의 영상, package(hls, dash, sprite) 객체면 true
+// @@@ 어떤 video도 참조하지 않는 객체(삭제된 video의 남은 파일 등)는 false
+func (c Client) IsPublicObject(store, key, url string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM videos WHERE thumbnail_url = ?
+		UNION ALL
+		SELECT 1 FROM videos WHERE video_url = ? AND visibility = ?
+		UNION ALL
+		SELECT 1
+		FROM blobs b
+		JOIN video_blobs vb ON vb.blob_hash = b.hash
+		JOIN videos v ON v.id = vb.video_id
+		WHERE b.store = ? AND b.object_key = ? AND (vb.kind = ? OR v.visibility = ?)
+		UNION ALL
+		SELECT 1
+		FROM package_objects p
+		JOIN videos v ON v.id = p.video_id
+		WHERE p.store = ? AND p.object_key = ? AND v.visibility = ?
+	)
+	`
+	var public bool
+	err := c.db.QueryRow(query,
+		url,
+		url, VisibilityPublic,
+		store, key, BlobKindThumbnail, VisibilityPublic,
+		store, key, VisibilityPublic,
+	).Scan(&public)
+	return public, err
+}
+
+// video가 kind 용도로 blob을 참조하도록 연결하고 videos의 url 컬럼도 같이 갱신 (하나의 transaction)
+// blob이 처음이면 새로 만들고 이미 있으면 ref_count만 올린다
+// 이전에 연결되어 있던 blob은 ref_count를 내리고, 0이 되면 blob을 지우고 저장소 객체 삭제를 예약
+func (c Client) AttachVideoBlob(videoID uuid.UUID, kind string, blob CreateBlobParams, url string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := attachVideoBlob(tx, videoID, kind, blob, url); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 썸네일 blob을 연결하고 thumbnail_source도 같이 갱신 (하나의 transaction), 연결했는지 반환
+// @@@ source가 auto면 사용자가 고른 썸네일(upload, frame)을 덮어쓰지 않도록 썸네일이 없거나 auto일 때만 연결한다
+func (c Client) AttachThumbnailBlob(videoID uuid.UUID, blob CreateBlobParams, url, source string) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if source == ThumbnailSourceAuto {
+		var current string
+		err := tx.QueryRow(`
+		SELECT CASE WHEN thumbnail_url IS NULL THEN '' ELSE thumbnail_source END
+		FROM videos WHERE id = ?
+		`, videoID).Scan(&current)
+		if err != nil {
+			return false, err
+		}
+		if current != "" && current != ThumbnailSourceAuto {
+			return false, nil
+		}
+	}
+
+	if err := attachVideoBlob(tx, videoID, BlobKindThumbnail, blob, url); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE videos SET thumbnail_source = ? WHERE id = ?`, source, videoID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// AttachVideoBlob을 다른 transaction 안에서 실행하는 함수
+func attachVideoBlob(tx *sql.Tx, videoID uuid.UUID, kind string, blob CreateBlobParams, url string) error {
+	column, ok := blobKindURLColumns[kind]
+	if !ok {
+		return fmt.Errorf("unknown blob kind %q", kind)
+	}
+
+	var oldHash string
+	err := tx.QueryRow(`SELECT blob_hash FROM video_blobs WHERE video_id = ? AND kind = ?`, videoID.String(), kind).Scan(&oldHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// 같은 내용을 다시 올린 경우에는 참조 개수 변화 없음
+	if oldHash != blob.Hash {
+		// 소유자 사용량은 새 blob 크기만큼 늘고 이전 blob 크기만큼 준다
+		var ownerID string
+		if err := tx.QueryRow(`SELECT user_id FROM videos WHERE id = ?`, videoID).Scan(&ownerID); err != nil {
+			return err
+		}
+		var oldSize int64
+		if oldHash != "" {
+			err := tx.QueryRow(`SELECT size FROM blobs WHERE hash = ?`, oldHash).Scan(&oldSize)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		if err := addUserUsage(tx, ownerID, blob.Size-oldSize, 0); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		INSERT INTO blobs (hash, created_at, store, object_key, size, content_type, aspect, ref_count)
+		VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(hash) DO UPDATE SET ref_count = ref_count + 1
+		`, blob.Hash, blob.Store, blob.Key, blob.Size, blob.ContentType, blob.Aspect)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		INSERT INTO video_blobs (video_id, kind, blob_hash) VALUES (?, ?, ?)
+		ON CONFLICT(video_id, kind) DO UPDATE SET blob_hash = excluded.blob_hash
+		`, videoID.String(), kind, blob.Hash)
+		if err != nil {
+			return err
+		}
+
+		if oldHash != "" {
+			// 삭제 예약된 이전 객체는 runPendingDeletions가 지운다
+			if _, err := releaseBlob(tx, oldHash, videoID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// column은 blobKindURLColumns의 고정된 값이므로 쿼리에 직접 넣어도 안전
+	_, err = tx.Exec(fmt.Sprintf(`UPDATE videos SET %s = ? WHERE id = ?`, column), url, videoID)
+	return err
+}
+
+// blob 객체를 다른 저장소나 key로 옮긴 뒤 db를 갱신하는 함수 (하나의 transaction)
+// blob을 참조하는 모든 video의 url 컬럼을 url로 바꾸고 이전 객체는 삭제 예약
+// @@@ 객체 복사는 호출한 쪽에서 먼저 끝내야 한다
+func (c Client) MoveBlob(hash, store, key, url string) ([]PendingDeletion, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	queued, err := moveBlob(tx, hash, store, key)
+	if err != nil {
+		return nil, err
+	}
+	for kind, column := range blobKindURLColumns {
+		// column은 blobKindURLColumns의 고정된 값이므로 쿼리에 직접 넣어도 안전
+		_, err := tx.Exec(fmt.Sprintf(`
+		UPDATE videos SET %s = ?
+		WHERE id IN (SELECT video_id FROM video_blobs WHERE blob_hash = ? AND kind = ?)
+		`, column), url, hash, kind)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// blob의 위치를 바꾸고 이전 객체 삭제를 예약하는 함수 (다른 transaction 안에서 사용)
+func moveBlob(tx *sql.Tx, hash, store, key string) ([]PendingDeletion, error) {
+	var oldStore, oldKey string
+	err := tx.QueryRow(`
+	SELECT store, object_key FROM blobs WHERE hash = ?
+	`, hash).Scan(&oldStore, &oldKey)
+	if err != nil {
+		return nil, err
+	}
+	if oldStore == store && oldKey == key {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE blobs SET store = ?, object_key = ? WHERE hash = ?`, store, key, hash); err != nil {
+		return nil, err
+	}
+	return queuePendingDeletions(tx, []CreatePendingDeletionParams{{
+		Store: oldStore,
+		Key:   oldKey,
+	}})
+}
+
+// blob의 ref_count를 하나 내리고 0이 되면 blob을 지우고 저장소 객체 삭제를 예약하는 함수
+func releaseBlob(tx *sql.Tx, hash string, videoID uuid.UUID) ([]PendingDeletion, error) {
+	var refCount int
+	var store, key string
+	err := tx.QueryRow(`
+	UPDATE blobs SET ref_count = ref_count - 1
+	WHERE hash = ?
+	RETURNING ref_count, store, object_key
+	`, hash).Scan(&refCount, &store, &key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if refCount > 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM blobs WHERE hash = ?`, hash); err != nil {
+		return nil, err
+	}
+	return queuePendingDeletions(tx, []CreatePendingDeletionParams{{
+		Store:   store,
+		Key:     key,
+		VideoID: videoID,
+	}})
+}
+
+// video가 참조하는 모든 blob의 참조를 해제하는 함수 (video 삭제 transaction 안에서 사용)
+// 참조가 0이 되어 삭제 예약된 객체들 반환
+func releaseVideoBlobs(tx *sql.Tx, videoID uuid.UUID) ([]PendingDeletion, error) {
+	rows, err := tx.Query(`SELECT blob_hash FROM video_blobs WHERE video_id = ?`, videoID.String())
+	if err != nil {
+		return nil, err
+	}
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM video_blobs WHERE video_id = ?`, videoID.String()); err != nil {
+		return nil, err
+	}
+	queued := []PendingDeletion{}
+	for _, hash := range hashes {
+		released, err := releaseBlob(tx, hash, videoID)
+		if err != nil {
+			return nil, err
+		}
+		queued = append(queued, released...)
+	}
+	return queued, nil
+}
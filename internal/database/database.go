@@ -31,6 +31,39 @@ func NewClient(pathToDB string) (Client, error) {
 
 }
 
+// table에 column이 없으면 ALTER TABLE로 추가하는 method
+// definition은 "TEXT NOT NULL DEFAULT 'public'" 처럼 타입과 제약 조건
+func (c *Client) addColumnIfNotExists(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 // 이전 프로젝트에서 goose를 쓰는것과는 다르게 직접 쿼리를 입력해 migration 실행
 // 서버를 최초 실행할 때를 제외하고, 새로 실행할 때마다 새로 테이블 생성하려하면 안되므로 IF NOT EXISTS 키워드 사용
 func (c *Client) autoMigrate() error {
@@ -86,6 +119,290 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+
+	// 테이블 생성 후에 추가된 컬럼들
+	// @@@ CREATE TABLE IF NOT EXISTS는 이미 있는 테이블을 바꾸지 않으므로 ALTER TABLE로 추가
+	// @@@ 기존 video는 지금까지처럼 누구나 볼 수 있도록 public, 새 video는 CreateVideo에서 private 기본값
+	err = c.addColumnIfNotExists("videos", "visibility", "TEXT NOT NULL DEFAULT 'public'")
+	if err != nil {
+		return err
+	}
+	// 마지막으로 재생(stream, 조회)된 시각 ==> NULL이면 created_at 기준으로 오래된 영상을 판단
+	err = c.addColumnIfNotExists("videos", "last_accessed_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	// hls package의 master playlist url, dash package의 mpd url
+	err = c.addColumnIfNotExists("videos", "hls_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "dash_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "sprites_vtt_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	// 업로드된 영상의 처리 상태 (video_jobs.go)
+	// @@@ 컬럼 추가 전에 올라간 영상은 요청 안에서 처리가 끝났으므로 ready
+	err = c.addColumnIfNotExists("videos", "processing_status", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "processing_error", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`UPDATE videos SET processing_status = 'ready' WHERE processing_status = '' AND video_url IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	// 썸네일을 어떻게 만들었는지 (upload, auto, frame)
+	// @@@ 컬럼 추가 전에 있던 썸네일은 모두 사용자가 올린 것
+	err = c.addColumnIfNotExists("videos", "thumbnail_source", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`UPDATE videos SET thumbnail_source = 'upload' WHERE thumbnail_source = '' AND thumbnail_url IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	// ffprobe로 읽은 영상 정보 (0, 빈 문자열이면 모름 ==> probe-videos 명령어로 채운다)
+	for _, column := range []struct{ name, definition string }{
+		{"duration_seconds", "REAL NOT NULL DEFAULT 0"},
+		{"width", "INTEGER NOT NULL DEFAULT 0"},
+		{"height", "INTEGER NOT NULL DEFAULT 0"},
+		{"video_codec", "TEXT NOT NULL DEFAULT ''"},
+		{"frame_rate", "REAL NOT NULL DEFAULT 0"},
+		{"bit_rate", "INTEGER NOT NULL DEFAULT 0"},
+		{"audio_codec", "TEXT NOT NULL DEFAULT ''"},
+		{"audio_channels", "INTEGER NOT NULL DEFAULT 0"},
+		{"file_size", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := c.addColumnIfNotExists("videos", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// tus 프로토콜로 진행중인 이어받기 가능한 업로드들
+	tusUploadTable := `
+	CREATE TABLE IF NOT EXISTS tus_uploads (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		upload_length INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		media_type TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	`
+
+	_, err = c.db.Exec(tusUploadTable)
+	if err != nil {
+		return err
+	}
+
+	// 영상 삭제 후 아직 저장소에서 지우지 못한 객체들 (성공할 때까지 재시도)
+	pendingDeletionTable := `
+	CREATE TABLE IF NOT EXISTS pending_deletions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		store TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		video_id TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at TIMESTAMP NOT NULL
+	);
+	`
+
+	_, err = c.db.Exec(pendingDeletionTable)
+	if err != nil {
+		return err
+	}
+
+	// sha256 hash로 식별되는 저장소 객체(content-addressed blob)와 참조 개수
+	// 같은 내용의 파일은 한번만 저장하고 참조하는 video가 모두 사라지면 삭제
+	blobTable := `
+	CREATE TABLE IF NOT EXISTS blobs (
+		hash TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		store TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		content_type TEXT NOT NULL,
+		ref_count INTEGER NOT NULL DEFAULT 0
+	);
+	`
+
+	_, err = c.db.Exec(blobTable)
+	if err != nil {
+		return err
+	}
+
+	// 오래 재생되지 않은 영상 보관(archive.go)에 쓰는 컬럼들
+	for _, column := range []struct{ name, definition string }{
+		{"archive_status", "TEXT NOT NULL DEFAULT ''"},
+		{"archived_at", "TIMESTAMP"},
+		{"storage_class", "TEXT NOT NULL DEFAULT ''"},
+		{"archived_from", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := c.addColumnIfNotExists("blobs", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	// key template에 {aspect}가 있을 때 쓰는 영상 화면비
+	// @@@ 컬럼 추가 전의 영상 blob은 예전 key layout(<aspect>/<hash>.mp4)에서 화면비를 채운다
+	if err := c.addColumnIfNotExists("blobs", "aspect", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`
+	UPDATE blobs SET aspect = substr(object_key, 1, instr(object_key, '/') - 1)
+	WHERE aspect = '' AND (object_key LIKE 'landscape/%' OR object_key LIKE 'portrait/%' OR object_key LIKE 'other/%')
+	`)
+	if err != nil {
+		return err
+	}
+
+	// video가 어떤 blob을 어떤 용도(kind: video, thumbnail)로 참조하는지
+	videoBlobTable := `
+	CREATE TABLE IF NOT EXISTS video_blobs (
+		video_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		blob_hash TEXT NOT NULL,
+		PRIMARY KEY (video_id, kind),
+		FOREIGN KEY(blob_hash) REFERENCES blobs(hash)
+	);
+	`
+
+	_, err = c.db.Exec(videoBlobTable)
+	if err != nil {
+		return err
+	}
+
+	// 유저별 저장 용량(참조하는 blob 크기 합)과 video 개수
+	// @@@ 같은 blob을 여러 video가 참조하면 각 video의 소유자 모두에게 크기를 센다
+	userUsageTable := `
+	CREATE TABLE IF NOT EXISTS user_usage (
+		user_id TEXT PRIMARY KEY,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		bytes_used INTEGER NOT NULL DEFAULT 0,
+		video_count INTEGER NOT NULL DEFAULT 0
+	);
+	`
+
+	_, err = c.db.Exec(userUsageTable)
+	if err != nil {
+		return err
+	}
+
+	// 암호화되어 저장된 객체들의 암호화 방식과 key 정보
+	// @@@ data key는 master key로 감싼(wrap) 상태로만 저장하고 master key는 설정(MEDIA_MASTER_KEYS)에만 있다
+	objectKeyTable := `
+	CREATE TABLE IF NOT EXISTS object_keys (
+		store TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		mode TEXT NOT NULL,
+		master_key_id TEXT NOT NULL,
+		wrapped_key BLOB,
+		plain_size INTEGER NOT NULL,
+		PRIMARY KEY (store, object_key)
+	);
+	`
+
+	_, err = c.db.Exec(objectKeyTable)
+	if err != nil {
+		return err
+	}
+
+	// video별 package(hls, dash, sprites)를 이루는 저장소 객체들 (manifest, segment, sprite 파일)
+	packageObjectTable := `
+	CREATE TABLE IF NOT EXISTS package_objects (
+		video_id TEXT NOT NULL,
+		format TEXT NOT NULL,
+		store TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		PRIMARY KEY (video_id, format, object_key)
+	);
+	`
+
+	_, err = c.db.Exec(packageObjectTable)
+	if err != nil {
+		return err
+	}
+
+	// migrate-storage 명령어로 다른 저장소에 복사를 끝낸 객체들 (중단 후 다시 실행할 때 건너뛰기 위해)
+	storageMigrationItemTable := `
+	CREATE TABLE IF NOT EXISTS storage_migration_items (
+		target TEXT NOT NULL,
+		store TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		PRIMARY KEY (target, store, object_key)
+	);
+	`
+
+	_, err = c.db.Exec(storageMigrationItemTable)
+	if err != nil {
+		return err
+	}
+
+	// 업로드된 영상의 처리 job (ffprobe, ffmpeg, 저장소 업로드를 요청 밖에서 worker가 처리)
+	videoJobTable := `
+	CREATE TABLE IF NOT EXISTS video_jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_at TIMESTAMP NOT NULL,
+		file_path TEXT NOT NULL,
+		media_type TEXT NOT NULL,
+		content_hash TEXT NOT NULL DEFAULT ''
+	);
+	`
+
+	_, err = c.db.Exec(videoJobTable)
+	if err != nil {
+		return err
+	}
+	// 처리가 끝날 때까지 유저 용량에서 미리 잡아두는 크기
+	err = c.addColumnIfNotExists("video_jobs", "reserved_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// 사용량 기록이 없는 유저(테이블 생성 전에 만든 유저)는 지금 있는 video와 blob으로 계산해서 채운다
+	_, err = c.db.Exec(`
+	INSERT OR IGNORE INTO user_usage (user_id, updated_at, bytes_used, video_count)
+	SELECT
+		v.user_id,
+		CURRENT_TIMESTAMP,
+		COALESCE((
+			SELECT SUM(b.size)
+			FROM video_blobs vb
+			JOIN blobs b ON b.hash = vb.blob_hash
+			JOIN videos v2 ON v2.id = vb.video_id
+			WHERE v2.user_id = v.user_id
+		), 0),
+		COUNT(*)
+	FROM videos v
+	GROUP BY v.user_id
+	`)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -100,5 +417,32 @@ func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM tus_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table tus_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM pending_deletions"); err != nil {
+		return fmt.Errorf("failed to reset table pending_deletions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_blobs"); err != nil {
+		return fmt.Errorf("failed to reset table video_blobs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM blobs"); err != nil {
+		return fmt.Errorf("failed to reset table blobs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM user_usage"); err != nil {
+		return fmt.Errorf("failed to reset table user_usage: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM object_keys"); err != nil {
+		return fmt.Errorf("failed to reset table object_keys: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM package_objects"); err != nil {
+		return fmt.Errorf("failed to reset table package_objects: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM storage_migration_items"); err != nil {
+		return fmt.Errorf("failed to reset table storage_migration_items: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_jobs"); err != nil {
+		return fmt.Errorf("failed to reset table video_jobs: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// 저장소 객체 암호화 방식
+const (
+	EncryptionSSEC     = "sse-c"    // S3가 요청마다 받은 key로 암호화 (key는 master key에서 유도)
+	EncryptionEnvelope = "envelope" // 서버가 chunk 단위 AES-GCM으로 암호화해서 올림 (data key는 master key로 감싸서 저장)
+)
+
+// 암호화되어 저장된 객체 하나의 key 정보
+// @@@ 이 기록이 없는 객체는 평문으로 저장된 것
+type ObjectKey struct {
+	CreatedAt time.Time `json:"created_at"`
+	CreateObjectKeyParams
+}
+
+type CreateObjectKeyParams struct {
+	Store       string `json:"store"`
+	Key         string `json:"key"`
+	Mode        string `json:"mode"`          // EncryptionSSEC, EncryptionEnvelope
+	MasterKeyID string `json:"master_key_id"` // 암호화(envelope) 또는 key 유도(sse-c)에 쓴 master key
+	WrappedKey  []byte `json:"-"`             // master key로 감싼 data key (envelope만)
+	PlainSize   int64  `json:"plain_size"`    // 암호화 전 크기
+}
+
+// 같은 객체의 기록이 있으면 덮어쓴다
+func (c Client) CreateObjectKey(params CreateObjectKeyParams) error {
+	query := `
+	INSERT INTO object_keys (store, object_key, created_at, mode, master_key_id, wrapped_key, plain_size)
+	VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	ON CONFLICT(store, object_key) DO UPDATE SET
+		created_at = excluded.created_at,
+		mode = excluded.mode,
+		master_key_id = excluded.master_key_id,
+		wrapped_key = excluded.wrapped_key,
+		plain_size = excluded.plain_size
+	`
+	_, err := c.db.Exec(query,
+		params.Store,
+		params.Key,
+		params.Mode,
+		params.MasterKeyID,
+		params.WrappedKey,
+		params.PlainSize,
+	)
+	return err
+}
+
+// 기록이 없으면(평문 객체) 빈 ObjectKey 반환
+func (c Client) GetObjectKey(store, key string) (ObjectKey, error) {
+	query := `
+	SELECT
+		created_at,
+		mode,
+		master_key_id,
+		wrapped_key,
+		plain_size
+	FROM object_keys
+	WHERE store = ? AND object_key = ?
+	`
+	objectKey := ObjectKey{}
+	err := c.db.QueryRow(query, store, key).Scan(
+		&objectKey.CreatedAt,
+		&objectKey.Mode,
+		&objectKey.MasterKeyID,
+		&objectKey.WrappedKey,
+		&objectKey.PlainSize,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ObjectKey{}, nil
+		}
+		return ObjectKey{}, err
+	}
+	objectKey.Store = store
+	objectKey.Key = key
+	return objectKey, nil
+}
+
+// masterKeyID가 아닌 master key로 암호화된 객체들의 기록 (master key 교체에 사용)
+func (c Client) GetObjectKeysNotUsingMaster(masterKeyID string) ([]ObjectKey, error) {
+	query := `
+	SELECT
+		store,
+		object_key,
+		created_at,
+		mode,
+		master_key_id,
+		wrapped_key,
+		plain_size
+	FROM object_keys
+	WHERE master_key_id != ?
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, masterKeyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objectKeys := []ObjectKey{}
+	for rows.Next() {
+		var objectKey ObjectKey
+		if err := rows.Scan(
+			&objectKey.Store,
+			&objectKey.Key,
+			&objectKey.CreatedAt,
+			&objectKey.Mode,
+			&objectKey.MasterKeyID,
+			&objectKey.WrappedKey,
+			&objectKey.PlainSize,
+		); err != nil {
+			return nil, err
+		}
+		objectKeys = append(objectKeys, objectKey)
+	}
+	return objectKeys, rows.Err()
+}
+
+// master key를 바꾼 뒤 기록을 갱신하는 함수 (sse-c는 wrappedKey가 nil)
+func (c Client) UpdateObjectKeyMaster(store, key, masterKeyID string, wrappedKey []byte) error {
+	query := `
+	UPDATE object_keys
+	SET master_key_id = ?, wrapped_key = ?
+	WHERE store = ? AND object_key = ?
+	`
+	_, err := c.db.Exec(query, masterKeyID, wrappedKey, store, key)
+	return err
+}
+
+// 저장소에서 객체를 지운 뒤 기록도 지우는 함수
+func (c Client) DeleteObjectKey(store, key string) error {
+	_, err := c.db.Exec(`DELETE FROM object_keys WHERE store = ? AND object_key = ?`, store, key)
+	return err
+}
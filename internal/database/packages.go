@@ -0,0 +1,222 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// package 형식 (hls, dash처럼 manifest와 segment 여러 파일로 이루어진 video별 묶음)
+// @@@ package_objects.format은 segment를 만든 형식 ==> dash(fMP4) segment는 hls playlist도 같이 가리킬 수 있다
+const (
+	PackageFormatHLS     = "hls"
+	PackageFormatDASH    = "dash"
+	PackageFormatSprites = "sprites" // seek bar 미리보기용 sprite jpeg들과 WebVTT 파일
+)
+
+// package를 교체할 때 갱신되는 videos 테이블의 url 컬럼 (형식별 manifest url)
+var packageFormatURLColumns = map[string]string{
+	PackageFormatHLS:     "hls_url",
+	PackageFormatDASH:    "dash_url",
+	PackageFormatSprites: "sprites_vtt_url",
+}
+
+// segment를 공유할 수 있어서 같이 교체되는 재생용 package 형식들 (ReplaceVideoPackage)
+var streamingPackageFormats = []string{PackageFormatHLS, PackageFormatDASH}
+
+// video가 참조하는 url 컬럼 전부 (blob과 package)
+func videoURLColumns() []string {
+	columns := []string{}
+	for _, column := range blobKindURLColumns {
+		columns = append(columns, column)
+	}
+	for _, column := range packageFormatURLColumns {
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// package를 이루는 저장소 객체 하나
+// @@@ package는 video마다 따로 만들어지므로 blob과 다르게 공유하지 않고 참조 개수도 없다
+type PackageObject struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Format  string    `json:"format"`
+	Store   string    `json:"store"`
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+}
+
+// 모든 package 객체 목록 (garbage collection, 저장소 migration에서 사용)
+func (c Client) GetPackageObjects() ([]PackageObject, error) {
+	query := `
+	SELECT video_id, format, store, object_key, size
+	FROM package_objects
+	ORDER BY video_id, format, object_key
+	`
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []PackageObject{}
+	for rows.Next() {
+		var obj PackageObject
+		if err := rows.Scan(&obj.VideoID, &obj.Format, &obj.Store, &obj.Key, &obj.Size); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, rows.Err()
+}
+
+// video의 재생용 package(hls, dash)를 objects로 교체하고 형식별 url 컬럼을 urls(형식 ==> manifest url)로 바꾸는 함수 (하나의 transaction)
+// urls에 없는 형식의 url 컬럼은 NULL (objects, urls를 비우면 package 삭제)
+// 이전 package 객체 중 새 package에 없는 객체는 삭제 예약하고 반환
+// @@@ 여러 형식이 segment를 공유할 수 있으므로 형식별이 아니라 video의 재생용 package 전체를 한번에 바꾼다
+// @@@ 소유자 사용량도 새 package 크기만큼 늘고 이전 package 크기만큼 준다
+func (c Client) ReplaceVideoPackage(videoID uuid.UUID, objects []PackageObject, urls map[string]string) ([]PendingDeletion, error) {
+	return c.replaceVideoPackageObjects(videoID, streamingPackageFormats, objects, urls)
+}
+
+// video의 sprite 미리보기를 objects로 교체하고 sprites_vtt_url을 vttURL로 바꾸는 함수 (vttURL이 빈 문자열이면 NULL)
+// 이전 sprite 객체 중 새 객체에 없는 객체는 삭제 예약하고 반환
+func (c Client) ReplaceVideoSprites(videoID uuid.UUID, objects []PackageObject, vttURL string) ([]PendingDeletion, error) {
+	urls := map[string]string{}
+	if vttURL != "" {
+		urls[PackageFormatSprites] = vttURL
+	}
+	return c.replaceVideoPackageObjects(videoID, []string{PackageFormatSprites}, objects, urls)
+}
+
+// video의 formats 형식 package 객체와 url 컬럼만 교체하는 함수 (ReplaceVideoPackage, ReplaceVideoSprites)
+func (c Client) replaceVideoPackageObjects(videoID uuid.UUID, formats []string, objects []PackageObject, urls map[string]string) ([]PendingDeletion, error) {
+	for format := range urls {
+		if !slices.Contains(formats, format) {
+			return nil, fmt.Errorf("unexpected package format %q", format)
+		}
+	}
+	for _, obj := range objects {
+		if !slices.Contains(formats, obj.Format) {
+			return nil, fmt.Errorf("unexpected package format %q", obj.Format)
+		}
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ownerID string
+	if err := tx.QueryRow(`SELECT user_id FROM videos WHERE id = ?`, videoID).Scan(&ownerID); err != nil {
+		return nil, err
+	}
+
+	newKeys := map[[2]string]bool{}
+	var newSize int64
+	for _, obj := range objects {
+		newKeys[[2]string{obj.Store, obj.Key}] = true
+		newSize += obj.Size
+	}
+	old, oldSize, err := deleteVideoPackage(tx, videoID, formats...)
+	if err != nil {
+		return nil, err
+	}
+	stale := []CreatePendingDeletionParams{}
+	for _, obj := range old {
+		if !newKeys[[2]string{obj.Store, obj.Key}] {
+			stale = append(stale, obj)
+		}
+	}
+
+	for _, obj := range objects {
+		_, err := tx.Exec(`
+		INSERT INTO package_objects (video_id, format, store, object_key, size)
+		VALUES (?, ?, ?, ?, ?)
+		`, videoID.String(), obj.Format, obj.Store, obj.Key, obj.Size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := addUserUsage(tx, ownerID, newSize-oldSize, 0); err != nil {
+		return nil, err
+	}
+	for _, format := range formats {
+		// column은 packageFormatURLColumns의 고정된 값이므로 쿼리에 직접 넣어도 안전
+		column := packageFormatURLColumns[format]
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE videos SET %s = NULLIF(?, '') WHERE id = ?`, column), urls[format], videoID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	queued, err := queuePendingDeletions(tx, stale)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// video의 package 기록을 지우고 지운 객체 목록과 크기 합을 반환하는 함수 (다른 transaction 안에서 사용)
+// formats를 주면 그 형식의 객체만 지운다
+func deleteVideoPackage(tx *sql.Tx, videoID uuid.UUID, formats ...string) ([]CreatePendingDeletionParams, int64, error) {
+	query := `DELETE FROM package_objects WHERE video_id = ?`
+	args := []any{videoID.String()}
+	if len(formats) > 0 {
+		query += ` AND format IN (?` + strings.Repeat(`, ?`, len(formats)-1) + `)`
+		for _, format := range formats {
+			args = append(args, format)
+		}
+	}
+	rows, err := tx.Query(query+` RETURNING store, object_key, size`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	objects := []CreatePendingDeletionParams{}
+	var total int64
+	for rows.Next() {
+		obj := CreatePendingDeletionParams{VideoID: videoID}
+		var size int64
+		if err := rows.Scan(&obj.Store, &obj.Key, &size); err != nil {
+			return nil, 0, err
+		}
+		objects = append(objects, obj)
+		total += size
+	}
+	return objects, total, rows.Err()
+}
+
+// video의 모든 package 객체 삭제를 예약하고 (예약 목록, 크기 합) 반환하는 함수 (video 삭제 transaction 안에서 사용)
+func releaseVideoPackages(tx *sql.Tx, videoID uuid.UUID) ([]PendingDeletion, int64, error) {
+	objects, size, err := deleteVideoPackage(tx, videoID)
+	if err != nil {
+		return nil, 0, err
+	}
+	queued, err := queuePendingDeletions(tx, objects)
+	if err != nil {
+		return nil, 0, err
+	}
+	return queued, size, nil
+}
+
+// store의 key 객체가 어떤 package에 속해 있는지 확인
+// @@@ 다시 만든 package가 이전과 같은 key를 쓰면 삭제 예약된 객체를 지우면 안 된다
+func (c Client) IsPackageKey(store, key string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM package_objects WHERE store = ? AND object_key = ?
+	)
+	`
+	var exists bool
+	err := c.db.QueryRow(query, store, key).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 저장소에서 지워야 하는 객체 하나
+type PendingDeletion struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Attempts      int       `json:"attempts"`
+	LastError     *string   `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatePendingDeletionParams
+}
+
+type CreatePendingDeletionParams struct {
+	Store   string    `json:"store"` // 객체가 있는 저장소 이름 (media, assets)
+	Key     string    `json:"key"`
+	VideoID uuid.UUID `json:"video_id"`
+}
+
+// video 삭제와 그 video의 저장소 객체 삭제 예약을 하나의 transaction으로 처리
+// @@@ db row만 지워지고 객체 삭제 예약이 안 되는 경우(또는 그 반대)가 생기지 않도록
+// blob으로 관리되는 객체는 참조 개수가 0이 될 때만 삭제 예약하고 objects에 있어도 직접 지우지 않는다
+func (c Client) DeleteVideoAndQueueObjects(id uuid.UUID, objects []CreatePendingDeletionParams) ([]PendingDeletion, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Commit 후의 Rollback은 아무 일도 하지 않으므로 defer로 걸어두면 중간에 return 해도 안전
+	defer tx.Rollback()
+
+	// 소유자 사용량에서 뺄 video 개수와 blob 크기 (video row를 지우기 전에 읽기)
+	var ownerID string
+	err = tx.QueryRow(`SELECT user_id FROM videos WHERE id = ?`, id).Scan(&ownerID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	var blobBytes int64
+	err = tx.QueryRow(`
+	SELECT COALESCE(SUM(b.size), 0)
+	FROM video_blobs vb
+	JOIN blobs b ON b.hash = vb.blob_hash
+	WHERE vb.video_id = ?
+	`, id.String()).Scan(&blobBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// package(hls 등)는 video마다 따로 있으므로 바로 삭제 예약
+	packageQueued, packageBytes, err := releaseVideoPackages(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM videos WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	if ownerID != "" {
+		if err := addUserUsage(tx, ownerID, -blobBytes-packageBytes, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	// blob이 아닌 객체(dedup 도입 전에 올라간 파일)만 바로 삭제 예약
+	// @@@ blob 참조를 해제하기 전에 골라야 방금 지워진 blob의 객체가 두번 예약되지 않는다
+	legacy := []CreatePendingDeletionParams{}
+	for _, obj := range objects {
+		var isBlob bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM blobs WHERE store = ? AND object_key = ?)`, obj.Store, obj.Key).Scan(&isBlob)
+		if err != nil {
+			return nil, err
+		}
+		if !isBlob {
+			legacy = append(legacy, obj)
+		}
+	}
+
+	queued, err := releaseVideoBlobs(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	queued = append(queued, packageQueued...)
+
+	legacyQueued, err := queuePendingDeletions(tx, legacy)
+	if err != nil {
+		return nil, err
+	}
+	queued = append(queued, legacyQueued...)
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// 객체 삭제 예약을 추가하는 함수 (db에 기록되지 않은 객체를 지울 때)
+// @@@ 예약을 실행할 때 blob이나 package가 쓰고 있는 key면 지우지 않는다 (attemptPendingDeletion)
+func (c Client) QueuePendingDeletions(objects []CreatePendingDeletionParams) ([]PendingDeletion, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	queued, err := queuePendingDeletions(tx, objects)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// transaction 안에서 객체 삭제 예약을 추가하는 함수
+func queuePendingDeletions(tx *sql.Tx, objects []CreatePendingDeletionParams) ([]PendingDeletion, error) {
+	query := `
+	INSERT INTO pending_deletions (
+		created_at,
+		store,
+		object_key,
+		video_id,
+		attempts,
+		next_attempt_at
+	) VALUES (CURRENT_TIMESTAMP, ?, ?, ?, 0, ?)
+	`
+	now := time.Now().UTC()
+	queued := make([]PendingDeletion, 0, len(objects))
+	for _, obj := range objects {
+		result, err := tx.Exec(query, obj.Store, obj.Key, obj.VideoID.String(), now)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		queued = append(queued, PendingDeletion{
+			ID:                          id,
+			CreatedAt:                   now,
+			NextAttemptAt:               now,
+			CreatePendingDeletionParams: obj,
+		})
+	}
+	return queued, nil
+}
+
+// 재시도 시간이 된 삭제 예약을 최대 limit개 반환
+func (c Client) GetDuePendingDeletions(now time.Time, limit int) ([]PendingDeletion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		store,
+		object_key,
+		video_id,
+		attempts,
+		last_error,
+		next_attempt_at
+	FROM pending_deletions
+	WHERE next_attempt_at <= ?
+	ORDER BY next_attempt_at
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := []PendingDeletion{}
+	for rows.Next() {
+		var pd PendingDeletion
+		var videoID sql.NullString
+		if err := rows.Scan(
+			&pd.ID,
+			&pd.CreatedAt,
+			&pd.Store,
+			&pd.Key,
+			&videoID,
+			&pd.Attempts,
+			&pd.LastError,
+			&pd.NextAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		if videoID.Valid {
+			pd.VideoID, _ = uuid.Parse(videoID.String)
+		}
+		deletions = append(deletions, pd)
+	}
+	return deletions, rows.Err()
+}
+
+// 삭제 실패 기록 후 nextAttemptAt에 다시 시도하도록 예약
+func (c Client) MarkPendingDeletionFailed(id int64, errMsg string, nextAttemptAt time.Time) error {
+	query := `
+	UPDATE pending_deletions
+	SET
+		attempts = attempts + 1,
+		last_error = ?,
+		next_attempt_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, errMsg, nextAttemptAt, id)
+	return err
+}
+
+// 삭제에 성공한 예약 제거
+func (c Client) DeletePendingDeletion(id int64) error {
+	query := `
+	DELETE FROM pending_deletions
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// migrate-storage 명령어가 target 저장소로 복사하고 검증까지 끝낸 객체 하나
+// @@@ 중간에 중단되어도 다시 실행하면 이 기록이 있는 객체는 건너뛴다
+type StorageMigrationItem struct {
+	Target    string    `json:"target"` // ex: s3://bucket, local:/path
+	Store     string    `json:"store"`  // 원래 저장소 이름 (media, assets)
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+// 복사한 객체 기록 (같은 객체를 다시 복사하면 덮어쓰기)
+func (c Client) CreateStorageMigrationItem(item StorageMigrationItem) error {
+	query := `
+	INSERT INTO storage_migration_items (target, store, object_key, created_at, size, sha256)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?, ?)
+	ON CONFLICT(target, store, object_key) DO UPDATE SET
+		created_at = excluded.created_at,
+		size = excluded.size,
+		sha256 = excluded.sha256
+	`
+	_, err := c.db.Exec(query, item.Target, item.Store, item.Key, item.Size, item.SHA256)
+	return err
+}
+
+// 기록이 없으면 Key가 빈 StorageMigrationItem 반환
+func (c Client) GetStorageMigrationItem(target, store, key string) (StorageMigrationItem, error) {
+	query := `
+	SELECT created_at, size, sha256
+	FROM storage_migration_items
+	WHERE target = ? AND store = ? AND object_key = ?
+	`
+	item := StorageMigrationItem{Target: target, Store: store, Key: key}
+	err := c.db.QueryRow(query, target, store, key).Scan(&item.CreatedAt, &item.Size, &item.SHA256)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return StorageMigrationItem{}, nil
+		}
+		return StorageMigrationItem{}, err
+	}
+	return item, nil
+}
+
+// 복사가 끝난 객체 하나의 url 변경 내용
+type MigratedObject struct {
+	OldURL   string
+	NewURL   string
+	Store    string // 원래 저장소 이름
+	Key      string
+	NewStore string // target 저장소를 쓰기 시작한 뒤의 저장소 이름
+}
+
+// 복사가 끝난 객체들의 url과 blob, package, 암호화 기록의 저장소 이름을 하나의 transaction으로 바꾸고 target의 복사 기록을 지우는 함수
+// @@@ 일부 video만 새 url을 가리키는 상태가 생기지 않도록 전부 바꾸거나 전부 바꾸지 않는다
+func (c Client) ApplyStorageMigration(target string, objects []MigratedObject) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, obj := range objects {
+		for _, column := range videoURLColumns() {
+			// column은 blobKindURLColumns, packageFormatURLColumns의 고정된 값이므로 쿼리에 직접 넣어도 안전
+			_, err := tx.Exec(`UPDATE videos SET `+column+` = ? WHERE `+column+` = ?`, obj.NewURL, obj.OldURL)
+			if err != nil {
+				return err
+			}
+		}
+		if obj.NewStore == obj.Store {
+			continue
+		}
+		_, err := tx.Exec(`UPDATE blobs SET store = ? WHERE store = ? AND object_key = ?`, obj.NewStore, obj.Store, obj.Key)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE object_keys SET store = ? WHERE store = ? AND object_key = ?`, obj.NewStore, obj.Store, obj.Key)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE package_objects SET store = ? WHERE store = ? AND object_key = ?`, obj.NewStore, obj.Store, obj.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM storage_migration_items WHERE target = ?`, target); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
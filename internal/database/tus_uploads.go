@@ -0,0 +1,173 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tus 프로토콜 업로드 하나의 진행 상태
+type TusUpload struct {
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	UploadOffset int64     `json:"upload_offset"`
+	CreateTusUploadParams
+}
+
+type CreateTusUploadParams struct {
+	VideoID      uuid.UUID `json:"video_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	UploadLength int64     `json:"upload_length"`
+	MediaType    string    `json:"media_type"`
+	FilePath     string    `json:"file_path"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func (c Client) CreateTusUpload(params CreateTusUploadParams) (TusUpload, error) {
+	id := uuid.New().String()
+	query := `
+	INSERT INTO tus_uploads (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		upload_length,
+		upload_offset,
+		media_type,
+		file_path,
+		expires_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, 0, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query,
+		id,
+		params.VideoID.String(),
+		params.UserID.String(),
+		params.UploadLength,
+		params.MediaType,
+		params.FilePath,
+		params.ExpiresAt,
+	)
+	if err != nil {
+		return TusUpload{}, err
+	}
+
+	return c.GetTusUpload(id)
+}
+
+// id에 해당하는 업로드가 없으면 ID가 빈 TusUpload 반환
+func (c Client) GetTusUpload(id string) (TusUpload, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		upload_length,
+		upload_offset,
+		media_type,
+		file_path,
+		expires_at
+	FROM tus_uploads
+	WHERE id = ?
+	`
+	upload, err := scanTusUpload(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TusUpload{}, nil
+		}
+		return TusUpload{}, err
+	}
+	return upload, nil
+}
+
+// 만료 시간이 before 이전인 업로드들 반환
+func (c Client) GetExpiredTusUploads(before time.Time) ([]TusUpload, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		upload_length,
+		upload_offset,
+		media_type,
+		file_path,
+		expires_at
+	FROM tus_uploads
+	WHERE expires_at < ?
+	`
+	rows, err := c.db.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []TusUpload{}
+	for rows.Next() {
+		upload, err := scanTusUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// PATCH로 받은 만큼 offset을 갱신하고 만료 시간을 연장
+func (c Client) UpdateTusUploadOffset(id string, offset int64, expiresAt time.Time) error {
+	query := `
+	UPDATE tus_uploads
+	SET
+		upload_offset = ?,
+		expires_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, offset, expiresAt, id)
+	return err
+}
+
+func (c Client) DeleteTusUpload(id string) error {
+	query := `
+	DELETE FROM tus_uploads
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// *sql.Row와 *sql.Rows 둘 다 Scan 메소드를 가지므로 같은 함수로 처리
+func scanTusUpload(row interface{ Scan(dest ...any) error }) (TusUpload, error) {
+	var upload TusUpload
+	var videoID, userID string
+	err := row.Scan(
+		&upload.ID,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+		&videoID,
+		&userID,
+		&upload.UploadLength,
+		&upload.UploadOffset,
+		&upload.MediaType,
+		&upload.FilePath,
+		&upload.ExpiresAt,
+	)
+	if err != nil {
+		return TusUpload{}, err
+	}
+	upload.VideoID, err = uuid.Parse(videoID)
+	if err != nil {
+		return TusUpload{}, err
+	}
+	upload.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return TusUpload{}, err
+	}
+	return upload, nil
+}
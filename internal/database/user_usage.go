@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 유저 한명의 저장 용량 사용량
+type UserUsage struct {
+	UserID     uuid.UUID `json:"user_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	BytesUsed  int64     `json:"bytes_used"`
+	VideoCount int       `json:"video_count"`
+}
+
+// 기록이 없으면 사용량 0인 UserUsage 반환
+func (c Client) GetUserUsage(userID uuid.UUID) (UserUsage, error) {
+	query := `
+	SELECT
+		updated_at,
+		bytes_used,
+		video_count
+	FROM user_usage
+	WHERE user_id = ?
+	`
+	usage := UserUsage{UserID: userID}
+	err := c.db.QueryRow(query, userID.String()).Scan(
+		&usage.UpdatedAt,
+		&usage.BytesUsed,
+		&usage.VideoCount,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return usage, nil
+		}
+		return UserUsage{}, err
+	}
+	return usage, nil
+}
+
+// sql.DB와 sql.Tx 둘 다 받기 위한 인터페이스
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// videoID video의 kind 파일을 새로 올릴 때 quotaBytes 안에서 쓸 수 있는 최대 byte 수
+// 유저 사용량과 처리 대기 중인 다른 영상 job의 예약(video_jobs.reserved_bytes)을 빼고
+// 같은 kind의 파일을 교체하면 이전 파일 크기만큼은 다시 쓸 수 있다
+// @@@ 같은 video의 영상 job은 새 업로드로 대체되거나 그 결과를 교체하므로 영상(video kind) 용량에서는 빼지 않는다
+func (c Client) GetUploadAllowance(videoID uuid.UUID, kind string, quotaBytes int64) (int64, error) {
+	return uploadAllowance(c.db, videoID, kind, quotaBytes)
+}
+
+func uploadAllowance(q queryRower, videoID uuid.UUID, kind string, quotaBytes int64) (int64, error) {
+	query := `
+	SELECT
+		COALESCE((SELECT bytes_used FROM user_usage WHERE user_id = v.user_id), 0),
+		COALESCE((
+			SELECT b.size
+			FROM video_blobs vb
+			JOIN blobs b ON b.hash = vb.blob_hash
+			WHERE vb.video_id = v.id AND vb.kind = ?
+		), 0),
+		COALESCE((
+			SELECT SUM(j.reserved_bytes)
+			FROM video_jobs j
+			JOIN videos v2 ON v2.id = j.video_id
+			WHERE v2.user_id = v.user_id AND (j.video_id != v.id OR ? != ?)
+		), 0)
+	FROM videos v
+	WHERE v.id = ?
+	`
+	var used, replaced, reserved int64
+	err := q.QueryRow(query, kind, kind, BlobKindVideo, videoID.String()).Scan(&used, &replaced, &reserved)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return max(quotaBytes-used+replaced-reserved, 0), nil
+}
+
+// video 소유자의 사용량을 bytesDelta, videosDelta만큼 바꾸는 함수 (다른 transaction 안에서 사용)
+// userID는 videos.user_id 값 그대로
+func addUserUsage(tx *sql.Tx, userID string, bytesDelta int64, videosDelta int) error {
+	_, err := tx.Exec(`
+	INSERT OR IGNORE INTO user_usage (user_id, updated_at, bytes_used, video_count)
+	VALUES (?, CURRENT_TIMESTAMP, 0, 0)
+	`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	UPDATE user_usage
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		bytes_used = MAX(bytes_used + ?, 0),
+		video_count = MAX(video_count + ?, 0)
+	WHERE user_id = ?
+	`, bytesDelta, videosDelta, userID)
+	return err
+}
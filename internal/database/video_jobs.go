@@ -0,0 +1,313 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// videos.processing_status 값 (업로드된 영상 처리 상태, 빈 문자열이면 아직 업로드하지 않은 video)
+const (
+	ProcessingStatusQueued     = "queued"     // 처리 대기 중 (실패 후 재시도 대기 포함)
+	ProcessingStatusProcessing = "processing" // worker가 처리 중
+	ProcessingStatusReady      = "ready"      // 처리 완료, video_url로 재생 가능
+	ProcessingStatusFailed     = "failed"     // 재시도를 다 해도 실패 (processing_error에 이유)
+)
+
+// video_jobs.status 값
+// @@@ 끝난 job(성공, 최종 실패)은 row를 지우므로 대기와 처리 중 두 가지만 있다
+const (
+	VideoJobQueued     = "queued"
+	VideoJobProcessing = "processing"
+)
+
+// 업로드된 영상 파일 하나를 처리하는 job
+type VideoJob struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"last_error"`
+	RunAt     time.Time `json:"run_at"` // 이 시각 이후에 처리 (재시도 backoff)
+	CreateVideoJobParams
+}
+
+type CreateVideoJobParams struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	FilePath    string    `json:"file_path"` // job이 끝날 때 지워지는 원본 파일 (VIDEO_JOB_DIR 아래)
+	MediaType   string    `json:"media_type"`
+	ContentHash string    `json:"content_hash"` // 빈 문자열이면 처리할 때 계산
+	// 처리가 끝날 때까지 유저 용량에서 미리 잡아두는 크기 (업로드된 원본 크기)
+	// @@@ 사용량은 worker가 blob을 연결할 때 늘어나므로 예약하지 않으면 처리 대기 중인 업로드들이 모두 같은 사용량으로 검사를 통과한다
+	ReservedBytes int64 `json:"reserved_bytes"`
+}
+
+// 처리 job을 만들 때 유저 용량이 모자라면 반환하는 에러
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+const videoJobColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		status,
+		attempts,
+		last_error,
+		run_at,
+		file_path,
+		media_type,
+		content_hash,
+		reserved_bytes
+`
+
+func scanVideoJob(row scanner) (VideoJob, error) {
+	var job VideoJob
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.VideoID,
+		&job.Status,
+		&job.Attempts,
+		&job.LastError,
+		&job.RunAt,
+		&job.FilePath,
+		&job.MediaType,
+		&job.ContentHash,
+		&job.ReservedBytes,
+	)
+	return job, err
+}
+
+// job을 추가하고 video를 queued 상태로 바꾸는 함수 (하나의 transaction)
+// 같은 video의 아직 시작하지 않은 job은 새 업로드로 대체되므로 지우고 반환 (원본 파일은 호출한 쪽에서 삭제)
+// @@@ 처리 중인 job은 그대로 두고 새 job은 그 job이 끝난 뒤에 처리된다 (ClaimVideoJob 참고)
+// quotaBytes가 0보다 크면 같은 transaction 안에서 ReservedBytes를 예약할 수 있는지 확인하고 모자라면 ErrQuotaExceeded
+// @@@ 예약은 job row가 지워질 때(처리 완료, 최종 실패, 새 업로드로 대체) 같이 풀린다
+func (c Client) EnqueueVideoJob(params CreateVideoJobParams, quotaBytes int64) (VideoJob, []VideoJob, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return VideoJob{}, nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	DELETE FROM video_jobs
+	WHERE video_id = ? AND status = ?
+	RETURNING`+videoJobColumns, params.VideoID.String(), VideoJobQueued)
+	if err != nil {
+		return VideoJob{}, nil, err
+	}
+	superseded, err := scanVideoJobs(rows)
+	if err != nil {
+		return VideoJob{}, nil, err
+	}
+
+	if quotaBytes > 0 {
+		allowance, err := uploadAllowance(tx, params.VideoID, BlobKindVideo, quotaBytes)
+		if err != nil {
+			return VideoJob{}, nil, err
+		}
+		if params.ReservedBytes > allowance {
+			return VideoJob{}, nil, ErrQuotaExceeded
+		}
+	}
+
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+	INSERT INTO video_jobs (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		status,
+		attempts,
+		run_at,
+		file_path,
+		media_type,
+		content_hash,
+		reserved_bytes
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, 0, ?, ?, ?, ?, ?)
+	`, id, params.VideoID.String(), VideoJobQueued, now, params.FilePath, params.MediaType, params.ContentHash, params.ReservedBytes)
+	if err != nil {
+		return VideoJob{}, nil, err
+	}
+	if err := setVideoProcessingStatus(tx, params.VideoID, ProcessingStatusQueued, ""); err != nil {
+		return VideoJob{}, nil, err
+	}
+
+	job, err := scanVideoJob(tx.QueryRow(`SELECT`+videoJobColumns+`FROM video_jobs WHERE id = ?`, id))
+	if err != nil {
+		return VideoJob{}, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return VideoJob{}, nil, err
+	}
+	return job, superseded, nil
+}
+
+// 처리할 시각이 된 job 하나를 processing 상태로 바꾸고 반환 (없으면 ID가 빈 VideoJob)
+// @@@ UPDATE 한 문장으로 고르고 바꾸므로 여러 worker가 동시에 불러도 같은 job을 두 번 가져가지 않는다
+// @@@ 같은 video의 job이 처리 중이면 그 video의 다른 job은 건너뛴다 (이전 업로드가 나중 업로드를 덮어쓰지 않도록)
+func (c Client) ClaimVideoJob(now time.Time) (VideoJob, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return VideoJob{}, err
+	}
+	defer tx.Rollback()
+
+	job, err := scanVideoJob(tx.QueryRow(`
+	UPDATE video_jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT j.id FROM video_jobs j
+		WHERE j.status = ? AND j.run_at <= ?
+		AND NOT EXISTS (
+			SELECT 1 FROM video_jobs p WHERE p.video_id = j.video_id AND p.status = ?
+		)
+		ORDER BY j.run_at, j.created_at
+		LIMIT 1
+	)
+	RETURNING`+videoJobColumns, VideoJobProcessing, VideoJobQueued, now, VideoJobProcessing))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoJob{}, nil
+		}
+		return VideoJob{}, err
+	}
+	if err := setVideoProcessingStatus(tx, job.VideoID, ProcessingStatusProcessing, ""); err != nil {
+		return VideoJob{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return VideoJob{}, err
+	}
+	return job, nil
+}
+
+// 처리가 끝난 job을 지우는 함수 (하나의 transaction)
+// errMsg가 빈 문자열이면 성공 ==> video는 ready, 아니면 최종 실패 ==> video는 failed
+// @@@ 같은 video에 남은 job(처리 중에 새로 올라온 업로드)이 있으면 video 상태는 그 job이 정한다
+func (c Client) FinishVideoJob(job VideoJob, errMsg string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM video_jobs WHERE id = ?`, job.ID); err != nil {
+		return err
+	}
+	var pending bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM video_jobs WHERE video_id = ?)`, job.VideoID.String()).Scan(&pending)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		status := ProcessingStatusReady
+		if errMsg != "" {
+			status = ProcessingStatusFailed
+		}
+		if err := setVideoProcessingStatus(tx, job.VideoID, status, errMsg); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 실패한 job을 runAt에 다시 처리하도록 대기 상태로 돌리는 함수
+func (c Client) RetryVideoJob(job VideoJob, errMsg string, runAt time.Time) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE video_jobs
+	SET
+		status = ?,
+		last_error = ?,
+		run_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`, VideoJobQueued, errMsg, runAt, job.ID)
+	if err != nil {
+		return err
+	}
+	if err := setVideoProcessingStatus(tx, job.VideoID, ProcessingStatusQueued, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// processing 상태로 남은 job들을 다시 대기 상태로 돌리고 개수 반환 (서버 시작할 때)
+// @@@ 처리 중에 서버가 죽으면 job이 processing으로 남아서 아무도 가져가지 않는다
+// @@@ run_at은 그대로 둬야 같은 video에 나중에 들어온 job보다 먼저 처리된다 (이전 업로드가 나중 업로드를 덮어쓰지 않도록)
+func (c Client) RequeueProcessingVideoJobs() (int, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	UPDATE video_jobs
+	SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE status = ?
+	`, VideoJobQueued, VideoJobProcessing)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+	UPDATE videos SET processing_status = ?
+	WHERE processing_status = ?
+	`, ProcessingStatusQueued, ProcessingStatusProcessing)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// 남은 job 목록 (관리자용 명령어에서 사용)
+func (c Client) GetVideoJobs() ([]VideoJob, error) {
+	rows, err := c.db.Query(`SELECT` + videoJobColumns + `FROM video_jobs ORDER BY run_at, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideoJobs(rows)
+}
+
+func scanVideoJobs(rows *sql.Rows) ([]VideoJob, error) {
+	defer rows.Close()
+
+	jobs := []VideoJob{}
+	for rows.Next() {
+		job, err := scanVideoJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// video의 처리 상태를 바꾸는 함수 (다른 transaction 안에서 사용, errMsg가 빈 문자열이면 NULL)
+func setVideoProcessingStatus(tx *sql.Tx, videoID uuid.UUID, status, errMsg string) error {
+	_, err := tx.Exec(`
+	UPDATE videos
+	SET processing_status = ?, processing_error = NULLIF(?, '')
+	WHERE id = ?
+	`, status, errMsg, videoID)
+	return err
+}
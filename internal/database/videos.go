@@ -8,24 +8,95 @@ import (
 	"github.com/google/uuid"
 )
 
+// videos.visibility 값
+const (
+	VisibilityPublic   = "public"   // 누구나 볼 수 있고 cdn url 그대로 제공
+	VisibilityUnlisted = "unlisted" // 링크를 아는 사람만 볼 수 있고 유효 기간이 있는 url 제공
+	VisibilityPrivate  = "private"  // 소유자만 볼 수 있고 유효 기간이 있는 url 제공
+)
+
+// videos.thumbnail_source 값
+const (
+	ThumbnailSourceUpload = "upload" // 사용자가 올린 이미지
+	ThumbnailSourceAuto   = "auto"   // 영상을 처리할 때 자동으로 고른 frame (새 영상을 올리면 다시 만든다)
+	ThumbnailSourceFrame  = "frame"  // 소유자가 시각을 지정해서 고른 frame
+)
+
+// visibility 값이 올바른지 확인
+func ValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ThumbnailURL   *string    `json:"thumbnail_url"`
+	VideoURL       *string    `json:"video_url"`
+	HLSURL         *string    `json:"hls_url"`         // hls package의 master playlist url (PACKAGE_FORMATS에 hls가 있을 때만)
+	DASHURL        *string    `json:"dash_url"`        // dash package의 mpd url (PACKAGE_FORMATS에 dash가 있을 때만)
+	SpritesVTTURL  *string    `json:"sprites_vtt_url"` // seek bar 미리보기 WebVTT url (SPRITE_INTERVAL이 0이 아닐 때만)
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	ArchiveStatus  string     `json:"archive_status"` // 영상 blob의 archive_status (빈 문자열이면 재생 가능)
+	// 업로드된 영상 처리 상태 (queued, processing, ready, failed) ==> 업로드 후 클라이언트가 polling
+	ProcessingStatus string  `json:"processing_status"`
+	ProcessingError  *string `json:"processing_error"` // failed일 때 실패 이유
+	ThumbnailSource  string  `json:"thumbnail_source"` // 썸네일을 만든 방법 (upload, auto, frame), 썸네일이 없으면 빈 문자열
+	VideoMetadata
 	CreateVideoParams
 }
 
+// 영상 처리할 때 ffprobe로 읽은 영상 정보 (영상을 올리기 전이나 모르는 값은 0, 빈 문자열)
+type VideoMetadata struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	Width           int     `json:"width"`  // 화면에 보이는 너비
+	Height          int     `json:"height"` // 화면에 보이는 높이
+	VideoCodec      string  `json:"video_codec"`
+	FrameRate       float64 `json:"frame_rate"`
+	BitRate         int64   `json:"bit_rate"`    // 전체 bitrate (bps)
+	AudioCodec      string  `json:"audio_codec"` // 음성이 없으면 빈 문자열
+	AudioChannels   int     `json:"audio_channels"`
+	FileSize        int64   `json:"file_size"` // 저장소에 올라간 영상 파일 크기 (byte)
+}
+
+// video 목록 filter 값 (빈 값이면 그 조건으로 거르지 않음)
+type VideoFilter struct {
+	Orientation string  // landscape, portrait, square
+	MinDuration float64 // 초
+	MaxDuration float64 // 초 (0이면 제한 없음)
+}
+
+// VideoFilter.Orientation 값 (width, height로 판단)
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationSquare    = "square"
+)
+
+// orientation 값이 올바른지 확인
+func ValidOrientation(orientation string) bool {
+	switch orientation {
+	case OrientationLandscape, OrientationPortrait, OrientationSquare:
+		return true
+	}
+	return false
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	Visibility  string    `json:"visibility"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// videos 테이블을 SELECT 할 때 쓰는 컬럼 목록 (scanVideo와 순서가 같아야 한다)
+// @@@ 컬럼이 추가될 때마다 모든 SELECT 쿼리와 Scan을 고치지 않도록 한 곳에 모음
+// @@@ 보관 상태는 blob 단위로 관리하므로 영상 blob에서 읽어온다 (FROM videos 쿼리에서만 사용)
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,41 +104,141 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+		user_id,
+		visibility,
+		last_accessed_at,
+		hls_url,
+		dash_url,
+		sprites_vtt_url,
+		processing_status,
+		processing_error,
+		thumbnail_source,
+		duration_seconds,
+		width,
+		height,
+		video_codec,
+		frame_rate,
+		bit_rate,
+		audio_codec,
+		audio_channels,
+		file_size,
+		COALESCE((
+			SELECT b.archive_status
+			FROM video_blobs vb
+			JOIN blobs b ON b.hash = vb.blob_hash
+			WHERE vb.video_id = videos.id AND vb.kind = 'video'
+		), '')
+`
 
-	rows, err := c.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
+// sql.Row와 sql.Rows 둘 다 받기 위한 인터페이스
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// videoColumns 순서대로 한 row를 Video로 읽는 함수
+func scanVideo(row scanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&video.Visibility,
+		&video.LastAccessedAt,
+		&video.HLSURL,
+		&video.DASHURL,
+		&video.SpritesVTTURL,
+		&video.ProcessingStatus,
+		&video.ProcessingError,
+		&video.ThumbnailSource,
+		&video.DurationSeconds,
+		&video.Width,
+		&video.Height,
+		&video.VideoCodec,
+		&video.FrameRate,
+		&video.BitRate,
+		&video.AudioCodec,
+		&video.AudioChannels,
+		&video.FileSize,
+		&video.ArchiveStatus,
+	)
+	return video, err
+}
+
+// 쿼리 결과 row들을 Video 슬라이스로 읽는 함수
+func scanVideos(rows *sql.Rows) ([]Video, error) {
 	defer rows.Close()
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	return videos, rows.Err()
+}
 
-	return videos, nil
+// 유저의 video 목록 중 filter 조건에 맞는 video들 (최근 것부터)
+// @@@ 영상 정보로 거르는 조건이 있으면 아직 영상을 올리지 않은 video(정보가 0)는 빠진다
+func (c Client) GetVideos(userID uuid.UUID, filter VideoFilter) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ?
+	`
+	args := []any{userID}
+	switch filter.Orientation {
+	case OrientationLandscape:
+		query += ` AND width > height AND height > 0`
+	case OrientationPortrait:
+		query += ` AND height > width AND width > 0`
+	case OrientationSquare:
+		query += ` AND width = height AND width > 0`
+	}
+	if filter.MinDuration > 0 {
+		query += ` AND duration_seconds >= ?`
+		args = append(args, filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		query += ` AND duration_seconds <= ? AND duration_seconds > 0`
+		args = append(args, filter.MaxDuration)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
 }
 
+// 모든 유저의 video 목록 (관리자용 명령어에서 사용)
+func (c Client) GetAllVideos() ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	ORDER BY created_at
+	`
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
+}
+
+// visibility가 빈 문자열이면 private으로 생성
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	id := uuid.New()
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPrivate
+	}
 	query := `
 	INSERT INTO videos (
 		id,
@@ -75,42 +246,39 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		visibility
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	// video 생성과 소유자의 video 개수 증가를 하나의 transaction으로 처리
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, id, params.Title, params.Description, params.UserID, params.Visibility)
 	if err != nil {
 		return Video{}, err
 	}
+	if err := addUserUsage(tx, params.UserID.String(), 0, 1); err != nil {
+		return Video{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Video{}, err
+	}
 
 	return c.GetVideo(id)
 }
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -129,7 +297,8 @@ func (c Client) UpdateVideo(video Video) error {
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		user_id = ?,
+		visibility = ?
 	WHERE id = ?
 	`
 
@@ -140,11 +309,51 @@ func (c Client) UpdateVideo(video Video) error {
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		video.Visibility,
 		video.ID,
 	)
 	return err
 }
 
+// video의 visibility만 바꾸는 함수
+// @@@ UpdateVideo는 url 컬럼도 같이 쓰므로 요청 시작할 때 읽은 video로 부르면 그 사이 worker가 연결한 blob의 url을 되돌린다
+func (c Client) SetVideoVisibility(id uuid.UUID, visibility string) error {
+	_, err := c.db.Exec(`UPDATE videos SET visibility = ? WHERE id = ?`, visibility, id)
+	return err
+}
+
+// video의 영상 정보를 바꾸는 함수
+func (c Client) SetVideoMetadata(id uuid.UUID, meta VideoMetadata) error {
+	query := `
+	UPDATE videos
+	SET
+		duration_seconds = ?,
+		width = ?,
+		height = ?,
+		video_codec = ?,
+		frame_rate = ?,
+		bit_rate = ?,
+		audio_codec = ?,
+		audio_channels = ?,
+		file_size = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		meta.DurationSeconds,
+		meta.Width,
+		meta.Height,
+		meta.VideoCodec,
+		meta.FrameRate,
+		meta.BitRate,
+		meta.AudioCodec,
+		meta.AudioChannels,
+		meta.FileSize,
+		id,
+	)
+	return err
+}
+
 func (c Client) DeleteVideo(id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
@@ -153,3 +362,34 @@ func (c Client) DeleteVideo(id uuid.UUID) error {
 	_, err := c.db.Exec(query, id)
 	return err
 }
+
+// 모든 video의 thumbnail_url, video_url, hls_url, dash_url, sprites_vtt_url 반환 (NULL은 제외)
+// 저장소에 남아 있는 객체 중 어떤 video도 참조하지 않는 객체를 찾을 때 사용
+func (c Client) GetAllVideoAssetURLs() ([]string, error) {
+	query := `
+	SELECT thumbnail_url FROM videos WHERE thumbnail_url IS NOT NULL
+	UNION
+	SELECT video_url FROM videos WHERE video_url IS NOT NULL
+	UNION
+	SELECT hls_url FROM videos WHERE hls_url IS NOT NULL
+	UNION
+	SELECT dash_url FROM videos WHERE dash_url IS NOT NULL
+	UNION
+	SELECT sprites_vtt_url FROM videos WHERE sprites_vtt_url IS NOT NULL
+	`
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
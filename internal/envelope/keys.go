@@ -0,0 +1,167 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// @@@ envelope encryption: 객체마다 랜덤 data key로 암호화하고, data key는 master key로 감싸서(wrap) db에 저장
+// @@@ master key를 바꿀 때 객체를 다시 암호화하지 않고 data key만 다시 감싸면 된다
+
+// AES-256 key 크기
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("unknown master key id")
+
+// id별 master key 모음과 새로 암호화할 때 쓰는 active key id
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// "id1:<base64 key>,id2:<base64 key>" 형태의 설정과 active key id로 Keyring을 만드는 함수
+// active가 빈 문자열이면 key가 하나일 때만 그 key를 active로 사용
+func ParseKeyring(spec, active string) (*Keyring, error) {
+	kr := &Keyring{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid master key entry %q (must be <id>:<base64 key>)", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 for master key %q: %w", id, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		if _, exists := kr.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate master key id %q", id)
+		}
+		kr.keys[id] = key
+	}
+	if len(kr.keys) == 0 {
+		return nil, errors.New("no master keys configured")
+	}
+
+	if active == "" {
+		if len(kr.keys) != 1 {
+			return nil, errors.New("active master key id must be set when there are several master keys")
+		}
+		for id := range kr.keys {
+			active = id
+		}
+	}
+	if _, ok := kr.keys[active]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, active)
+	}
+	kr.active = active
+	return kr, nil
+}
+
+// 새로 암호화할 때 쓰는 master key id
+func (kr *Keyring) ActiveID() string {
+	return kr.active
+}
+
+// 설정된 master key id 목록 (정렬됨)
+func (kr *Keyring) IDs() []string {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (kr *Keyring) key(id string) ([]byte, error) {
+	key, ok := kr.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// 랜덤 data key 생성
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// data key를 masterID의 master key로 감싸는 메소드 (AES-GCM, nonce || ciphertext)
+func (kr *Keyring) Wrap(masterID string, dataKey []byte) ([]byte, error) {
+	master, err := kr.key(masterID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// master key id를 AAD로 넣어 다른 key id의 기록과 바꿔치기 할 수 없도록
+	return aead.Seal(nonce, nonce, dataKey, []byte(masterID)), nil
+}
+
+// Wrap으로 감싼 data key를 푸는 메소드
+func (kr *Keyring) Unwrap(masterID string, wrapped []byte) ([]byte, error) {
+	master, err := kr.key(masterID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(masterID))
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// masterID의 master key에서 info 용도의 key를 유도하는 메소드 (HKDF-SHA256)
+// @@@ SSE-C는 요청마다 key를 보내야 하므로 저장하지 않고 객체 key로부터 매번 같은 key를 만들어 쓴다
+func (kr *Keyring) Derive(masterID, info string) ([]byte, error) {
+	master, err := kr.key(masterID)
+	if err != nil {
+		return nil, err
+	}
+	derived := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(info)), derived); err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
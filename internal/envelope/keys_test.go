@@ -0,0 +1,186 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testMasterKey(t *testing.T, id string) string {
+	t.Helper()
+	return id + ":" + base64.StdEncoding.EncodeToString(randomBytes(t, KeySize))
+}
+
+func TestParseKeyring(t *testing.T) {
+	k1 := testMasterKey(t, "k1")
+	k2 := testMasterKey(t, "k2")
+	tests := []struct {
+		name       string
+		spec       string
+		active     string
+		wantActive string
+		wantErr    error
+	}{
+		{name: "single key becomes active", spec: k1, wantActive: "k1"},
+		{name: "explicit active", spec: k1 + "," + k2, active: "k2", wantActive: "k2"},
+		{name: "spaces and empty entries", spec: " " + k1 + " ,, " + k2, active: "k1", wantActive: "k1"},
+		{name: "several keys without active", spec: k1 + "," + k2},
+		{name: "unknown active", spec: k1, active: "k9", wantErr: ErrUnknownKey},
+		{name: "duplicate id", spec: k1 + "," + k1},
+		{name: "missing id", spec: ":" + base64.StdEncoding.EncodeToString(make([]byte, KeySize))},
+		{name: "wrong key size", spec: "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		{name: "invalid base64", spec: "k1:not-base64!"},
+		{name: "empty", spec: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := ParseKeyring(tt.spec, tt.active)
+			if tt.wantActive == "" {
+				if err == nil {
+					t.Fatalf("ParseKeyring() active = %q, want error", kr.ActiveID())
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseKeyring() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKeyring() error = %v", err)
+			}
+			if kr.ActiveID() != tt.wantActive {
+				t.Fatalf("ActiveID() = %q, want %q", kr.ActiveID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	k1 := testMasterKey(t, "k1")
+	k2 := testMasterKey(t, "k2")
+	kr, err := ParseKeyring(k1+","+k2, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := kr.Wrap("k1", dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := kr.Unwrap("k1", wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Fatal("Unwrap() returned a different data key")
+	}
+
+	if _, err := kr.Wrap("k9", dataKey); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Wrap() with unknown id error = %v, want %v", err, ErrUnknownKey)
+	}
+	if _, err := kr.Unwrap("k9", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Unwrap() with unknown id error = %v, want %v", err, ErrUnknownKey)
+	}
+	// master key id가 AAD에 들어가므로 다른 id로는 풀 수 없다
+	if _, err := kr.Unwrap("k2", wrapped); err == nil {
+		t.Fatal("Unwrap() with a different master key id succeeded")
+	}
+	if _, err := kr.Unwrap("k1", wrapped[:8]); err == nil {
+		t.Fatal("Unwrap() of a truncated key succeeded")
+	}
+}
+
+// master key를 바꾼 뒤에도 예전 key로 감싼 data key를 풀 수 있고, 다시 감싸면 새 key로 풀린다
+func TestKeyRotation(t *testing.T) {
+	oldKey := testMasterKey(t, "2025-01")
+	newKey := testMasterKey(t, "2026-01")
+
+	before, err := ParseKeyring(oldKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := before.Wrap(before.ActiveID(), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := ParseKeyring(oldKey+","+newKey, "2026-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := after.Unwrap("2025-01", wrapped)
+	if err != nil {
+		t.Fatalf("Unwrap() with rotated-out key error = %v", err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Fatal("Unwrap() with rotated-out key returned a different data key")
+	}
+	rewrapped, err := after.Wrap(after.ActiveID(), got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 예전 key를 설정에서 지운 뒤에는 새 key로 다시 감싼 기록만 풀린다
+	retired, err := ParseKeyring(newKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.Unwrap("2025-01", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Unwrap() with removed key error = %v, want %v", err, ErrUnknownKey)
+	}
+	got, err = retired.Unwrap("2026-01", rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Fatal("Unwrap() of rewrapped key returned a different data key")
+	}
+}
+
+func TestDerive(t *testing.T) {
+	k1 := testMasterKey(t, "k1")
+	k2 := testMasterKey(t, "k2")
+	kr, err := ParseKeyring(k1+","+k2, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := kr.Derive("k1", "video:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != KeySize {
+		t.Fatalf("Derive() returned %d bytes, want %d", len(a), KeySize)
+	}
+	again, err := kr.Derive("k1", "video:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, again) {
+		t.Fatal("Derive() is not deterministic")
+	}
+
+	otherInfo, err := kr.Derive("k1", "video:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherMaster, err := kr.Derive("k2", "video:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, otherInfo) || bytes.Equal(a, otherMaster) {
+		t.Fatal("Derive() returned the same key for a different info or master key")
+	}
+
+	if _, err := kr.Derive("k9", "video:1"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Derive() with unknown id error = %v, want %v", err, ErrUnknownKey)
+	}
+}
@@ -0,0 +1,274 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// chunk 단위 AES-256-GCM 암호화 형식
+// @@@ 파일 전체를 GCM 하나로 암호화하면 끝까지 읽어야 검증할 수 있어서 영상 탐색(Range 요청)이 불가능
+// @@@ ==> 평문을 ChunkSize 단위로 나눠 각각 암호화하면 필요한 chunk만 읽고 복호화할 수 있다
+//
+// 헤더 : magic(8) | chunk 크기(uint32 big endian, 4) | nonce prefix(8)
+// chunk i : GCM(nonce = nonce prefix || uint32(i), AAD = 헤더 || 마지막 chunk 여부)
+// @@@ 마지막 chunk 여부를 AAD에 넣어 뒷부분을 잘라낸 파일은 복호화에 실패하도록
+
+const (
+	DefaultChunkSize = 64 << 10
+	HeaderSize       = 20
+	tagSize          = 16
+)
+
+var magic = []byte("TBENC1\x00\x00")
+
+var ErrInvalidFormat = errors.New("invalid encrypted object format")
+
+// 평문 크기가 plainSize일 때 암호문 크기
+func EncryptedSize(plainSize int64, chunkSize int) int64 {
+	chunks := max((plainSize+int64(chunkSize)-1)/int64(chunkSize), 1)
+	return HeaderSize + plainSize + chunks*tagSize
+}
+
+// 암호문 크기가 cipherSize일 때 평문 크기
+func PlainSize(cipherSize int64, chunkSize int) (int64, error) {
+	body := cipherSize - HeaderSize
+	full := int64(chunkSize) + tagSize
+	chunks := (body + full - 1) / full
+	// 마지막 chunk에도 tag는 온전히 들어 있어야 한다
+	if body < tagSize || chunks < 1 || body-(chunks-1)*full < tagSize {
+		return 0, ErrInvalidFormat
+	}
+	return body - chunks*tagSize, nil
+}
+
+// src의 평문을 dataKey로 암호화해서 dst에 쓰는 함수, 쓴 byte 수 반환
+func Encrypt(dst io.Writer, src io.Reader, dataKey []byte, chunkSize int) (int64, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, HeaderSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[8:12], uint32(chunkSize))
+	if _, err := rand.Read(header[12:20]); err != nil {
+		return 0, err
+	}
+	written, err := dst.Write(header)
+	total := int64(written)
+	if err != nil {
+		return total, err
+	}
+
+	// 지금 chunk가 마지막인지 알려면 다음 chunk를 미리 읽어야 한다
+	cur := make([]byte, chunkSize)
+	next := make([]byte, chunkSize)
+	curLen, err := readChunk(src, cur)
+	if err != nil {
+		return total, err
+	}
+	out := make([]byte, 0, chunkSize+tagSize)
+	for index := uint32(0); ; index++ {
+		nextLen := 0
+		if curLen == chunkSize {
+			nextLen, err = readChunk(src, next)
+			if err != nil {
+				return total, err
+			}
+		}
+		last := nextLen == 0
+
+		out = aead.Seal(out[:0], chunkNonce(header, index), cur[:curLen], chunkAAD(header, last))
+		written, err := dst.Write(out)
+		total += int64(written)
+		if err != nil {
+			return total, err
+		}
+		if last {
+			return total, nil
+		}
+		cur, next = next, cur
+		curLen = nextLen
+	}
+}
+
+// buf를 최대한 채워 읽고 읽은 byte 수 반환 (끝에 도달해도 에러 아님)
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	return n, err
+}
+
+func chunkNonce(header []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[12:20])
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
+
+func chunkAAD(header []byte, last bool) []byte {
+	aad := make([]byte, HeaderSize+1)
+	copy(aad, header)
+	if last {
+		aad[HeaderSize] = 1
+	}
+	return aad
+}
+
+// 암호문의 offset부터 length byte를 읽는 함수 (length < 0이면 끝까지)
+// @@@ storage.ObjectStore.GetRange를 감싸서 넘긴다
+type RangeOpener func(offset, length int64) (io.ReadCloser, error)
+
+// 암호화된 객체를 평문 기준으로 Read, Seek 할 수 있는 구조체
+// @@@ 순서대로 읽을 때는 암호문 본문을 한 번만 열어 chunk 단위로 읽고, Seek하면 그 chunk부터 다시 연다
+type Reader struct {
+	open       RangeOpener
+	aead       cipher.AEAD
+	header     []byte
+	chunkSize  int64
+	cipherSize int64
+	plainSize  int64
+	numChunks  int64
+
+	offset int64 // 평문 기준 현재 위치
+
+	body      io.ReadCloser // bodyChunk번 chunk 시작 위치부터 열려 있는 암호문
+	bodyChunk int64
+
+	plain      []byte // 복호화된 chunk
+	plainChunk int64  // plain에 들어있는 chunk 번호 (-1이면 없음)
+}
+
+// 헤더를 읽어 Reader를 만드는 함수
+func NewReader(open RangeOpener, cipherSize int64, dataKey []byte) (*Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if cipherSize < HeaderSize+tagSize {
+		return nil, ErrInvalidFormat
+	}
+
+	body, err := open(0, HeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, HeaderSize)
+	_, err = io.ReadFull(body, header)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption header: %w", err)
+	}
+	if !bytes.Equal(header[:8], magic) {
+		return nil, ErrInvalidFormat
+	}
+	chunkSize := int(binary.BigEndian.Uint32(header[8:12]))
+	if chunkSize <= 0 {
+		return nil, ErrInvalidFormat
+	}
+	plainSize, err := PlainSize(cipherSize, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		open:       open,
+		aead:       aead,
+		header:     header,
+		chunkSize:  int64(chunkSize),
+		cipherSize: cipherSize,
+		plainSize:  plainSize,
+		numChunks:  max((plainSize+int64(chunkSize)-1)/int64(chunkSize), 1),
+		plainChunk: -1,
+	}, nil
+}
+
+// 평문 크기
+func (r *Reader) Size() int64 {
+	return r.plainSize
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.plainSize {
+		return 0, io.EOF
+	}
+	index := r.offset / r.chunkSize
+	if r.plainChunk != index {
+		if err := r.loadChunk(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain[r.offset-index*r.chunkSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// index번 chunk를 읽어 복호화하는 메소드
+func (r *Reader) loadChunk(index int64) error {
+	full := r.chunkSize + tagSize
+	if r.body == nil || r.bodyChunk != index {
+		r.closeBody()
+		body, err := r.open(HeaderSize+index*full, -1)
+		if err != nil {
+			return err
+		}
+		r.body = body
+		r.bodyChunk = index
+	}
+
+	chunkLen := min(full, r.cipherSize-HeaderSize-index*full)
+	buf := make([]byte, chunkLen)
+	if _, err := io.ReadFull(r.body, buf); err != nil {
+		r.closeBody()
+		return fmt.Errorf("error reading encrypted chunk %d: %w", index, err)
+	}
+	r.bodyChunk++
+
+	last := index == r.numChunks-1
+	plain, err := r.aead.Open(r.plain[:0], chunkNonce(r.header, uint32(index)), buf, chunkAAD(r.header, last))
+	if err != nil {
+		return fmt.Errorf("error decrypting chunk %d: %w", index, err)
+	}
+	r.plain = plain
+	r.plainChunk = index
+	return nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.plainSize + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *Reader) Close() error {
+	return r.closeBody()
+}
+
+func (r *Reader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
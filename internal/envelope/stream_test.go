@@ -0,0 +1,243 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+// 메모리에 있는 암호문을 RangeOpener로 감싸는 함수
+func bytesOpener(cipherText []byte) RangeOpener {
+	return func(offset, length int64) (io.ReadCloser, error) {
+		end := int64(len(cipherText))
+		if length >= 0 {
+			end = min(offset+length, end)
+		}
+		return io.NopCloser(bytes.NewReader(cipherText[offset:end])), nil
+	}
+}
+
+func encryptBytes(t *testing.T, plain, dataKey []byte, chunkSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := Encrypt(&buf, bytes.NewReader(plain), dataKey, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("Encrypt() wrote %d bytes, returned %d", buf.Len(), n)
+	}
+	return buf.Bytes()
+}
+
+func randomBytes(t *testing.T, size int) []byte {
+	t.Helper()
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	dataKey := randomBytes(t, KeySize)
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "one byte", size: 1},
+		{name: "exactly one chunk", size: DefaultChunkSize},
+		{name: "exactly two chunks", size: 2 * DefaultChunkSize},
+		{name: "not a multiple of chunk size", size: 2*DefaultChunkSize + 12345},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := randomBytes(t, tt.size)
+			cipherText := encryptBytes(t, plain, dataKey, DefaultChunkSize)
+
+			if got := EncryptedSize(int64(tt.size), DefaultChunkSize); got != int64(len(cipherText)) {
+				t.Fatalf("EncryptedSize() = %d, want %d", got, len(cipherText))
+			}
+			plainSize, err := PlainSize(int64(len(cipherText)), DefaultChunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plainSize != int64(tt.size) {
+				t.Fatalf("PlainSize() = %d, want %d", plainSize, tt.size)
+			}
+
+			r, err := NewReader(bytesOpener(cipherText), int64(len(cipherText)), dataKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if r.Size() != int64(tt.size) {
+				t.Fatalf("Size() = %d, want %d", r.Size(), tt.size)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("decrypted %d bytes do not match plaintext of %d bytes", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestPlainSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		cipherSize int64
+		chunkSize  int
+		want       int64
+		wantErr    bool
+	}{
+		{name: "empty", cipherSize: HeaderSize + tagSize, chunkSize: 16, want: 0},
+		{name: "partial chunk", cipherSize: HeaderSize + 5 + tagSize, chunkSize: 16, want: 5},
+		{name: "full chunk", cipherSize: HeaderSize + 16 + tagSize, chunkSize: 16, want: 16},
+		{name: "full and partial chunk", cipherSize: HeaderSize + 16 + tagSize + 1 + tagSize, chunkSize: 16, want: 17},
+		{name: "shorter than header and tag", cipherSize: HeaderSize + tagSize - 1, chunkSize: 16, wantErr: true},
+		// 두 번째 chunk에 tag도 다 들어가지 않는 크기
+		{name: "truncated tag", cipherSize: HeaderSize + 16 + tagSize + 3, chunkSize: 16, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PlainSize(tt.cipherSize, tt.chunkSize)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("PlainSize() = %d, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlainSize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("PlainSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// 영상 탐색처럼 chunk 경계를 넘나드는 위치로 Seek해서 읽는 경우
+func TestReaderSeek(t *testing.T) {
+	const chunkSize = 1024
+	dataKey := randomBytes(t, KeySize)
+	plain := randomBytes(t, 5*chunkSize+100)
+	cipherText := encryptBytes(t, plain, dataKey, chunkSize)
+
+	r, err := NewReader(bytesOpener(cipherText), int64(len(cipherText)), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+		length int
+	}{
+		{name: "across first boundary", offset: chunkSize - 10, whence: io.SeekStart, want: chunkSize - 10, length: 20},
+		{name: "backwards to start", offset: 0, whence: io.SeekStart, want: 0, length: chunkSize},
+		{name: "several chunks from current", offset: 3 * chunkSize, whence: io.SeekCurrent, want: 4 * chunkSize, length: chunkSize + 50},
+		{name: "exact chunk start", offset: 2 * chunkSize, whence: io.SeekStart, want: 2 * chunkSize, length: 3 * chunkSize},
+		{name: "last partial chunk from end", offset: -150, whence: io.SeekEnd, want: int64(len(plain)) - 150, length: 150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, err := r.Seek(tt.offset, tt.whence)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pos != tt.want {
+				t.Fatalf("Seek() = %d, want %d", pos, tt.want)
+			}
+			got := make([]byte, tt.length)
+			if _, err := io.ReadFull(r, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain[pos:pos+int64(tt.length)]) {
+				t.Fatalf("bytes at %d do not match plaintext", pos)
+			}
+		})
+	}
+
+	if _, err := r.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("Read() at end = %d, %v, want 0, EOF", n, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("Seek() to negative position succeeded")
+	}
+}
+
+// 암호문을 자르거나 chunk 순서를 바꾸면 복호화에 실패해야 한다
+func TestReaderRejectsTampering(t *testing.T) {
+	const chunkSize = 1024
+	dataKey := randomBytes(t, KeySize)
+	plain := randomBytes(t, 3*chunkSize)
+	cipherText := encryptBytes(t, plain, dataKey, chunkSize)
+	full := chunkSize + tagSize
+
+	chunk := func(i int) []byte {
+		start := HeaderSize + i*full
+		return cipherText[start : start+full]
+	}
+	header := cipherText[:HeaderSize]
+
+	tests := []struct {
+		name       string
+		cipherText []byte
+	}{
+		// 마지막 chunk를 통째로 잘라내면 두 번째 chunk가 마지막 chunk처럼 보인다
+		{name: "final chunk removed", cipherText: bytes.Join([][]byte{header, chunk(0), chunk(1)}, nil)},
+		{name: "final chunk truncated", cipherText: cipherText[:len(cipherText)-10]},
+		{name: "chunks reordered", cipherText: bytes.Join([][]byte{header, chunk(1), chunk(0), chunk(2)}, nil)},
+		{name: "chunk modified", cipherText: bytes.Join([][]byte{header, chunk(0), flipByte(chunk(1)), chunk(2)}, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytesOpener(tt.cipherText), int64(len(tt.cipherText)), dataKey)
+			if err != nil {
+				// 크기가 형식에 맞지 않아 헤더 단계에서 거부되는 경우
+				return
+			}
+			defer r.Close()
+			if _, err := io.ReadAll(r); err == nil {
+				t.Fatal("tampered ciphertext decrypted without error")
+			}
+		})
+	}
+
+	t.Run("wrong data key", func(t *testing.T) {
+		r, err := NewReader(bytesOpener(cipherText), int64(len(cipherText)), randomBytes(t, KeySize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if _, err := io.ReadAll(r); err == nil {
+			t.Fatal("ciphertext decrypted with the wrong data key")
+		}
+	})
+
+	t.Run("bad magic", func(t *testing.T) {
+		bad := bytes.Clone(cipherText)
+		bad[0] ^= 0xff
+		if _, err := NewReader(bytesOpener(bad), int64(len(bad)), dataKey); err != ErrInvalidFormat {
+			t.Fatalf("NewReader() error = %v, want %v", err, ErrInvalidFormat)
+		}
+	})
+}
+
+func flipByte(b []byte) []byte {
+	flipped := bytes.Clone(b)
+	flipped[len(flipped)/2] ^= 0x01
+	return flipped
+}
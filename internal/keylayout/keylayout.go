@@ -0,0 +1,159 @@
+package keylayout
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// template에서 쓸 수 있는 placeholder 이름
+const (
+	FieldUserID  = "user_id"
+	FieldVideoID = "video_id"
+	FieldVariant = "variant" // blob 용도 (video, thumbnail)
+	FieldExt     = "ext"     // 점(.) 없는 확장자 (mp4, png)
+	FieldAspect  = "aspect"  // square, standard, landscape, portrait, ultrawide, other (영상만)
+	FieldHash    = "hash"    // 파일 내용의 sha256 hash
+)
+
+var knownFields = []string{FieldUserID, FieldVideoID, FieldVariant, FieldExt, FieldAspect, FieldHash}
+
+// 저장소 객체 key를 만드는 template (ex: {user_id}/{video_id}/{variant}.{ext}, {aspect}/{hash}.{ext})
+type Template struct {
+	raw      string
+	segments []segment
+}
+
+// template을 나눈 조각 하나 (field가 빈 문자열이면 literal 그대로)
+type segment struct {
+	literal string
+	field   string
+}
+
+// Render에 넘기는 placeholder 값들
+type Values struct {
+	UserID  string
+	VideoID string
+	Variant string
+	Ext     string
+	Aspect  string
+	Hash    string
+}
+
+func (v Values) get(field string) string {
+	switch field {
+	case FieldUserID:
+		return v.UserID
+	case FieldVideoID:
+		return v.VideoID
+	case FieldVariant:
+		return v.Variant
+	case FieldExt:
+		return v.Ext
+	case FieldAspect:
+		return v.Aspect
+	case FieldHash:
+		return v.Hash
+	}
+	return ""
+}
+
+// template 문자열을 검사하고 Template 반환하는 함수
+// allowed는 이 template에서 쓸 수 있는 placeholder 목록 (비어 있으면 전부 허용)
+// @@@ 객체마다 key가 달라야 하므로 {hash}나 {video_id} 중 하나는 반드시 있어야 한다
+func Parse(raw string, allowed ...string) (*Template, error) {
+	if raw == "" {
+		return nil, errors.New("key template is empty")
+	}
+	if len(allowed) == 0 {
+		allowed = knownFields
+	}
+
+	t := &Template{raw: raw}
+	rest := raw
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.segments = append(t.segments, segment{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("key template %q has an unmatched '}'", raw)
+		}
+		if open > 0 {
+			t.segments = append(t.segments, segment{literal: rest[:open]})
+		}
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end < 0 || rest[open+1+end] != '}' {
+			return nil, fmt.Errorf("key template %q has an unclosed '{'", raw)
+		}
+		field := rest[open+1 : open+1+end]
+		if !slices.Contains(knownFields, field) {
+			return nil, fmt.Errorf("key template %q has unknown placeholder {%s} (must be one of %s)", raw, field, strings.Join(knownFields, ", "))
+		}
+		if !slices.Contains(allowed, field) {
+			return nil, fmt.Errorf("key template %q can't use placeholder {%s}", raw, field)
+		}
+		t.segments = append(t.segments, segment{field: field})
+		rest = rest[open+1+end+1:]
+	}
+
+	if !t.Uses(FieldHash) && !t.Uses(FieldVideoID) {
+		return nil, fmt.Errorf("key template %q must contain {%s} or {%s}", raw, FieldHash, FieldVideoID)
+	}
+	// literal 부분만 검사 (placeholder 값은 Render에서 검사)
+	if strings.HasPrefix(raw, "/") || strings.HasSuffix(raw, "/") || strings.Contains(raw, "//") {
+		return nil, fmt.Errorf("key template %q must not start or end with '/' or contain empty path segments", raw)
+	}
+	for _, part := range strings.Split(raw, "/") {
+		if part == "." || part == ".." {
+			return nil, fmt.Errorf("key template %q must not contain '.' or '..' path segments", raw)
+		}
+	}
+	return t, nil
+}
+
+// template에 field placeholder가 있는지
+func (t *Template) Uses(field string) bool {
+	for _, s := range t.segments {
+		if s.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template) String() string {
+	return t.raw
+}
+
+// placeholder를 값으로 바꿔서 객체 key를 만드는 함수
+// @@@ 값이 비어 있거나 '/'가 들어 있으면 다른 객체와 key가 겹칠 수 있으므로 에러
+func (t *Template) Render(v Values) (string, error) {
+	var b strings.Builder
+	for _, s := range t.segments {
+		if s.field == "" {
+			b.WriteString(s.literal)
+			continue
+		}
+		value := v.get(s.field)
+		if value == "" {
+			return "", fmt.Errorf("no value for placeholder {%s} of key template %q", s.field, t.raw)
+		}
+		if strings.ContainsAny(value, "/{}") || value == "." || value == ".." {
+			return "", fmt.Errorf("invalid value %q for placeholder {%s} of key template %q", value, s.field, t.raw)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// template 맨 앞의 literal 부분 (placeholder로 시작하면 빈 문자열)
+// @@@ staging(uploads/)이나 보관(ARCHIVE_PREFIX) key와 겹치는지 시작할 때 확인하는 용도
+func (t *Template) LiteralPrefix() string {
+	if len(t.segments) == 0 || t.segments[0].field != "" {
+		return ""
+	}
+	return t.segments[0].literal
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 로컬 디렉토리 하나를 ObjectStore로 사용하는 구현체
+// key의 / 는 하위 디렉토리로 취급 (ex: landscape/abc.mp4 ==> <root>/landscape/abc.mp4)
+type LocalStore struct {
+	root string
+}
+
+// 루트 디렉토리 경로를 받아 *LocalStore 반환 (디렉토리가 없으면 생성)
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("error creating local store root %s: %w", root, err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// key를 디스크 경로로 변환하는 메소드
+// @@@ ../ 등으로 root 밖의 경로에 접근하는 key는 거부
+func (s *LocalStore) diskPath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned[1:])), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	p, err := s.diskPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", key, err)
+	}
+
+	// 같은 디렉토리에 임시파일로 먼저 쓰고 rename
+	// ==> 쓰는 도중에 실패하거나 다른 요청이 읽어도 반쪽짜리 파일이 보이지 않는다
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put_*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		return fmt.Errorf("error writing local object %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing local object %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("error renaming local object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	p, err := s.diskPath(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, ObjectInfo{}, localError(key, "opening", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, localError(key, "stating", err)
+	}
+	return f, fileInfo(key, stat), nil
+}
+
+func (s *LocalStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	p, err := s.diskPath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, localError(key, "opening", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, localError(key, "seeking", err)
+	}
+	if length < 0 {
+		return f, nil
+	}
+	// 읽는 건 length byte까지만, Close는 파일을 닫는다
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalStore) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := s.diskPath(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, localError(key, "stating", err)
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("error stating local object %s: %w", key, ErrNotFound)
+	}
+	return fileInfo(key, stat), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.diskPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error deleting local object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		// Put 도중의 임시파일은 객체가 아니므로 제외
+		if strings.HasPrefix(path.Base(key), ".put_") || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileInfo(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing local objects with prefix %q: %w", prefix, err)
+	}
+	return objects, nil
+}
+
+func (s *LocalStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, info, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src, info.ContentType)
+}
+
+// os.FileInfo를 ObjectInfo로 변환하는 함수
+// 로컬 파일은 Content-Type을 따로 저장하지 않으므로 확장자로 추측하고
+// ETag는 크기와 수정시간으로 만든다
+func fileInfo(key string, stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		ETag:         fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}
+}
+
+// 파일이 없다는 에러를 ErrNotFound로 바꿔주는 함수
+func localError(key, action string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error %s local object %s: %w", action, key, ErrNotFound)
+	}
+	return fmt.Errorf("error %s local object %s: %w", action, key, err)
+}
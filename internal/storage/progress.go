@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// @@@ 큰 영상은 저장소 업로드도 오래 걸리므로 클라이언트에 진행률을 보여줄 수 있도록
+// @@@ SSE-C key처럼 ObjectStore 메소드 시그니처를 바꾸지 않고 context로 진행률 함수를 전달한다
+
+type progressCtxKey struct{}
+
+// 업로드 진행률을 받는 함수 (done : 지금까지 올린 byte 수, total : 전체 byte 수)
+type ProgressFunc func(done, total int64)
+
+// 이 context로 부르는 PutFile이 업로드 진행률을 fn으로 알려주도록 하는 함수
+// @@@ fn은 여러 goroutine에서 동시에 불릴 수 있다 (multipart upload)
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressCtxKey{}, fn)
+}
+
+func progressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressCtxKey{}).(ProgressFunc)
+	return fn
+}
+
+// 읽은 위치를 진행률로 알려주는 reader (upload body를 감싸서 사용)
+// @@@ 읽은 양을 더하지 않고 위치를 쓰는 이유 : S3 SDK는 서명이나 재시도 때문에 body를 Seek 해서 다시 읽을 수 있다
+// @@@ ==> Seek하면 위치도 따라가므로 진행률이 100%를 넘지 않는다
+type progressReader struct {
+	r     io.ReadSeeker
+	pos   int64
+	total int64
+	fn    ProgressFunc
+}
+
+func newProgressReader(r io.ReadSeeker, total int64, fn ProgressFunc) *progressReader {
+	return &progressReader{r: r, total: total, fn: fn}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.pos += int64(n)
+		p.fn(p.pos, p.total)
+	}
+	return n, err
+}
+
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.r.Seek(offset, whence)
+	if err == nil {
+		p.pos = pos
+	}
+	return pos, err
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// 저장소 객체를 io.ReadSeeker처럼 읽는 구조체
+// @@@ http.ServeContent는 io.ReadSeeker를 받아 Range 요청을 처리하는데
+// @@@ 객체 전체를 메모리나 디스크에 받지 않도록 Seek은 위치만 바꾸고 Read할 때 그 위치부터 GetRange로 읽는다
+type ObjectReader struct {
+	ctx    context.Context
+	store  ObjectStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser // offset 위치부터 열려 있는 본문 (Seek하면 닫고 nil)
+}
+
+// size는 Head로 얻은 객체 크기
+func NewObjectReader(ctx context.Context, store ObjectStore, key string, size int64) *ObjectReader {
+	return &ObjectReader{
+		ctx:   ctx,
+		store: store,
+		key:   key,
+		size:  size,
+	}
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && r.offset < r.size {
+		// 객체가 중간에 끝나면 잘린 응답이므로 에러
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	if abs != r.offset {
+		// 다른 위치를 읽으려면 새 범위로 다시 열어야 한다
+		r.closeBody()
+		r.offset = abs
+	}
+	return abs, nil
+}
+
+func (r *ObjectReader) Close() error {
+	return r.closeBody()
+}
+
+func (r *ObjectReader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
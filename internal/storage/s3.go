@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// S3 버킷 하나를 ObjectStore로 사용하는 구현체
+type S3Store struct {
+	client    *s3.Client
+	bucket    string
+	multipart MultipartOptions
+}
+
+// s3 client와 버킷 이름, multipart upload 설정을 받아 *S3Store 반환
+func NewS3Store(client *s3.Client, bucket string, multipart MultipartOptions) *S3Store {
+	return &S3Store{
+		client:    client,
+		bucket:    bucket,
+		multipart: multipart,
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	_, err := s.client.PutObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error putting s3 object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, ObjectInfo{}, s3Error(key, "getting", err)
+	}
+
+	info := ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}
+	return out.Body, info, nil
+}
+
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	// Range 헤더는 bytes=<시작>-<끝> 형태이고 끝은 포함, 끝을 비우면 마지막 byte까지
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, s3Error(key, "getting", err)
+	}
+	return out.Body, nil
+}
+
+func (s *S3Store) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	out, err := s.client.HeadObject(ctx, input)
+	if err != nil {
+		return ObjectInfo{}, s3Error(key, "heading", err)
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	// S3의 DeleteObject는 없는 key를 삭제해도 에러를 반환하지 않는다
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting s3 object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// ListObjectsV2는 한번에 최대 1000개까지만 반환하므로 paginator로 끝까지 읽기
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	objects := []ObjectInfo{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing s3 objects with prefix %q: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s *S3Store) Copy(ctx context.Context, srcKey, dstKey string) error {
+	input := &s3.CopyObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(dstKey),
+		// CopySource는 <bucket>/<key> 형태를 url encoding 해서 입력해야 한다
+		CopySource: aws.String(url.PathEscape(s.bucket + "/" + srcKey)),
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		// 원본을 읽을 때와 복사본을 저장할 때 같은 key 사용
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	_, err := s.client.CopyObject(ctx, input)
+	if err != nil {
+		return s3Error(srcKey, "copying", err)
+	}
+	return nil
+}
+
+// s3 api 에러 중 객체가 없다는 에러(NoSuchKey, NotFound)를 ErrNotFound로 바꿔주는 함수
+func s3Error(key, action string, err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return fmt.Errorf("error %s s3 object %s: %w", action, key, ErrNotFound)
+		}
+	}
+	return fmt.Errorf("error %s s3 object %s: %w", action, key, err)
+}
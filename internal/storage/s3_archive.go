@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// 객체의 storage class를 바꿀 수 있는 저장소가 추가로 구현하는 인터페이스
+// @@@ 오래 재생되지 않은 영상을 STANDARD_IA, GLACIER_IR, GLACIER, DEEP_ARCHIVE 같은 저렴한 class로 옮길 때 사용
+type StorageClassMover interface {
+	// key 객체를 class로 바꿈 (빈 문자열이면 기본 class)
+	SetStorageClass(ctx context.Context, key, class string) error
+	// GLACIER, DEEP_ARCHIVE 객체를 days일 동안 읽을 수 있도록 임시 복원 요청 (이미 진행 중이면 에러 아님)
+	RequestRestore(ctx context.Context, key string, days int32) error
+	// key 객체를 지금 바로 읽을 수 있는지 (바로 읽을 수 있는 class이거나 임시 복원이 끝났으면 true)
+	IsReadable(ctx context.Context, key string) (bool, error)
+}
+
+func (s *S3Store) SetStorageClass(ctx context.Context, key, class string) error {
+	// @@@ 같은 위치로 CopyObject 하면서 StorageClass만 바꾼다 (메타데이터는 그대로 복사)
+	// @@@ CopyObject는 5GB까지만 가능하므로 그보다 큰 객체는 UploadPartCopy가 필요
+	storageClass := types.StorageClassStandard
+	if class != "" {
+		storageClass = types.StorageClass(class)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		CopySource:   aws.String(url.PathEscape(s.bucket + "/" + key)),
+		StorageClass: storageClass,
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	_, err := s.client.CopyObject(ctx, input)
+	if err != nil {
+		return s3Error(key, "changing storage class of", err)
+	}
+	return nil
+}
+
+func (s *S3Store) RequestRestore(ctx context.Context, key string, days int32) error {
+	_, err := s.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &types.RestoreRequest{
+			Days: aws.Int32(days),
+			GlacierJobParameters: &types.GlacierJobParameters{
+				Tier: types.TierStandard,
+			},
+		},
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "RestoreAlreadyInProgress" {
+			return nil
+		}
+		return s3Error(key, "restoring", err)
+	}
+	return nil
+}
+
+func (s *S3Store) IsReadable(ctx context.Context, key string) (bool, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	out, err := s.client.HeadObject(ctx, input)
+	if err != nil {
+		return false, s3Error(key, "heading", err)
+	}
+
+	switch out.StorageClass {
+	case types.StorageClassGlacier, types.StorageClassDeepArchive:
+	default:
+		return true, nil
+	}
+	// Restore 헤더 : 진행 중이면 ongoing-request="true", 끝났으면 ongoing-request="false", expiry-date="..."
+	restore := aws.ToString(out.Restore)
+	if restore == "" {
+		return false, nil
+	}
+	if strings.Contains(restore, `ongoing-request="false"`) {
+		return true, nil
+	}
+	if strings.Contains(restore, `ongoing-request="true"`) {
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected restore status %q for s3 object %s", restore, key)
+}
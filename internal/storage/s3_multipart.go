@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// S3 multipart upload 제한: 마지막 part를 제외한 part는 최소 5MiB, part 개수는 최대 10000개
+	minPartSize = 5 << 20
+	maxParts    = 10000
+)
+
+// 큰 파일을 여러 part로 나눠서 올릴 수 있는 저장소가 추가로 구현하는 인터페이스
+type MultipartPutter interface {
+	// body의 0 ~ size 구간을 part 단위로 나눠 병렬 업로드
+	// io.ReaderAt을 받으므로 파일 전체를 메모리에 올리지 않고 part 구간만 읽는다
+	PutMultipart(ctx context.Context, key string, body io.ReaderAt, size int64, contentType string) error
+	// 이 크기 이상인 파일만 multipart upload 사용
+	MultipartThreshold() int64
+}
+
+// multipart upload 설정
+type MultipartOptions struct {
+	PartSize    int64 // part 하나의 크기 (byte)
+	Concurrency int   // 동시에 업로드하는 part 개수
+	MaxRetries  int   // part 하나가 실패했을 때 재시도 횟수
+}
+
+func (s *S3Store) MultipartThreshold() int64 {
+	return s.multipart.PartSize
+}
+
+// size 크기의 파일을 올릴 때 사용할 part 크기와 part 개수를 계산하는 메소드
+// 설정된 PartSize를 기본으로 하되 S3 제한(최소 5MiB, 최대 10000개)에 맞게 조정
+func (s *S3Store) PartLayout(size int64) (partSize int64, numParts int) {
+	partSize = s.multipart.PartSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	// part 개수가 10000개를 넘으면 part 크기를 늘린다
+	if (size+partSize-1)/partSize > maxParts {
+		partSize = (size + maxParts - 1) / maxParts
+	}
+	numParts = int((size + partSize - 1) / partSize)
+	if numParts == 0 {
+		numParts = 1
+	}
+	return partSize, numParts
+}
+
+func (s *S3Store) PutMultipart(ctx context.Context, key string, body io.ReaderAt, size int64, contentType string) error {
+	partSize, numParts := s.PartLayout(size)
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	}
+	// SSE-C는 업로드를 시작할 때와 part마다 같은 key를 보내야 한다
+	if sse, ok := sseCFromContext(ctx); ok {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+	}
+	created, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error creating multipart upload for %s: %w", key, err)
+	}
+	uploadID := created.UploadId
+
+	// 하나의 part라도 최종 실패하면 나머지 worker도 멈추도록 취소 가능한 context 사용
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	partNumbers := make(chan int32)
+	var mu sync.Mutex
+	completed := make([]types.CompletedPart, 0, numParts)
+	var firstErr error
+	// 진행률은 끝난 part 크기 합 (part는 재시도하면 처음부터 다시 올리므로)
+	progress := progressFromContext(ctx)
+	var uploaded int64
+
+	concurrency := s.multipart.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range partNumbers {
+				offset := int64(partNumber-1) * partSize
+				length := min(partSize, size-offset)
+
+				etag, err := s.uploadPartWithRetry(partCtx, key, uploadID, partNumber, io.NewSectionReader(body, offset, length), length)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					completed = append(completed, types.CompletedPart{
+						ETag:       etag,
+						PartNumber: aws.Int32(partNumber),
+					})
+					uploaded += length
+					if progress != nil {
+						progress(uploaded, size)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 1; i <= numParts; i++ {
+		select {
+		case partNumbers <- int32(i):
+		case <-partCtx.Done():
+		}
+		if partCtx.Err() != nil {
+			break
+		}
+	}
+	close(partNumbers)
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		s.abortMultipart(ctx, key, uploadID)
+		return fmt.Errorf("error uploading parts for %s: %w", key, firstErr)
+	}
+
+	// CompleteMultipartUpload의 part 목록은 PartNumber 오름차순이어야 한다
+	sort.Slice(completed, func(i, j int) bool {
+		return aws.ToInt32(completed[i].PartNumber) < aws.ToInt32(completed[j].PartNumber)
+	})
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		s.abortMultipart(ctx, key, uploadID)
+		return fmt.Errorf("error completing multipart upload for %s: %w", key, err)
+	}
+	return nil
+}
+
+// part 하나를 업로드하고 실패하면 MaxRetries번까지 backoff 후 재시도하는 메소드
+// @@@ io.SectionReader는 Seek 가능하므로 재시도할 때 처음부터 다시 읽을 수 있다
+func (s *S3Store) uploadPartWithRetry(ctx context.Context, key string, uploadID *string, partNumber int32, part *io.SectionReader, length int64) (*string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= s.multipart.MaxRetries; attempt++ {
+		if attempt > 0 {
+			// 500ms, 1s, 2s, ... 로 재시도 간격을 늘린다
+			backoff := time.Duration(1<<(attempt-1)) * 500 * time.Millisecond
+			log.Printf("retrying part %d of %s (attempt %d) after %v: %v", partNumber, key, attempt, backoff, lastErr)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if _, err := part.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String(s.bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          part,
+			ContentLength: aws.Int64(length),
+		}
+		if sse, ok := sseCFromContext(ctx); ok {
+			input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.algorithm, sse.key, sse.keyMD5
+		}
+		out, err := s.client.UploadPart(ctx, input)
+		if err == nil {
+			return out.ETag, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("part %d failed after %d retries: %w", partNumber, s.multipart.MaxRetries, lastErr)
+}
+
+// 실패한 multipart upload 세션을 정리하는 메소드
+// @@@ abort하지 않으면 이미 올라간 part들이 버킷에 남아 저장 비용이 계속 나간다
+func (s *S3Store) abortMultipart(ctx context.Context, key string, uploadID *string) {
+	// 요청 context가 이미 취소됐어도 abort는 실행되어야 하므로 취소를 끊은 context 사용
+	abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	_, err := s.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		log.Printf("error aborting multipart upload %s for %s: %v", aws.ToString(uploadID), key, err)
+	}
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// 클라이언트가 서버를 거치지 않고 버킷에 직접 올리고 받을 수 있도록
+// 일정 시간이 지나면 만료되는 pre-signed url을 만들 수 있는 저장소가 추가로 구현하는 인터페이스
+// @@@ local 저장소는 구현하지 않음
+type Presigner interface {
+	// key 위치에 PUT 할 수 있는 url
+	PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error)
+	// key 객체를 GET 할 수 있는 url
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+
+	// 큰 파일을 part별로 직접 올리기 위한 multipart upload 세션 관리
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expires time.Duration) (string, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+	// 세션에 지금까지 올라온 part 크기의 합 (complete 전에 용량 확인용)
+	MultipartUploadSize(ctx context.Context, key, uploadID string) (int64, error)
+	// prefix로 시작하는 key의 끝나지 않은 multipart upload 세션 목록
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error)
+	// size 크기 파일의 part 크기와 part 개수
+	PartLayout(size int64) (partSize int64, numParts int)
+}
+
+// 끝나지 않은(complete, abort 하지 않은) multipart upload 세션 하나
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// 클라이언트가 올린 part 하나의 번호와 응답으로 받은 ETag
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+func (s *S3Store) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error) {
+	// s3.NewPresignClient함수는
+	// pre-signed url 생성에 필요한 s3.PresignClient 구조체의 포인터 반환
+	presignClient := s3.NewPresignClient(s.client)
+
+	req, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("error presigning put for %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	// PresignGetObject 메소드는 presign된 http request 생성
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("error presigning get for %s: %w", key, err)
+	}
+	// v4.PresignedHTTPRequest 구조체의 URL 필드를 반환
+	return req.URL, nil
+}
+
+func (s *S3Store) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating multipart upload for %s: %w", key, err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+func (s *S3Store) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	req, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int32(partNumber),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("error presigning part %d for %s: %w", partNumber, key, err)
+	}
+	return req.URL, nil
+}
+
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	// part 목록은 PartNumber 오름차순이어야 한다
+	sort.Slice(completed, func(i, j int) bool {
+		return aws.ToInt32(completed[i].PartNumber) < aws.ToInt32(completed[j].PartNumber)
+	})
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("error completing multipart upload for %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("error aborting multipart upload for %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) MultipartUploadSize(ctx context.Context, key, uploadID string) (int64, error) {
+	// ListParts도 한번에 최대 1000개까지만 반환하므로 paginator로 끝까지 읽기
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	var size int64
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("error listing parts of multipart upload for %s: %w", key, err)
+		}
+		for _, part := range page.Parts {
+			size += aws.ToInt64(part.Size)
+		}
+	}
+	return size, nil
+}
+
+func (s *S3Store) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	paginator := s3.NewListMultipartUploadsPaginator(s.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	uploads := []MultipartUpload{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing multipart uploads with prefix %q: %w", prefix, err)
+		}
+		for _, upload := range page.Uploads {
+			uploads = append(uploads, MultipartUpload{
+				Key:       aws.ToString(upload.Key),
+				UploadID:  aws.ToString(upload.UploadId),
+				Initiated: aws.ToTime(upload.Initiated),
+			})
+		}
+	}
+	return uploads, nil
+}
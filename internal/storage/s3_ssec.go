@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// @@@ SSE-C(server-side encryption with customer-provided keys) : S3가 저장할 때 암호화하지만 key는 저장하지 않는다
+// @@@ ==> 같은 객체를 읽거나 Head, Copy 할 때마다 같은 key를 헤더로 보내야 하고 key가 없으면 S3도 읽을 수 없다
+// @@@ ObjectStore 메소드 시그니처를 바꾸지 않도록 key는 context로 전달 (key가 없는 context면 평소처럼 동작)
+
+type sseCustomerKeyCtxKey struct{}
+
+// 이 context로 호출하는 S3Store 메소드가 SSE-C key를 사용하도록 하는 함수
+// @@@ LocalStore는 key를 무시하므로 SSE-C는 s3 저장소에서만 의미가 있다
+func WithSSECustomerKey(ctx context.Context, key []byte) context.Context {
+	return context.WithValue(ctx, sseCustomerKeyCtxKey{}, key)
+}
+
+func sseCustomerKey(ctx context.Context) []byte {
+	key, _ := ctx.Value(sseCustomerKeyCtxKey{}).([]byte)
+	return key
+}
+
+// SSE-C 요청 헤더 3개 (알고리즘, base64 key, base64 key md5)
+type sseCHeaders struct {
+	algorithm *string
+	key       *string
+	keyMD5    *string
+}
+
+// context에 key가 없으면 ok == false
+func sseCFromContext(ctx context.Context) (sseCHeaders, bool) {
+	key := sseCustomerKey(ctx)
+	if key == nil {
+		return sseCHeaders{}, false
+	}
+	return newSSECHeaders(key), true
+}
+
+func newSSECHeaders(key []byte) sseCHeaders {
+	sum := md5.Sum(key)
+	return sseCHeaders{
+		algorithm: aws.String("AES256"),
+		key:       aws.String(base64.StdEncoding.EncodeToString(key)),
+		keyMD5:    aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	}
+}
+
+// SSE-C로 암호화된 객체의 key를 바꿀 수 있는 저장소가 추가로 구현하는 인터페이스
+type SSECRekeyer interface {
+	// oldKey로 암호화된 key 위치의 객체를 newKey로 다시 암호화
+	RekeySSEC(ctx context.Context, key string, oldKey, newKey []byte) error
+}
+
+func (s *S3Store) RekeySSEC(ctx context.Context, key string, oldKey, newKey []byte) error {
+	// @@@ 같은 위치로 CopyObject 하면서 원본은 이전 key로 읽고 결과는 새 key로 저장 ==> 데이터가 서버 밖으로 나오지 않는다
+	// @@@ CopyObject는 5GB까지만 가능하므로 그보다 큰 객체는 UploadPartCopy가 필요
+	src, dst := newSSECHeaders(oldKey), newSSECHeaders(newKey)
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:                         aws.String(s.bucket),
+		Key:                            aws.String(key),
+		CopySource:                     aws.String(url.PathEscape(s.bucket + "/" + key)),
+		CopySourceSSECustomerAlgorithm: src.algorithm,
+		CopySourceSSECustomerKey:       src.key,
+		CopySourceSSECustomerKeyMD5:    src.keyMD5,
+		SSECustomerAlgorithm:           dst.algorithm,
+		SSECustomerKey:                 dst.key,
+		SSECustomerKeyMD5:              dst.keyMD5,
+	})
+	if err != nil {
+		return s3Error(key, "rekeying", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 요청한 key에 해당하는 객체가 저장소에 없을 때 반환하는 에러
+var ErrNotFound = errors.New("object not found")
+
+// 저장소에 저장된 객체 하나의 메타데이터를 담는 구조체
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// 영상, 썸네일 등 미디어 파일을 저장하는 저장소 인터페이스
+// ==> S3 버킷(S3Store)과 로컬 디렉토리(LocalStore) 두 구현이 있고 설정(STORAGE_BACKEND)으로 선택
+// @@@ handler들은 *s3.Client를 직접 쓰지 않고 이 인터페이스만 사용하므로 AWS 없이도 실행 가능
+type ObjectStore interface {
+	// body의 데이터를 key 위치에 저장 (이미 있으면 덮어쓰기)
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// key 위치의 객체 데이터를 읽는 io.ReadCloser 반환 ==> 다 읽은 후 반드시 Close 해야 한다
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// key 위치의 객체 데이터 중 offset부터 length byte만 읽는 io.ReadCloser 반환 (length < 0이면 끝까지)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// 데이터는 읽지 않고 메타데이터만 반환
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	// key 위치의 객체 삭제 (없는 객체를 삭제해도 에러 아님)
+	Delete(ctx context.Context, key string) error
+	// prefix로 시작하는 모든 객체의 메타데이터 반환
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// srcKey 객체를 dstKey 위치로 복사
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// 디스크의 파일을 저장소에 올리는 함수
+// 저장소가 MultipartPutter를 구현하고 파일이 threshold 이상이면 multipart upload, 아니면 일반 Put 사용
+// ctx에 WithProgress로 진행률 함수가 있으면 올리는 동안 진행률을 알려준다
+func PutFile(ctx context.Context, store ObjectStore, key string, f *os.File, contentType string) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error stating %s: %w", f.Name(), err)
+	}
+
+	if mp, ok := store.(MultipartPutter); ok && stat.Size() >= mp.MultipartThreshold() {
+		return mp.PutMultipart(ctx, key, f, stat.Size(), contentType)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking %s: %w", f.Name(), err)
+	}
+	if progress := progressFromContext(ctx); progress != nil {
+		return store.Put(ctx, key, newProgressReader(f, stat.Size(), progress), contentType)
+	}
+	return store.Put(ctx, key, f, contentType)
+}
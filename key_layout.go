@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/keylayout"
+	"github.com/google/uuid"
+)
+
+// @@@ 예전에는 key가 <aspect>/<hash>.mp4로 고정되어 있어 유저별 lifecycle rule, IAM prefix, 비용 집계를 할 수 없었다
+// @@@ ==> VIDEO_KEY_TEMPLATE, THUMBNAIL_KEY_TEMPLATE으로 key layout을 정하고 rewrite-keys 명령어로 기존 객체를 옮긴다
+// @@@ template에 {user_id}나 {video_id}가 있으면 같은 내용도 그 범위(유저, video) 안에서만 blob을 공유한다
+// @@@ (다른 유저의 prefix 아래 객체를 참조하면 prefix별 권한, 비용 집계가 의미 없어지므로)
+
+// 기본 key layout (예전 getS3AssetPath, getS3ThumbnailPath와 같은 key)
+const (
+	defaultVideoKeyTemplate     = "{aspect}/{hash}.{ext}"
+	defaultThumbnailKeyTemplate = "thumbnails/{hash}.{ext}"
+)
+
+// key template 환경변수를 읽고 검사하는 함수, 설정 안 되어 있으면 기본값
+// reservedPrefixes로 시작하는 template은 staging, 보관 객체와 key가 겹칠 수 있으므로 거절
+func getEnvKeyTemplate(name, defaultValue string, reservedPrefixes []string, allowed ...string) *keylayout.Template {
+	value := os.Getenv(name)
+	if value == "" {
+		value = defaultValue
+	}
+	layout, err := keylayout.Parse(value, allowed...)
+	if err != nil {
+		log.Fatalf("%s environment variable is invalid: %v", name, err)
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix != "" && strings.HasPrefix(layout.LiteralPrefix(), prefix) {
+			log.Fatalf("%s must not start with %q (reserved for other objects)", name, prefix)
+		}
+	}
+	if !layout.Uses(keylayout.FieldHash) {
+		// @@@ 파일을 바꿔도 key가 같으므로 cloud front 등 캐시가 이전 내용을 계속 줄 수 있다
+		log.Printf("%s %q has no {hash}: replaced files reuse the same key, cached copies may be served until they expire", name, value)
+	}
+	return layout
+}
+
+// blob kind에 해당하는 key template
+func (cfg *apiConfig) keyLayout(kind string) *keylayout.Template {
+	if kind == database.BlobKindThumbnail {
+		return cfg.thumbnailKeyLayout
+	}
+	return cfg.videoKeyLayout
+}
+
+// 파일 내용 hash와 template의 공유 범위로 blob 식별자(blobs.hash)를 만드는 apiConfig method
+// ex: <hash>, <hash>@user:<userID>, <hash>@video:<videoID>
+func (cfg *apiConfig) blobID(kind, contentHash string, userID, videoID uuid.UUID) string {
+	layout := cfg.keyLayout(kind)
+	switch {
+	case layout.Uses(keylayout.FieldVideoID):
+		return contentHash + "@video:" + videoID.String()
+	case layout.Uses(keylayout.FieldUserID):
+		return contentHash + "@user:" + userID.String()
+	}
+	return contentHash
+}
+
+// blob 식별자에서 파일 내용 hash만 꺼내는 함수
+func blobContentHash(id string) string {
+	hash, _, _ := strings.Cut(id, "@")
+	return hash
+}
+
+// kind용 template으로 저장소 객체 key를 만드는 apiConfig method
+// aspect는 영상만 (썸네일은 빈 문자열)
+func (cfg *apiConfig) blobKey(kind string, userID, videoID uuid.UUID, contentHash, mediaType, aspect string) (string, error) {
+	return cfg.keyLayout(kind).Render(keylayout.Values{
+		UserID:  userID.String(),
+		VideoID: videoID.String(),
+		Variant: kind,
+		Ext:     strings.TrimPrefix(mediaTypeToExt(mediaType), "."),
+		Aspect:  aspect,
+		Hash:    contentHash,
+	})
+}
+
+// key 재배치 결과 보고서
+type keyRewriteReport struct {
+	DryRun    bool     `json:"dry_run"`
+	Refs      int      `json:"refs"`      // 살펴본 video의 blob 참조 개수
+	Moved     int      `json:"moved"`     // key만 바뀌어 옮긴 blob 개수
+	Split     int      `json:"split"`     // 공유 범위가 바뀌어 다른 blob을 참조하게 된 참조 개수
+	Unchanged int      `json:"unchanged"` // 이미 새 layout인 참조 개수
+	Skipped   int      `json:"skipped"`   // 보관 중이거나 media 저장소에 없는 blob의 참조 개수
+	Errors    []string `json:"errors"`
+	Rewritten []string `json:"rewritten"` // "<이전 key> -> <새 key>"
+}
+
+// 모든 blob을 지금 key template의 위치로 옮기는 apiConfig method
+// dryRun이면 옮기지 않고 보고서만 만든다
+// @@@ 여러 번 실행해도 이미 옮긴 참조는 건너뛴다
+// @@@ 공유 범위가 바뀌지 않았으면 MoveBlob으로 blob 하나를 옮기고 참조하는 모든 video의 url을 같이 바꾼다
+// @@@ 공유 범위가 바뀌었으면(ex: {user_id} 추가) 참조마다 새 범위의 blob을 만들거나 찾아서 연결한다
+// @@@ ==> 참조가 0이 된 이전 blob의 객체는 삭제 예약되고 runPendingDeletions가 지운다
+func (cfg *apiConfig) rewriteKeys(ctx context.Context, dryRun bool) (keyRewriteReport, error) {
+	report := keyRewriteReport{
+		DryRun:    dryRun,
+		Errors:    []string{},
+		Rewritten: []string{},
+	}
+
+	refs, err := cfg.db.GetVideoBlobRefs()
+	if err != nil {
+		return report, fmt.Errorf("error getting video blobs: %w", err)
+	}
+
+	// 이번 실행에서 만들었거나 옮긴 blob (dry run에서도 같은 blob을 두 번 세지 않도록)
+	done := map[string]bool{}
+	for _, ref := range refs {
+		report.Refs++
+		blob := ref.Blob
+		if blob.ArchiveStatus != "" || blob.Store != storeMedia {
+			// 보관된 blob은 복원된 뒤에, assets 저장소의 썸네일은 migrate-thumbnails 후에 옮긴다
+			report.Skipped++
+			continue
+		}
+
+		aspect := blob.Aspect
+		if ref.Kind == database.BlobKindVideo && aspect == "" && cfg.videoKeyLayout.Uses(keylayout.FieldAspect) {
+			aspect, err = cfg.probeBlobAspect(ctx, blob)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("error computing aspect ratio of blob %s: %v", blob.Hash, err))
+				continue
+			}
+			if !dryRun {
+				if err := cfg.db.SetBlobAspect(blob.Hash, aspect); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("error saving aspect ratio of blob %s: %v", blob.Hash, err))
+					continue
+				}
+			}
+		}
+
+		contentHash := blobContentHash(blob.Hash)
+		newID := cfg.blobID(ref.Kind, contentHash, ref.UserID, ref.VideoID)
+		newKey, err := cfg.blobKey(ref.Kind, ref.UserID, ref.VideoID, contentHash, blob.ContentType, aspect)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error building key for blob %s: %v", blob.Hash, err))
+			continue
+		}
+
+		if newID == blob.Hash {
+			if newKey == blob.Key || done[newID] {
+				report.Unchanged++
+				continue
+			}
+			done[newID] = true
+			if !dryRun {
+				if err := cfg.moveBlobKey(ctx, blob, newKey); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("error moving blob %s: %v", blob.Hash, err))
+					continue
+				}
+			}
+			report.Moved++
+			report.Rewritten = append(report.Rewritten, blob.Key+" -> "+newKey)
+			continue
+		}
+
+		created := !done[newID]
+		done[newID] = true
+		if !dryRun {
+			created, err = cfg.splitBlobRef(ctx, ref, newID, newKey, aspect)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("error moving %s of video %s: %v", ref.Kind, ref.VideoID, err))
+				continue
+			}
+		}
+		report.Split++
+		if created {
+			report.Rewritten = append(report.Rewritten, blob.Key+" -> "+newKey)
+		}
+	}
+
+	return report, nil
+}
+
+// blob 객체를 같은 저장소의 newKey로 복사하고 blob 위치와 url을 바꾸는 apiConfig method
+func (cfg *apiConfig) moveBlobKey(ctx context.Context, blob database.Blob, newKey string) error {
+	if inUse, err := cfg.db.IsBlobKey(storeMedia, newKey); err != nil || inUse {
+		if err == nil {
+			err = fmt.Errorf("key %s is already used by another blob", newKey)
+		}
+		return err
+	}
+	if err := cfg.copyMediaObject(ctx, blob.Store, blob.Key, storeMedia, newKey); err != nil {
+		return err
+	}
+	queued, err := cfg.db.MoveBlob(blob.Hash, storeMedia, newKey, cfg.objectURL(storeMedia, newKey))
+	if err != nil {
+		return err
+	}
+	cfg.attemptPendingDeletions(ctx, queued)
+	return nil
+}
+
+// video 하나의 참조를 newID blob으로 바꾸는 apiConfig method
+// newID blob이 아직 없으면 객체를 newKey로 복사해서 만든다 (만들었으면 true)
+func (cfg *apiConfig) splitBlobRef(ctx context.Context, ref database.VideoBlobRef, newID, newKey, aspect string) (bool, error) {
+	target, err := cfg.db.GetBlob(newID)
+	if err != nil {
+		return false, err
+	}
+	created := target.Hash == ""
+	if created {
+		if inUse, err := cfg.db.IsBlobKey(storeMedia, newKey); err != nil || inUse {
+			if err == nil {
+				err = fmt.Errorf("key %s is already used by another blob", newKey)
+			}
+			return false, err
+		}
+		if err := cfg.copyMediaObject(ctx, ref.Blob.Store, ref.Blob.Key, storeMedia, newKey); err != nil {
+			return false, err
+		}
+		target = database.Blob{
+			CreateBlobParams: database.CreateBlobParams{
+				Hash:        newID,
+				Store:       storeMedia,
+				Key:         newKey,
+				Size:        ref.Blob.Size,
+				ContentType: ref.Blob.ContentType,
+				Aspect:      aspect,
+			},
+		}
+	}
+	// 이전 blob의 참조가 0이 되면 AttachVideoBlob이 객체 삭제를 예약한다
+	err = cfg.db.AttachVideoBlob(ref.VideoID, ref.Kind, target.CreateBlobParams, cfg.objectURL(target.Store, target.Key))
+	return created, err
+}
+
+// 화면비를 모르는 영상 blob을 임시 파일로 받아 ffprobe로 화면비를 계산하는 apiConfig method
+func (cfg *apiConfig) probeBlobAspect(ctx context.Context, blob database.Blob) (string, error) {
+	meta, err := cfg.probeBlob(ctx, blob)
+	if err != nil {
+		return "", err
+	}
+	return videoAspectLabel(meta.Width, meta.Height), nil
+}
+
+// 영상 blob을 임시 파일로 받아 ffprobe로 영상 정보를 읽는 apiConfig method (FileSize는 blob 크기)
+// @@@ 암호화된 영상은 복호화하면서 받는다
+func (cfg *apiConfig) probeBlob(ctx context.Context, blob database.Blob) (database.VideoMetadata, error) {
+	reader, _, err := cfg.openMediaObject(ctx, blob.Store, blob.Key)
+	if err != nil {
+		return database.VideoMetadata{}, err
+	}
+	defer reader.Close()
+
+	tempFile, err := os.CreateTemp("", "tubely-probe_*"+mediaTypeToExt(blob.ContentType))
+	if err != nil {
+		return database.VideoMetadata{}, err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+	if _, err := io.Copy(tempFile, reader); err != nil {
+		return database.VideoMetadata{}, err
+	}
+	meta, err := probeVideo(tempFile.Name())
+	if err != nil {
+		return database.VideoMetadata{}, err
+	}
+	meta.FileSize = blob.Size
+	return meta, nil
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ 몇 달 동안 아무도 보지 않은 영상도 기본 storage class에 그대로 있어 저장 비용이 계속 나간다
+// @@@ ==> video마다 마지막 재생 시각(last_accessed_at)을 기록하고 ARCHIVE_AFTER 동안 재생되지 않은 영상 blob을 보관
+// @@@ 보관된 영상은 재생할 수 없고 소유자가 복원을 요청하면 다시 재생 가능해진다
+// @@@ 같은 내용의 영상은 blob 하나를 공유하므로 보관 상태는 blob 단위 (video의 archive_status는 영상 blob의 상태)
+
+// ARCHIVE_MODE 값
+const (
+	archiveModeStorageClass = "storage-class"
+	archiveModePrefix       = "prefix"
+	archiveModeBackend      = "backend"
+)
+
+// 재생 시각 기록 간격 (Range 요청마다 db에 쓰지 않도록)
+const touchInterval = time.Hour
+
+// video가 재생됐다고 기록하는 apiConfig method (실패해도 재생은 계속되도록 로그만 남김)
+func (cfg *apiConfig) touchVideo(video database.Video) {
+	if err := cfg.db.TouchVideo(video.ID, touchInterval); err != nil {
+		log.Printf("error recording access to video %s: %v", video.ID, err)
+	}
+}
+
+// 저장소 객체를 읽고 쓸 때 쓰는 context를 만드는 apiConfig method
+// SSE-C로 암호화된 객체면 key를 담은 context 반환
+func (cfg *apiConfig) mediaObjectContext(ctx context.Context, storeName, key string) (context.Context, error) {
+	objectKey, err := cfg.db.GetObjectKey(storeName, key)
+	if err != nil {
+		return nil, fmt.Errorf("error getting encryption key record: %w", err)
+	}
+	if objectKey.Mode != database.EncryptionSSEC {
+		return ctx, nil
+	}
+	if cfg.masterKeys == nil {
+		return nil, errors.New("object is encrypted but MEDIA_MASTER_KEYS is not set")
+	}
+	sseKey, err := cfg.masterKeys.Derive(objectKey.MasterKeyID, sseCKeyInfo(storeName, key))
+	if err != nil {
+		return nil, err
+	}
+	return storage.WithSSECustomerKey(ctx, sseKey), nil
+}
+
+// 영상 객체를 다른 저장소나 key로 복사하는 apiConfig method
+// 암호화된 객체면 새 위치의 key 기록도 만든다 (이전 위치의 기록은 객체가 삭제될 때 같이 지워진다)
+// @@@ SSE-C key는 위치마다 다르게 유도되므로 서버를 거쳐 이전 key로 읽고 새 key로 다시 올린다
+func (cfg *apiConfig) copyMediaObject(ctx context.Context, srcStoreName, srcKey, dstStoreName, dstKey string) error {
+	srcStore, err := cfg.storeByName(srcStoreName)
+	if err != nil {
+		return err
+	}
+	dstStore, err := cfg.storeByName(dstStoreName)
+	if err != nil {
+		return err
+	}
+	objectKey, err := cfg.db.GetObjectKey(srcStoreName, srcKey)
+	if err != nil {
+		return fmt.Errorf("error getting encryption key record: %w", err)
+	}
+
+	if srcStore == dstStore && objectKey.Mode != database.EncryptionSSEC {
+		if err := srcStore.Copy(ctx, srcKey, dstKey); err != nil {
+			return err
+		}
+	} else {
+		srcCtx, err := cfg.mediaObjectContext(ctx, srcStoreName, srcKey)
+		if err != nil {
+			return err
+		}
+		dstCtx := ctx
+		if objectKey.Mode == database.EncryptionSSEC {
+			sseKey, err := cfg.masterKeys.Derive(objectKey.MasterKeyID, sseCKeyInfo(dstStoreName, dstKey))
+			if err != nil {
+				return err
+			}
+			dstCtx = storage.WithSSECustomerKey(ctx, sseKey)
+		}
+		info, err := srcStore.Head(srcCtx, srcKey)
+		if err != nil {
+			return err
+		}
+
+		// 큰 영상은 multipart upload가 필요하므로 임시 파일로 받은 뒤 PutFile
+		tempPath, err := downloadObjectToTempFile(srcCtx, srcStore, srcKey, "", "tubely-archive_*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tempPath)
+		f, err := os.Open(tempPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := storage.PutFile(dstCtx, dstStore, dstKey, f, info.ContentType); err != nil {
+			return err
+		}
+	}
+
+	if objectKey.Mode == "" {
+		return nil
+	}
+	params := objectKey.CreateObjectKeyParams
+	params.Store = dstStoreName
+	params.Key = dstKey
+	return cfg.db.CreateObjectKey(params)
+}
+
+// 영상 blob 하나를 ARCHIVE_MODE 방식으로 보관하는 apiConfig method
+func (cfg *apiConfig) archiveBlob(ctx context.Context, blob database.Blob) error {
+	if blob.Store != storeMedia {
+		return fmt.Errorf("blob %s is not in the media store", blob.Hash)
+	}
+
+	switch cfg.archiveMode {
+	case archiveModeStorageClass:
+		mover, ok := cfg.store.(storage.StorageClassMover)
+		if !ok {
+			return errors.New("media store does not support storage classes")
+		}
+		objCtx, err := cfg.mediaObjectContext(ctx, blob.Store, blob.Key)
+		if err != nil {
+			return err
+		}
+		if err := mover.SetStorageClass(objCtx, blob.Key, cfg.archiveStorageClass); err != nil {
+			return err
+		}
+		_, err = cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{
+			Status:       database.ArchiveStatusArchived,
+			StorageClass: cfg.archiveStorageClass,
+		})
+		return err
+
+	case archiveModePrefix, archiveModeBackend:
+		dstStore, dstKey := storeMedia, cfg.archivePrefix+blob.Key
+		if cfg.archiveMode == archiveModeBackend {
+			dstStore, dstKey = storeArchive, blob.Key
+		}
+		if err := cfg.copyMediaObject(ctx, blob.Store, blob.Key, dstStore, dstKey); err != nil {
+			return err
+		}
+		queued, err := cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{
+			Status:       database.ArchiveStatusArchived,
+			ArchivedFrom: blob.Key,
+			Store:        dstStore,
+			Key:          dstKey,
+		})
+		if err != nil {
+			return err
+		}
+		cfg.attemptPendingDeletions(ctx, queued)
+		return nil
+	}
+	return fmt.Errorf("unknown archive mode %q", cfg.archiveMode)
+}
+
+// 복원 요청을 받은 영상 blob의 복원을 시작하는 apiConfig method
+// 바로 복원되면 빈 문자열, 복원이 끝나지 않았으면 ArchiveStatusRestoring 반환
+// @@@ prefix, backend 방식은 객체 전체를 복사해야 해서 큰 영상이면 요청이 timeout 날 수 있다
+// @@@ ==> restoring으로 표시만 하고 lifecycle worker를 깨워 복사하게 한다 (storage class 방식이 복원을 기다리는 것과 같은 흐름)
+func (cfg *apiConfig) requestBlobRestore(ctx context.Context, blob database.Blob) (string, error) {
+	if blob.ArchiveStatus == "" || blob.StorageClass != "" || blob.ArchivedFrom == "" {
+		return cfg.restoreBlob(ctx, blob)
+	}
+	if blob.ArchiveStatus != database.ArchiveStatusRestoring {
+		_, err := cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{
+			Status:       database.ArchiveStatusRestoring,
+			ArchivedFrom: blob.ArchivedFrom,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	cfg.wakeLifecycle()
+	return database.ArchiveStatusRestoring, nil
+}
+
+// 보관된 영상 blob을 다시 재생할 수 있게 복원하는 apiConfig method
+// 바로 복원되면 빈 문자열, 저장소가 객체를 꺼내는 중이면 ArchiveStatusRestoring 반환
+// prefix, backend 방식이면 여기서 객체를 복사하므로 요청 handler에서는 requestBlobRestore를 쓴다
+// @@@ 보관할 때의 방식은 blob에 기록되어 있으므로 ARCHIVE_MODE 설정이 바뀌어도 복원 가능
+func (cfg *apiConfig) restoreBlob(ctx context.Context, blob database.Blob) (string, error) {
+	if blob.ArchiveStatus == "" {
+		return "", nil
+	}
+
+	if blob.StorageClass != "" {
+		store, err := cfg.storeByName(blob.Store)
+		if err != nil {
+			return "", err
+		}
+		mover, ok := store.(storage.StorageClassMover)
+		if !ok {
+			return "", fmt.Errorf("store %q does not support storage classes", blob.Store)
+		}
+		objCtx, err := cfg.mediaObjectContext(ctx, blob.Store, blob.Key)
+		if err != nil {
+			return "", err
+		}
+
+		// GLACIER, DEEP_ARCHIVE는 임시 복원이 끝나야 기본 class로 복사할 수 있다
+		readable, err := mover.IsReadable(objCtx, blob.Key)
+		if err != nil {
+			return "", err
+		}
+		if !readable {
+			if err := mover.RequestRestore(objCtx, blob.Key, cfg.archiveRestoreDays); err != nil {
+				return "", err
+			}
+			_, err := cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{
+				Status:       database.ArchiveStatusRestoring,
+				StorageClass: blob.StorageClass,
+			})
+			return database.ArchiveStatusRestoring, err
+		}
+
+		if err := mover.SetStorageClass(objCtx, blob.Key, ""); err != nil {
+			return "", err
+		}
+		_, err = cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{})
+		return "", err
+	}
+
+	if blob.ArchivedFrom == "" {
+		// 옮기지 않고 상태만 바뀐 blob
+		_, err := cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{})
+		return "", err
+	}
+	if err := cfg.copyMediaObject(ctx, blob.Store, blob.Key, storeMedia, blob.ArchivedFrom); err != nil {
+		return "", err
+	}
+	queued, err := cfg.db.UpdateBlobArchive(blob.Hash, database.UpdateBlobArchiveParams{
+		Store: storeMedia,
+		Key:   blob.ArchivedFrom,
+	})
+	if err != nil {
+		return "", err
+	}
+	cfg.attemptPendingDeletions(ctx, queued)
+	return "", nil
+}
+
+// 삭제 예약된 객체들을 바로 한번 지워보는 apiConfig method
+// 실패해도 runPendingDeletions가 다시 시도한다
+func (cfg *apiConfig) attemptPendingDeletions(ctx context.Context, queued []database.PendingDeletion) {
+	for _, pd := range queued {
+		if err := cfg.attemptPendingDeletion(ctx, pd); err != nil {
+			log.Printf("couldn't delete %s/%s: %v", pd.Store, pd.Key, err)
+		}
+	}
+}
+
+// 보관, 복원 처리 결과 보고서
+type lifecycleReport struct {
+	DryRun   bool            `json:"dry_run"`
+	Mode     string          `json:"mode"`
+	Cutoff   time.Time       `json:"cutoff"` // 이 시각 이후로 재생되지 않은 영상을 보관
+	Archived []database.Blob `json:"archived"`
+	Restored []database.Blob `json:"restored"` // 임시 복원이 끝나 기본 class로 돌아온 blob
+	Errors   []string        `json:"errors"`
+}
+
+// 오래 재생되지 않은 영상 blob을 보관하고 복원 중이던 blob의 복원을 마무리하는 apiConfig method
+// dryRun이면 바꾸지 않고 보고서만 만든다
+func (cfg *apiConfig) applyLifecycle(ctx context.Context, after time.Duration, dryRun bool) (lifecycleReport, error) {
+	report := lifecycleReport{
+		DryRun:   dryRun,
+		Mode:     cfg.archiveMode,
+		Cutoff:   time.Now().UTC().Add(-after),
+		Archived: []database.Blob{},
+		Restored: []database.Blob{},
+		Errors:   []string{},
+	}
+
+	// 1. 복원 중인 blob 마무리
+	if !dryRun {
+		if err := cfg.finishRestores(ctx, &report); err != nil {
+			return report, err
+		}
+	}
+
+	// 2. 오래된 blob 보관
+	if cfg.archiveMode == "" {
+		return report, nil
+	}
+	stale, err := cfg.db.GetStaleVideoBlobs(report.Cutoff, 100)
+	if err != nil {
+		return report, fmt.Errorf("error getting stale blobs: %w", err)
+	}
+	for _, blob := range stale {
+		if blob.Store != storeMedia {
+			continue
+		}
+		if !dryRun {
+			if err := cfg.archiveBlob(ctx, blob); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("error archiving blob %s: %v", blob.Hash, err))
+				continue
+			}
+		}
+		report.Archived = append(report.Archived, blob)
+	}
+	return report, nil
+}
+
+// 복원 중인 blob들의 복원을 마무리하고 결과를 report에 더하는 apiConfig method
+// storage class 방식은 저장소가 꺼내기를 끝낸 것만, prefix, backend 방식은 원래 위치로 복사
+func (cfg *apiConfig) finishRestores(ctx context.Context, report *lifecycleReport) error {
+	restoring, err := cfg.db.GetBlobsByArchiveStatus(database.ArchiveStatusRestoring)
+	if err != nil {
+		return fmt.Errorf("error getting restoring blobs: %w", err)
+	}
+	for _, blob := range restoring {
+		status, err := cfg.restoreBlob(ctx, blob)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error restoring blob %s: %v", blob.Hash, err))
+			continue
+		}
+		if status == "" {
+			report.Restored = append(report.Restored, blob)
+		}
+	}
+	return nil
+}
+
+// 쉬고 있는 lifecycle worker를 깨운다 (이미 깨우는 중이면 아무것도 하지 않음)
+func (cfg *apiConfig) wakeLifecycle() {
+	select {
+	case cfg.lifecycleWake <- struct{}{}:
+	default:
+	}
+}
+
+// 복원 요청이 들어오면 복원을 마무리하고, interval마다 보관, 복원 처리를 실행하는 apiConfig method
+// interval이 0이면 주기적인 보관은 하지 않고 복원만 처리
+// main에서 goroutine으로 실행
+// @@@ 서버가 복사 중에 멈췄을 수 있으므로 시작할 때 복원 중인 blob을 한번 처리한다
+func (cfg *apiConfig) runLifecycle(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	cfg.runRestores(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cfg.lifecycleWake:
+			cfg.runRestores(ctx)
+			continue
+		case <-tick:
+		}
+
+		report, err := cfg.applyLifecycle(ctx, cfg.archiveAfter, false)
+		if err != nil {
+			log.Printf("error applying lifecycle: %v", err)
+			continue
+		}
+		log.Printf("lifecycle: archived %d blobs, restored %d blobs, %d errors",
+			len(report.Archived), len(report.Restored), len(report.Errors))
+	}
+}
+
+// 복원 중인 blob만 마무리하고 결과를 로그로 남기는 apiConfig method
+func (cfg *apiConfig) runRestores(ctx context.Context) {
+	report := lifecycleReport{Restored: []database.Blob{}, Errors: []string{}}
+	if err := cfg.finishRestores(ctx, &report); err != nil {
+		log.Printf("error finishing restores: %v", err)
+		return
+	}
+	for _, msg := range report.Errors {
+		log.Print(msg)
+	}
+	if len(report.Restored) > 0 {
+		log.Printf("lifecycle: restored %d blobs", len(report.Restored))
+	}
+}
+
+// POST /api/videos/{videoID}/restore handler : 보관된 영상 복원 요청 (소유자만)
+// 바로 복원되면 200, 저장소가 꺼내는 중이거나 원래 위치로 복사 중이면 202 (복원이 끝나면 archive_status가 빈 문자열이 된다)
+func (cfg *apiConfig) handlerVideoRestore(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	blob, err := cfg.db.GetVideoBlob(video.ID, database.BlobKindVideo)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video file", err)
+		return
+	}
+	if blob.Hash == "" {
+		respondWithError(w, http.StatusNotFound, "Video has not been uploaded", nil)
+		return
+	}
+
+	status, err := cfg.requestBlobRestore(r.Context(), blob)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	// 복원 직후 다시 보관되지 않도록
+	cfg.touchVideo(video)
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create signed url", err)
+		return
+	}
+
+	code := http.StatusOK
+	if status == database.ArchiveStatusRestoring {
+		code = http.StatusAccepted
+	}
+	respondWithJSON(w, code, signedVideo)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "sync"
+
+// key(업로드 id 등)별로 따로 잠글 수 있는 mutex
+// 같은 key에 대한 요청만 순서대로 처리하고 다른 key의 요청은 막지 않는다
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*keyedLock{}}
+}
+
+// key를 잠그고 잠금 해제 함수를 반환 ==> defer unlock() 형태로 사용
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.waiters++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		l.waiters--
+		// 기다리는 요청이 없으면 map에서 지워 메모리가 계속 늘어나지 않게 한다
+		if l.waiters == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -5,10 +5,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cfsign"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/envelope"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/keylayout"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -16,16 +22,51 @@ import (
 
 // .env의 변수들과 db client 담는 구조체
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Client         *s3.Client
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
+	db                  database.Client
+	jwtSecret           string
+	platform            string
+	filepathRoot        string
+	assetsRoot          string
+	storageBackend      string
+	store               storage.ObjectStore // 영상 파일 저장소 (STORAGE_BACKEND로 s3, local 중 선택)
+	assetStore          storage.ObjectStore // assetsRoot를 루트로 하는 로컬 저장소 (migrate-thumbnails 전에 올라간 썸네일)
+	s3Bucket            string
+	s3Region            string
+	s3CfDistribution    string
+	port                string
+	tusUploadDir        string              // tus 업로드 중인 파일을 저장하는 디렉토리
+	tusUploadExpiry     time.Duration       // 마지막 PATCH 후 이 시간이 지나면 tus 업로드 만료
+	tusLocks            *keyedMutex         // tus 업로드 id별 잠금
+	blobLocks           *keyedMutex         // blob 식별자별 잠금 (같은 내용을 동시에 올리지 않도록)
+	presignExpiry       time.Duration       // 직접 업로드용 pre-signed url 유효 기간
+	gcGracePeriod       time.Duration       // 이 시간보다 오래된 미참조 객체만 garbage collection
+	cfSigner            *cfsign.Signer      // cloud front signed url 서명 (nil이면 서명하지 않은 url 사용)
+	cfSignedExpiry      time.Duration       // cloud front signed url, signed cookie 유효 기간
+	cfCookieDomain      string              // signed cookie를 설정할 도메인 (cloud front 도메인과 같은 상위 도메인)
+	userQuotaBytes      int64               // 유저별 저장 용량 제한 (0이면 제한 없음)
+	userMaxVideos       int                 // 유저별 video 개수 제한 (0이면 제한 없음)
+	mediaEncryption     string              // 새로 올리는 영상의 암호화 방식 ("", sse-c, envelope)
+	masterKeys          *envelope.Keyring   // 영상 암호화에 쓰는 master key들 (MEDIA_MASTER_KEYS가 없으면 nil)
+	archiveMode         string              // 오래 재생되지 않은 영상 보관 방식 ("", storage-class, prefix, backend)
+	archiveStorageClass string              // storage-class 방식에서 옮길 S3 storage class
+	archivePrefix       string              // prefix 방식에서 보관 객체 key 앞에 붙이는 prefix
+	archiveStore        storage.ObjectStore // backend 방식의 보관 저장소
+	archiveAfter        time.Duration       // 이 기간 동안 재생되지 않은 영상 보관
+	archiveRestoreDays  int32               // GLACIER 등에서 임시 복원 요청할 때 유지 기간 (일)
+	videoKeyLayout      *keylayout.Template // 영상 객체 key template (VIDEO_KEY_TEMPLATE)
+	thumbnailKeyLayout  *keylayout.Template // 썸네일 객체 key template (THUMBNAIL_KEY_TEMPLATE)
+	hlsLadder           []hlsRendition      // hls, dash package로 인코딩할 화질들 (비어 있으면 package 만들지 않음)
+	hlsSegmentSeconds   int                 // hls, dash segment 길이 (초)
+	packageFormats      []string            // 만들 package 형식 (hls, dash)
+	spriteInterval      time.Duration       // seek bar 미리보기 sprite의 frame 간격 (0이면 만들지 않음)
+	spriteWidth         int                 // sprite 안의 frame 하나의 너비 (높이는 원본 비율대로)
+	videoUploadTypes    []string            // 업로드를 받는 영상 container 형식 (H.264/AAC mp4로 맞춰서 저장)
+	videoAutoRotate     bool                // 회전 정보가 있는 영상을 똑바로 돌려서 다시 인코딩할지
+	videoJobDir         string              // 처리 job이 끝날 때까지 업로드된 원본 파일을 두는 디렉토리
+	videoJobWake        chan struct{}       // 새 job이 들어오면 쉬고 있는 worker를 깨운다
+	lifecycleWake       chan struct{}       // 복원 요청이 들어오면 lifecycle worker를 깨운다
+	videoJobMaxAttempts int                 // 영상 처리 job 최대 시도 횟수
+	videoEvents         *videoEventHub      // 영상 처리 진행 상황 event (GET /api/videos/{videoID}/events)
 }
 
 // 썸네일 데이터와 데이터 타입을 담는 구조체
@@ -75,19 +116,10 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
-	}
-
-	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
-	}
-
-	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	// STORAGE_BACKEND는 영상 파일 저장소 종류 (s3 또는 local, 설정 안하면 s3)
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "s3"
 	}
 
 	port := os.Getenv("PORT")
@@ -95,40 +127,275 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
-	// @@@ AWS s3 Go SDK 설정 시작 @@@
+	// tus 업로드 파일 디렉토리 (설정 안하면 시스템 임시 디렉토리 아래)
+	tusUploadDir := os.Getenv("TUS_UPLOAD_DIR")
+	if tusUploadDir == "" {
+		tusUploadDir = filepath.Join(os.TempDir(), "tubely-tus")
+	}
+	if err := os.MkdirAll(tusUploadDir, 0755); err != nil {
+		log.Fatalf("Couldn't create tus upload directory: %v", err)
+	}
 
-	// s3Cfg는 설정을 담는 aws.Config 타입
-	s3Cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
-	// func config.LoadDefaultConfig(ctx context.Context, optFns ...func(*config.LoadOptions) error) (cfg aws.Config, err error)
-	// empty context인 context.Background() 입력
-	// 환경변수 s3Region을 담은 optFn을 만들어주는 config.WithRegion 함수 사용
-	// // optFns 에는 func(*config.LoadOptions) error 타입 입력 필요
-	// // ==> config.WithRegion 함수가 반환하는 LoadOptionsFunc 타입이 해당 함수 시그니쳐 만족
-	// // // type LoadOptionsFunc func(*LoadOptions) error
-	// // // LoadOptionsFunc is a type alias for LoadOptions functional option
+	// 처리 대기 중인 업로드 원본 파일 디렉토리 (설정 안하면 시스템 임시 디렉토리 아래)
+	// @@@ 서버를 다시 시작해도 남은 job을 이어서 처리하려면 재부팅 때 지워지지 않는 곳으로 설정해야 한다
+	// @@@ 다 받은 tus 업로드 파일을 rename으로 옮기므로 TUS_UPLOAD_DIR과 같은 파일 시스템이어야 한다
+	videoJobDir := os.Getenv("VIDEO_JOB_DIR")
+	if videoJobDir == "" {
+		videoJobDir = filepath.Join(os.TempDir(), "tubely-jobs")
+	}
+	if err := os.MkdirAll(videoJobDir, 0755); err != nil {
+		log.Fatalf("Couldn't create video job directory: %v", err)
+	}
 
+	// 예전 썸네일은 assetsRoot 디렉토리에 저장되어 있다 (새 썸네일은 cfg.store에 저장)
+	assetStore, err := storage.NewLocalStore(assetsRoot)
 	if err != nil {
-		log.Fatalf("Couldn't create s3 config: %v", err)
+		log.Fatalf("Couldn't create assets store: %v", err)
 	}
 
-	// s3 cfg를 이용해 s3 client 생성
-	s3Client := s3.NewFromConfig(s3Cfg)
-	// s3Client는 *s3.Client
+	// ARCHIVE_MODE는 오래 재생되지 않은 영상 보관 방식 (설정 안하면 보관하지 않음)
+	// storage-class : 같은 위치에서 S3 storage class만 변경 (s3 저장소만)
+	// prefix        : 같은 저장소의 ARCHIVE_PREFIX 아래로 이동
+	// backend       : 별도 저장소로 이동 (s3면 ARCHIVE_BUCKET, local이면 ARCHIVE_ROOT)
+	archiveMode := os.Getenv("ARCHIVE_MODE")
+	switch archiveMode {
+	case "", archiveModePrefix, archiveModeBackend:
+	case archiveModeStorageClass:
+		if storageBackend != "s3" {
+			log.Fatal("ARCHIVE_MODE=storage-class requires STORAGE_BACKEND=s3")
+		}
+	default:
+		log.Fatalf("Unknown ARCHIVE_MODE %q (must be storage-class, prefix or backend)", archiveMode)
+	}
+	archiveStorageClass := os.Getenv("ARCHIVE_STORAGE_CLASS")
+	if archiveStorageClass == "" {
+		archiveStorageClass = "GLACIER_IR"
+	}
+	archivePrefix := os.Getenv("ARCHIVE_PREFIX")
+	if archivePrefix == "" {
+		archivePrefix = "archive/"
+	}
+
+	var store storage.ObjectStore
+	var archiveStore storage.ObjectStore
+	var s3Bucket, s3Region, s3CfDistribution string
+	var cfSigner *cfsign.Signer
+
+	switch storageBackend {
+	case "local":
+		// local 저장소는 영상도 assetsRoot에 저장하고 /assets 파일 서버로 제공
+		store = assetStore
+
+		if archiveMode == archiveModeBackend {
+			archiveRoot := os.Getenv("ARCHIVE_ROOT")
+			if archiveRoot == "" {
+				log.Fatal("ARCHIVE_MODE=backend requires ARCHIVE_ROOT with STORAGE_BACKEND=local")
+			}
+			archiveStore, err = storage.NewLocalStore(archiveRoot)
+			if err != nil {
+				log.Fatalf("Couldn't create archive store: %v", err)
+			}
+		}
+	case "s3":
+		s3Bucket = os.Getenv("S3_BUCKET")
+		if s3Bucket == "" {
+			log.Fatal("S3_BUCKET environment variable is not set")
+		}
+
+		s3Region = os.Getenv("S3_REGION")
+		if s3Region == "" {
+			log.Fatal("S3_REGION environment variable is not set")
+		}
+
+		s3CfDistribution = os.Getenv("S3_CF_DISTRO")
+		if s3CfDistribution == "" {
+			log.Fatal("S3_CF_DISTRO environment variable is not set")
+		}
+
+		// cloud front signed url 설정 (key pair id와 private key 둘 다 있을 때만 사용)
+		cfKeyPairID := os.Getenv("CF_KEY_PAIR_ID")
+		cfPrivateKeyPath := os.Getenv("CF_PRIVATE_KEY_PATH")
+		if (cfKeyPairID == "") != (cfPrivateKeyPath == "") {
+			log.Fatal("CF_KEY_PAIR_ID and CF_PRIVATE_KEY_PATH must be set together")
+		}
+		if cfKeyPairID != "" {
+			cfPrivateKey, err := cfsign.LoadPrivateKey(cfPrivateKeyPath)
+			if err != nil {
+				log.Fatalf("Couldn't load cloud front private key: %v", err)
+			}
+			cfSigner = cfsign.NewSigner(cfKeyPairID, cfPrivateKey)
+		}
+
+		// @@@ AWS s3 Go SDK 설정 시작 @@@
+
+		// s3Cfg는 설정을 담는 aws.Config 타입
+		s3Cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+		// func config.LoadDefaultConfig(ctx context.Context, optFns ...func(*config.LoadOptions) error) (cfg aws.Config, err error)
+		// empty context인 context.Background() 입력
+		// 환경변수 s3Region을 담은 optFn을 만들어주는 config.WithRegion 함수 사용
+		// // optFns 에는 func(*config.LoadOptions) error 타입 입력 필요
+		// // ==> config.WithRegion 함수가 반환하는 LoadOptionsFunc 타입이 해당 함수 시그니쳐 만족
+		// // // type LoadOptionsFunc func(*LoadOptions) error
+		// // // LoadOptionsFunc is a type alias for LoadOptions functional option
+
+		if err != nil {
+			log.Fatalf("Couldn't create s3 config: %v", err)
+		}
+
+		// 큰 영상은 multipart upload로 올리기 위한 설정
+		multipart := getMultipartOptions()
+
+		// s3 cfg를 이용해 s3 client 생성하고 ObjectStore 구현체로 감싸기
+		s3Client := s3.NewFromConfig(s3Cfg)
+		store = storage.NewS3Store(s3Client, s3Bucket, multipart)
+
+		// 보관용 버킷은 같은 리전, 같은 자격 증명 사용
+		if archiveMode == archiveModeBackend {
+			archiveBucket := os.Getenv("ARCHIVE_BUCKET")
+			if archiveBucket == "" {
+				log.Fatal("ARCHIVE_MODE=backend requires ARCHIVE_BUCKET with STORAGE_BACKEND=s3")
+			}
+			archiveStore = storage.NewS3Store(s3Client, archiveBucket, multipart)
+		}
+
+		// @@@ AWS s3 Go SDK 설정 종료 @@@
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q (must be s3 or local)", storageBackend)
+	}
 
-	// @@@ AWS s3 Go SDK 설정 종료 @@@
+	// 저장소에 올리는 영상 암호화 설정
+	// @@@ MEDIA_MASTER_KEYS는 "<id>:<base64 32byte key>,..." 형태, 새로 암호화할 때는 MEDIA_MASTER_KEY_ID의 key 사용
+	// @@@ 이미 암호화된 객체를 읽으려면 이전 master key도 남겨둬야 한다 (rotate-master-key 명령어로 교체 후 제거)
+	var masterKeys *envelope.Keyring
+	if spec := os.Getenv("MEDIA_MASTER_KEYS"); spec != "" {
+		masterKeys, err = envelope.ParseKeyring(spec, os.Getenv("MEDIA_MASTER_KEY_ID"))
+		if err != nil {
+			log.Fatalf("Couldn't load MEDIA_MASTER_KEYS: %v", err)
+		}
+	}
+	mediaEncryption := os.Getenv("MEDIA_ENCRYPTION")
+	switch mediaEncryption {
+	case "":
+	case database.EncryptionSSEC, database.EncryptionEnvelope:
+		if masterKeys == nil {
+			log.Fatalf("MEDIA_ENCRYPTION=%s requires MEDIA_MASTER_KEYS", mediaEncryption)
+		}
+		if mediaEncryption == database.EncryptionSSEC && storageBackend != "s3" {
+			log.Fatal("MEDIA_ENCRYPTION=sse-c requires STORAGE_BACKEND=s3")
+		}
+	default:
+		log.Fatalf("Unknown MEDIA_ENCRYPTION %q (must be sse-c or envelope)", mediaEncryption)
+	}
+
+	// hls, dash package 화질 설정 (ex: 1080:5000k:192k,720:2800k,480:1400k,360:800k)
+	// @@@ PACKAGE_FORMATS(기본값 hls)로 만들 형식 선택 ==> hls,dash면 segment를 공유한다
+	var hlsLadder []hlsRendition
+	var packageFormats []string
+	if spec := os.Getenv("HLS_LADDER"); spec != "" {
+		hlsLadder, err = parseHLSLadder(spec)
+		if err != nil {
+			log.Fatalf("HLS_LADDER environment variable is invalid: %v", err)
+		}
+		formats := os.Getenv("PACKAGE_FORMATS")
+		if formats == "" {
+			formats = database.PackageFormatHLS
+		}
+		packageFormats, err = parsePackageFormats(formats)
+		if err != nil {
+			log.Fatalf("PACKAGE_FORMATS environment variable is invalid: %v", err)
+		}
+		// @@@ segment는 cdn이 그대로 전달해야 하므로 암호화하지 않는다 ==> 암호화 설정과 같이 쓸 수 없다
+		if mediaEncryption != "" {
+			log.Fatal("HLS_LADDER can't be used with MEDIA_ENCRYPTION (package segments would be stored unencrypted)")
+		}
+	}
+
+	// seek bar 미리보기 sprite 설정 (SPRITE_INTERVAL이 0이면 만들지 않음)
+	// @@@ sprite도 segment처럼 암호화하지 않으므로 암호화 설정이 있으면 기본값은 만들지 않음
+	defaultSpriteInterval := 10 * time.Second
+	if mediaEncryption != "" {
+		defaultSpriteInterval = 0
+	}
+	spriteInterval := getEnvDuration("SPRITE_INTERVAL", defaultSpriteInterval)
+	if spriteInterval < 0 {
+		log.Fatal("SPRITE_INTERVAL must not be negative")
+	}
+	if spriteInterval > 0 && mediaEncryption != "" {
+		log.Fatal("SPRITE_INTERVAL can't be used with MEDIA_ENCRYPTION (sprites would be stored unencrypted)")
+	}
+
+	// 업로드를 받는 영상 형식 (ex: video/mp4,video/quicktime)
+	// @@@ mp4가 아닌 형식이나 H.264/AAC가 아닌 영상은 처리 job에서 mp4로 다시 인코딩한다
+	uploadTypes := os.Getenv("VIDEO_UPLOAD_TYPES")
+	if uploadTypes == "" {
+		uploadTypes = defaultVideoUploadTypes
+	}
+	videoUploadTypes, err := parseVideoUploadTypes(uploadTypes)
+	if err != nil {
+		log.Fatalf("VIDEO_UPLOAD_TYPES environment variable is invalid: %v", err)
+	}
+
+	// 저장소 객체 key layout (시작할 때 template을 검사해서 잘못되어 있으면 종료)
+	// @@@ staging 업로드(uploads/)와 prefix 방식의 보관 객체 key와 겹치면 안 된다
+	reservedPrefixes := []string{"uploads/", "packages/"}
+	if archiveMode == archiveModePrefix {
+		reservedPrefixes = append(reservedPrefixes, archivePrefix)
+	}
+	videoKeyLayout := getEnvKeyTemplate("VIDEO_KEY_TEMPLATE", defaultVideoKeyTemplate, reservedPrefixes)
+	thumbnailKeyLayout := getEnvKeyTemplate("THUMBNAIL_KEY_TEMPLATE", defaultThumbnailKeyTemplate, reservedPrefixes,
+		keylayout.FieldUserID, keylayout.FieldVideoID, keylayout.FieldVariant, keylayout.FieldExt, keylayout.FieldHash)
+	// @@@ SSE-C key는 저장소 객체 key로 유도하므로 template에 {video_id}가 있어야 blob(==> key)이 video마다 따로 생긴다
+	if mediaEncryption == database.EncryptionSSEC && !videoKeyLayout.Uses(keylayout.FieldVideoID) {
+		log.Fatalf("MEDIA_ENCRYPTION=sse-c requires {video_id} in VIDEO_KEY_TEMPLATE (got %q) so that keys are derived per video", videoKeyLayout)
+	}
 
 	// 불러온 환경변수들, db 를 apiConfig 구조체에 저장
 	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Client:         s3Client,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		db:                  db,
+		jwtSecret:           jwtSecret,
+		platform:            platform,
+		filepathRoot:        filepathRoot,
+		assetsRoot:          assetsRoot,
+		storageBackend:      storageBackend,
+		store:               store,
+		assetStore:          assetStore,
+		s3Bucket:            s3Bucket,
+		s3Region:            s3Region,
+		s3CfDistribution:    s3CfDistribution,
+		port:                port,
+		tusUploadDir:        tusUploadDir,
+		tusUploadExpiry:     getEnvDuration("TUS_UPLOAD_EXPIRY", 24*time.Hour),
+		tusLocks:            newKeyedMutex(),
+		blobLocks:           newKeyedMutex(),
+		presignExpiry:       getEnvDuration("S3_PRESIGN_EXPIRY", time.Hour),
+		gcGracePeriod:       getEnvDuration("GC_GRACE_PERIOD", 24*time.Hour),
+		cfSigner:            cfSigner,
+		cfSignedExpiry:      getEnvDuration("CF_SIGNED_URL_EXPIRY", time.Hour),
+		cfCookieDomain:      os.Getenv("CF_COOKIE_DOMAIN"),
+		userQuotaBytes:      int64(getEnvInt("USER_QUOTA_MB", 0)) << 20,
+		userMaxVideos:       getEnvInt("USER_MAX_VIDEOS", 0),
+		mediaEncryption:     mediaEncryption,
+		masterKeys:          masterKeys,
+		archiveMode:         archiveMode,
+		archiveStorageClass: archiveStorageClass,
+		archivePrefix:       archivePrefix,
+		archiveStore:        archiveStore,
+		archiveAfter:        getEnvDuration("ARCHIVE_AFTER", 90*24*time.Hour),
+		archiveRestoreDays:  int32(getEnvInt("ARCHIVE_RESTORE_DAYS", 7)),
+		videoKeyLayout:      videoKeyLayout,
+		thumbnailKeyLayout:  thumbnailKeyLayout,
+		hlsLadder:           hlsLadder,
+		hlsSegmentSeconds:   getEnvInt("HLS_SEGMENT_SECONDS", 6),
+		packageFormats:      packageFormats,
+		spriteInterval:      spriteInterval,
+		spriteWidth:         max(getEnvInt("SPRITE_WIDTH", 160), 16),
+		videoUploadTypes:    videoUploadTypes,
+		videoAutoRotate:     getEnvBool("VIDEO_AUTO_ROTATE", false),
+		videoJobDir:         videoJobDir,
+		videoJobWake:        make(chan struct{}, 1),
+		lifecycleWake:       make(chan struct{}, 1),
+		videoJobMaxAttempts: max(getEnvInt("VIDEO_JOB_MAX_ATTEMPTS", 5), 1),
+		videoEvents:         newVideoEventHub(),
 	}
 
 	// cfg.ensureAssetsDir method는 assets_root 경로 디렉토리가 있는지 확인하고 없으면 디렉토리를 생성하는 함수
@@ -136,6 +403,28 @@ func main() {
 	if err != nil {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
+
+	// go run . <command> 처럼 인자가 있으면 서버 대신 관리자 명령어 실행 (commands.go)
+	if len(os.Args) > 1 {
+		if err := runCommand(&cfg, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// 업로드된 영상을 처리하는 worker들 (VIDEO_WORKERS개, 재시도 job은 10초마다 확인)
+	cfg.startVideoWorkers(context.Background(), max(getEnvInt("VIDEO_WORKERS", 2), 1), 10*time.Second)
+	// 만료된 tus 업로드 정리를 백그라운드에서 1시간마다 실행
+	go cfg.cleanupExpiredTusUploads(context.Background(), time.Hour)
+	// 영상 삭제 후 저장소에서 지우지 못한 객체들을 백그라운드에서 1분마다 재시도
+	go cfg.runPendingDeletions(context.Background(), time.Minute)
+	// GC_INTERVAL이 설정되어 있으면 참조되지 않는 저장소 객체를 주기적으로 정리
+	if gcInterval := getEnvDuration("GC_INTERVAL", 0); gcInterval > 0 {
+		go cfg.runGarbageCollector(context.Background(), gcInterval, cfg.gcGracePeriod)
+	}
+	// 복원 요청이 들어오면 백그라운드에서 복원을 마무리
+	// ARCHIVE_INTERVAL이 설정되어 있으면 오래된 영상 보관과 복원 완료 처리도 주기적으로 실행
+	go cfg.runLifecycle(context.Background(), getEnvDuration("ARCHIVE_INTERVAL", 0))
 	// @@@ 환경변수, db 초기화 섹션 종료 @@@
 
 	// @@@ Routing 섹션 시작 @@@
@@ -164,7 +453,8 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	// mux.Handle("/assets/", cacheMiddleware(assetsHandler))
 	// cacheMiddleware는 response에 캐쉬 관련 헤더를 설정하도록 하는 middleware
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	// 썸네일과 public video의 객체만 인증 없이 내려준다 (assetAccessMiddleware)
+	mux.Handle("/assets/", noCacheMiddleware(cfg.assetAccessMiddleware(assetsHandler)))
 	// 리스폰스의 Cache-Control 헤더를 no-store로 설정하는 middleware
 
 	// api 계열 엔드포인트 handler 등록
@@ -173,12 +463,31 @@ func main() {
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("GET /api/users/me/usage", cfg.handlerUserUsage)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
+	mux.HandleFunc("POST /api/videos/{videoID}/thumbnail/from_frame", cfg.handlerThumbnailFromFrame)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	// 버킷 직접 업로드 (pre-signed url 발급, 업로드 완료 처리)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/presign", cfg.handlerPresignVideoUpload)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/complete", cfg.handlerCompleteVideoUpload)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/abort", cfg.handlerAbortVideoUpload)
+
+	// tus 1.0 이어받기 업로드 엔드포인트
+	mux.HandleFunc("OPTIONS /api/tus", cfg.handlerTusOptions)
+	mux.HandleFunc("POST /api/tus", cfg.handlerTusCreate)
+	mux.HandleFunc("HEAD /api/tus/{uploadID}", cfg.handlerTusHead)
+	mux.HandleFunc("PATCH /api/tus/{uploadID}", cfg.handlerTusPatch)
+	mux.HandleFunc("DELETE /api/tus/{uploadID}", cfg.handlerTusDelete)
+
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/stream", cfg.handlerVideoStream)
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents)
+	mux.HandleFunc("PUT /api/videos/{videoID}/visibility", cfg.handlerVideoVisibilityUpdate)
+	mux.HandleFunc("POST /api/videos/{videoID}/cookies", cfg.handlerVideoCookies)
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore)
 	// mux.HandleFunc("GET /api/thumbnails/{videoID}", cfg.handlerThumbnailGet) // @@@ base64 도입 후 GET /api/thumbnails/{videoID} 삭제
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
 
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/envelope"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ 기밀 영상이 버킷에 평문으로 남지 않도록 MEDIA_ENCRYPTION 설정에 따라 영상 객체를 암호화해서 저장
+// @@@ sse-c    : S3가 암호화, 요청마다 보내는 key는 master key와 객체 key로 HKDF 유도 (db에는 key를 저장하지 않음)
+// @@@ envelope : 서버가 chunk 단위 AES-GCM으로 암호화해서 올림, 랜덤 data key는 master key로 감싸서 object_keys에 저장
+// @@@ 암호화된 객체는 cdn이나 presigned url로 바로 볼 수 없으므로 항상 stream 엔드포인트가 복호화해서 중계한다
+// @@@ 같은 내용의 영상은 blob 하나를 공유하므로 key는 video가 아니라 저장소 객체(blob)마다 하나
+// @@@ sse-c는 VIDEO_KEY_TEMPLATE에 {video_id}가 있어야 시작할 수 있다 ==> blob이 video 범위로만 공유되어 유도한 key도 video마다 다르다
+// @@@ (envelope의 data key는 랜덤이라 template과 상관없음)
+
+// SSE-C key 유도에 쓰는 info 문자열
+// @@@ 객체 key에 video id가 들어 있으므로 video별 key가 된다 (key를 옮기면 다시 암호화해야 한다)
+func sseCKeyInfo(storeName, key string) string {
+	return "sse-c:" + storeName + "/" + key
+}
+
+// 파일을 설정된 방식으로 암호화해서 storeName 저장소의 key 위치에 올리는 apiConfig method
+// 암호화하지 않는 설정이면 storage.PutFile과 같다
+func (cfg *apiConfig) putMediaObject(ctx context.Context, storeName, key string, f *os.File, contentType string) error {
+	store, err := cfg.storeByName(storeName)
+	if err != nil {
+		return err
+	}
+	if cfg.mediaEncryption == "" {
+		return storage.PutFile(ctx, store, key, f, contentType)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error stating %s: %w", f.Name(), err)
+	}
+	params := database.CreateObjectKeyParams{
+		Store:       storeName,
+		Key:         key,
+		Mode:        cfg.mediaEncryption,
+		MasterKeyID: cfg.masterKeys.ActiveID(),
+		PlainSize:   stat.Size(),
+	}
+
+	switch cfg.mediaEncryption {
+	case database.EncryptionSSEC:
+		sseKey, err := cfg.masterKeys.Derive(params.MasterKeyID, sseCKeyInfo(storeName, key))
+		if err != nil {
+			return err
+		}
+		err = storage.PutFile(storage.WithSSECustomerKey(ctx, sseKey), store, key, f, contentType)
+		if err != nil {
+			return err
+		}
+
+	case database.EncryptionEnvelope:
+		dataKey, err := envelope.NewDataKey()
+		if err != nil {
+			return err
+		}
+		params.WrappedKey, err = cfg.masterKeys.Wrap(params.MasterKeyID, dataKey)
+		if err != nil {
+			return err
+		}
+		if err := putEnvelopeEncrypted(ctx, store, key, f, dataKey); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.db.CreateObjectKey(params); err != nil {
+		// key 기록 없이 남은 객체는 아무도 읽을 수 없으므로 지운다
+		if delErr := store.Delete(ctx, key); delErr != nil {
+			log.Printf("error deleting unreadable object %s/%s: %v", storeName, key, delErr)
+		}
+		return fmt.Errorf("error saving encryption key record: %w", err)
+	}
+	return nil
+}
+
+// 파일을 envelope 형식으로 암호화한 임시 파일을 만들어 올리는 함수
+// @@@ multipart upload는 io.ReaderAt이 필요하므로 암호화 결과를 임시 파일에 쓴 뒤 PutFile 사용
+func putEnvelopeEncrypted(ctx context.Context, store storage.ObjectStore, key string, f *os.File, dataKey []byte) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking %s: %w", f.Name(), err)
+	}
+
+	encrypted, err := os.CreateTemp("", "tubely-encrypted-*.bin")
+	if err != nil {
+		return fmt.Errorf("error creating encrypted temp file: %w", err)
+	}
+	defer os.Remove(encrypted.Name())
+	defer encrypted.Close()
+
+	if _, err := envelope.Encrypt(encrypted, f, dataKey, envelope.DefaultChunkSize); err != nil {
+		return fmt.Errorf("error encrypting %s: %w", f.Name(), err)
+	}
+	// 암호문이므로 video/mp4가 아닌 octet-stream으로 저장 (복호화해서 중계할 때 key의 확장자로 다시 정한다)
+	return storage.PutFile(ctx, store, key, encrypted, "application/octet-stream")
+}
+
+// 저장소 객체를 복호화된 평문 기준으로 Read, Seek 할 수 있게 여는 apiConfig method
+// 반환하는 ObjectInfo의 Size, ContentType은 평문 기준
+func (cfg *apiConfig) openMediaObject(ctx context.Context, storeName, key string) (io.ReadSeekCloser, storage.ObjectInfo, error) {
+	store, err := cfg.storeByName(storeName)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	objectKey, err := cfg.db.GetObjectKey(storeName, key)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, fmt.Errorf("error getting encryption key record: %w", err)
+	}
+	if objectKey.Mode != "" && cfg.masterKeys == nil {
+		return nil, storage.ObjectInfo{}, errors.New("object is encrypted but MEDIA_MASTER_KEYS is not set")
+	}
+
+	switch objectKey.Mode {
+	case "":
+		info, err := store.Head(ctx, key)
+		if err != nil {
+			return nil, storage.ObjectInfo{}, err
+		}
+		return storage.NewObjectReader(ctx, store, key, info.Size), info, nil
+
+	case database.EncryptionSSEC:
+		sseKey, err := cfg.masterKeys.Derive(objectKey.MasterKeyID, sseCKeyInfo(storeName, key))
+		if err != nil {
+			return nil, storage.ObjectInfo{}, err
+		}
+		ctx = storage.WithSSECustomerKey(ctx, sseKey)
+		info, err := store.Head(ctx, key)
+		if err != nil {
+			return nil, storage.ObjectInfo{}, err
+		}
+		return storage.NewObjectReader(ctx, store, key, info.Size), info, nil
+
+	case database.EncryptionEnvelope:
+		dataKey, err := cfg.masterKeys.Unwrap(objectKey.MasterKeyID, objectKey.WrappedKey)
+		if err != nil {
+			return nil, storage.ObjectInfo{}, err
+		}
+		info, err := store.Head(ctx, key)
+		if err != nil {
+			return nil, storage.ObjectInfo{}, err
+		}
+		open := func(offset, length int64) (io.ReadCloser, error) {
+			return store.GetRange(ctx, key, offset, length)
+		}
+		reader, err := envelope.NewReader(open, info.Size, dataKey)
+		if err != nil {
+			return nil, storage.ObjectInfo{}, fmt.Errorf("error opening encrypted object %s: %w", key, err)
+		}
+		info.Size = reader.Size()
+		info.ContentType = mime.TypeByExtension(path.Ext(key))
+		if info.ContentType == "" {
+			// key template에 {ext}가 없으면 blob에 기록된 content type 사용
+			blob, err := cfg.db.GetBlobByKey(storeName, key)
+			if err != nil {
+				reader.Close()
+				return nil, storage.ObjectInfo{}, err
+			}
+			info.ContentType = blob.ContentType
+		}
+		return reader, info, nil
+	}
+	return nil, storage.ObjectInfo{}, fmt.Errorf("unknown encryption mode %q", objectKey.Mode)
+}
+
+// db에 저장된 url이 암호화된 객체를 가리키는지 확인하는 apiConfig method
+func (cfg *apiConfig) isEncryptedURL(rawURL string) (bool, error) {
+	storeName, key, ok := cfg.objectRefFromURL(rawURL)
+	if !ok {
+		return false, nil
+	}
+	objectKey, err := cfg.db.GetObjectKey(storeName, key)
+	if err != nil {
+		return false, err
+	}
+	return objectKey.Mode != "", nil
+}
+
+// rotate-master-key 명령어 결과
+type masterKeyRotationReport struct {
+	DryRun      bool                 `json:"dry_run"`
+	MasterKeyID string               `json:"master_key_id"` // 교체 후 사용하는 master key
+	Rotated     []database.ObjectKey `json:"rotated"`
+	Failed      []rotationFailure    `json:"failed"`
+}
+
+type rotationFailure struct {
+	Store string `json:"store"`
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// active가 아닌 master key로 암호화된 객체들을 active master key로 바꾸는 apiConfig method
+// envelope : data key만 다시 감싸서 db 갱신 (객체는 그대로)
+// sse-c    : 저장소에서 이전 유도 key ==> 새 유도 key로 객체를 복사해 다시 암호화한 후 db 갱신
+// @@@ 객체 하나가 실패해도 나머지는 계속 진행하고, 실패한 객체는 이전 master key 기록이 남아 다시 실행하면 재시도된다
+func (cfg *apiConfig) rotateMasterKey(ctx context.Context, dryRun bool) (masterKeyRotationReport, error) {
+	if cfg.masterKeys == nil {
+		return masterKeyRotationReport{}, errors.New("MEDIA_MASTER_KEYS is not set")
+	}
+	activeID := cfg.masterKeys.ActiveID()
+	report := masterKeyRotationReport{
+		DryRun:      dryRun,
+		MasterKeyID: activeID,
+		Rotated:     []database.ObjectKey{},
+		Failed:      []rotationFailure{},
+	}
+
+	objectKeys, err := cfg.db.GetObjectKeysNotUsingMaster(activeID)
+	if err != nil {
+		return report, err
+	}
+
+	for _, objectKey := range objectKeys {
+		if !dryRun {
+			if err := cfg.rotateObjectKey(ctx, objectKey, activeID); err != nil {
+				report.Failed = append(report.Failed, rotationFailure{
+					Store: objectKey.Store,
+					Key:   objectKey.Key,
+					Error: err.Error(),
+				})
+				continue
+			}
+		}
+		report.Rotated = append(report.Rotated, objectKey)
+	}
+	return report, nil
+}
+
+func (cfg *apiConfig) rotateObjectKey(ctx context.Context, objectKey database.ObjectKey, activeID string) error {
+	switch objectKey.Mode {
+	case database.EncryptionEnvelope:
+		dataKey, err := cfg.masterKeys.Unwrap(objectKey.MasterKeyID, objectKey.WrappedKey)
+		if err != nil {
+			return err
+		}
+		wrapped, err := cfg.masterKeys.Wrap(activeID, dataKey)
+		if err != nil {
+			return err
+		}
+		return cfg.db.UpdateObjectKeyMaster(objectKey.Store, objectKey.Key, activeID, wrapped)
+
+	case database.EncryptionSSEC:
+		store, err := cfg.storeByName(objectKey.Store)
+		if err != nil {
+			return err
+		}
+		rekeyer, ok := store.(storage.SSECRekeyer)
+		if !ok {
+			return fmt.Errorf("store %q does not support SSE-C", objectKey.Store)
+		}
+		info := sseCKeyInfo(objectKey.Store, objectKey.Key)
+		oldKey, err := cfg.masterKeys.Derive(objectKey.MasterKeyID, info)
+		if err != nil {
+			return err
+		}
+		newKey, err := cfg.masterKeys.Derive(activeID, info)
+		if err != nil {
+			return err
+		}
+		if err := rekeyer.RekeySSEC(ctx, objectKey.Key, oldKey, newKey); err != nil {
+			// 이미 삭제된 객체면 기록만 정리
+			if errors.Is(err, storage.ErrNotFound) {
+				return cfg.db.DeleteObjectKey(objectKey.Store, objectKey.Key)
+			}
+			return err
+		}
+		// @@@ 객체를 다시 암호화한 뒤 db 갱신이 실패하면 기록과 객체의 key가 달라지므로 에러를 크게 남긴다
+		if err := cfg.db.UpdateObjectKeyMaster(objectKey.Store, objectKey.Key, activeID, nil); err != nil {
+			return fmt.Errorf("object was re-encrypted with %q but the record still says %q: %w", activeID, objectKey.MasterKeyID, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown encryption mode %q", objectKey.Mode)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// pending_deletions 테이블의 store 컬럼에 저장되는 저장소 이름
+const (
+	storeMedia   = "media"   // cfg.store
+	storeAssets  = "assets"  // cfg.assetStore
+	storeArchive = "archive" // cfg.archiveStore
+)
+
+// 저장소 이름으로 저장소를 찾는 apiConfig method
+func (cfg apiConfig) storeByName(name string) (storage.ObjectStore, error) {
+	switch name {
+	case storeMedia:
+		return cfg.store, nil
+	case storeAssets:
+		return cfg.assetStore, nil
+	case storeArchive:
+		if cfg.archiveStore != nil {
+			return cfg.archiveStore, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown store %q", name)
+}
+
+// 저장소 이름과 key로 db에 저장할 url을 만드는 apiConfig method
+func (cfg apiConfig) objectURL(storeName, key string) string {
+	if storeName == storeAssets {
+		return cfg.getAssetURL(key)
+	}
+	return cfg.getStoredObjectURL(key)
+}
+
+// db에 저장된 thumbnail_url, video_url을 (저장소 이름, key)로 되돌리는 apiConfig method
+// getStoredObjectURL, getAssetURL로 만든 url이 아니면 false 반환
+func (cfg apiConfig) objectRefFromURL(url string) (storeName, key string, ok bool) {
+	if cfg.storageBackend != "local" {
+		if key, found := strings.CutPrefix(url, cfg.getCFURL("")); found && key != "" {
+			return storeMedia, key, true
+		}
+	}
+	if key, found := strings.CutPrefix(url, cfg.getAssetURL("")); found && key != "" {
+		// local 저장소는 cfg.store와 cfg.assetStore가 같은 디렉토리이므로 영상과 썸네일 모두 media로 본다
+		// @@@ blob의 store 이름과 같아야 IsBlobKey 확인이 맞게 동작한다
+		if cfg.storageBackend == "local" {
+			return storeMedia, key, true
+		}
+		return storeAssets, key, true
+	}
+	return "", "", false
+}
+
+// video가 참조하는 저장소 객체들의 삭제 예약 목록을 만드는 apiConfig method
+func (cfg apiConfig) videoObjects(video database.Video) []database.CreatePendingDeletionParams {
+	objects := []database.CreatePendingDeletionParams{}
+	for _, url := range []*string{video.VideoURL, video.ThumbnailURL} {
+		if url == nil {
+			continue
+		}
+		storeName, key, ok := cfg.objectRefFromURL(*url)
+		if !ok {
+			log.Printf("video %s references an unknown url %s, skipping", video.ID, *url)
+			continue
+		}
+		objects = append(objects, database.CreatePendingDeletionParams{
+			Store:   storeName,
+			Key:     key,
+			VideoID: video.ID,
+		})
+	}
+	return objects
+}
+
+// 삭제 예약 하나를 실행하는 apiConfig method
+// 성공하면 예약을 지우고, 실패하면 backoff 시간 뒤에 다시 시도하도록 기록한 후 에러 반환
+func (cfg apiConfig) attemptPendingDeletion(ctx context.Context, pd database.PendingDeletion) error {
+	// 삭제 예약 후 같은 내용이 다시 업로드되어 blob으로 쓰이고 있으면 지우지 않고 예약만 제거
+	inUse, err := cfg.db.IsBlobKey(pd.Store, pd.Key)
+	if err == nil && inUse {
+		return cfg.db.DeletePendingDeletion(pd.ID)
+	}
+	// 다시 만든 package가 같은 key를 쓰는 경우도 마찬가지
+	inUse, err = cfg.db.IsPackageKey(pd.Store, pd.Key)
+	if err == nil && inUse {
+		return cfg.db.DeletePendingDeletion(pd.ID)
+	}
+
+	store, err := cfg.storeByName(pd.Store)
+	if err == nil {
+		err = store.Delete(ctx, pd.Key)
+	}
+	if err != nil {
+		// 1분, 2분, 4분, ... 최대 6시간 간격으로 재시도
+		backoff := min(time.Minute<<min(pd.Attempts, 10), 6*time.Hour)
+		if markErr := cfg.db.MarkPendingDeletionFailed(pd.ID, err.Error(), time.Now().UTC().Add(backoff)); markErr != nil {
+			log.Printf("error recording failed deletion of %s/%s: %v", pd.Store, pd.Key, markErr)
+		}
+		return err
+	}
+	// 암호화된 객체였으면 key 기록도 필요 없어진다
+	if err := cfg.db.DeleteObjectKey(pd.Store, pd.Key); err != nil {
+		log.Printf("error deleting encryption key record of %s/%s: %v", pd.Store, pd.Key, err)
+	}
+	return cfg.db.DeletePendingDeletion(pd.ID)
+}
+
+// 재시도 시간이 된 삭제 예약들을 interval마다 처리하는 apiConfig method
+// main에서 goroutine으로 실행
+func (cfg apiConfig) runPendingDeletions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deletions, err := cfg.db.GetDuePendingDeletions(time.Now().UTC(), 100)
+		if err != nil {
+			log.Printf("error getting pending deletions: %v", err)
+		}
+		for _, pd := range deletions {
+			if err := cfg.attemptPendingDeletion(ctx, pd); err != nil {
+				log.Printf("error deleting %s/%s (attempt %d): %v", pd.Store, pd.Key, pd.Attempts+1, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
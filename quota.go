@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// @@@ 유저 한명이 1GB 영상을 계속 올려 버킷을 채우지 못하도록 유저별 용량(USER_QUOTA_MB), video 개수(USER_MAX_VIDEOS) 제한
+// @@@ 사용량은 user_usage 테이블에 blob 연결, 교체, video 삭제 transaction 안에서 같이 갱신된다 (internal/database)
+// @@@ 영상은 worker가 처리한 뒤에 사용량에 더해지므로 처리 job을 만들 때 원본 크기만큼 예약(video_jobs.reserved_bytes)하고
+// @@@ 처리 후 실제 크기로 연결하기 전에 다시 확인한다 (processUploadedVideo)
+// @@@ 제한값이 0이면 제한 없음
+
+// video의 kind 파일을 새로 올릴 때 쓸 수 있는 최대 byte 수를 반환하는 apiConfig method
+// 같은 kind의 파일을 교체하면 이전 파일 크기만큼은 다시 쓸 수 있다
+// @@@ 처리 대기 중인 다른 영상 업로드가 예약한 크기도 뺀다 (database.GetUploadAllowance)
+// 용량 제한이 없으면 -1 반환
+func (cfg *apiConfig) uploadAllowance(video database.Video, kind string) (int64, error) {
+	if cfg.userQuotaBytes <= 0 {
+		return -1, nil
+	}
+	return cfg.db.GetUploadAllowance(video.ID, kind, cfg.userQuotaBytes)
+}
+
+// size byte 파일을 올릴 수 있는지 확인하고 안 되면 507 응답을 보내는 apiConfig method
+// size를 아직 모르면 0을 넘겨서 남은 용량이 있는지만 확인
+func (cfg *apiConfig) checkUploadQuota(w http.ResponseWriter, video database.Video, kind string, size int64) bool {
+	allowance, err := cfg.uploadAllowance(video, kind)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return false
+	}
+	if allowance < 0 {
+		return true
+	}
+	if allowance == 0 || size > allowance {
+		respondQuotaExceeded(w, size, allowance)
+		return false
+	}
+	return true
+}
+
+// 507 Insufficient Storage 응답
+// @@@ 파일 하나가 업로드 최대 크기를 넘는 경우(413)와 구분되도록 유저 용량 초과는 507
+func respondQuotaExceeded(w http.ResponseWriter, size, allowance int64) {
+	respondWithError(w, http.StatusInsufficientStorage,
+		fmt.Sprintf("Storage quota exceeded: upload is %d bytes but only %d bytes remain", size, allowance), nil)
+}
+
+// 영상 처리 job을 만들지 못했을 때 응답하는 apiConfig method
+// 동시에 올린 다른 업로드가 먼저 용량을 예약해서 모자라면 507, 그 밖의 에러는 500
+func (cfg *apiConfig) respondEnqueueError(w http.ResponseWriter, video database.Video, size int64, err error) {
+	if errors.Is(err, database.ErrQuotaExceeded) {
+		allowance, _ := cfg.uploadAllowance(video, database.BlobKindVideo)
+		respondQuotaExceeded(w, size, max(allowance, 0))
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "Unable to queue the video for processing", err)
+}
+
+// video를 하나 더 만들 수 있는지 확인하고 안 되면 507 응답을 보내는 apiConfig method
+func (cfg *apiConfig) checkVideoCountQuota(w http.ResponseWriter, usage database.UserUsage) bool {
+	if cfg.userMaxVideos <= 0 || usage.VideoCount < cfg.userMaxVideos {
+		return true
+	}
+	respondWithError(w, http.StatusInsufficientStorage,
+		fmt.Sprintf("Video limit reached: %d of %d videos used", usage.VideoCount, cfg.userMaxVideos), nil)
+	return false
+}
+
+// GET /api/users/me/usage handler : 로그인한 유저의 저장 용량 사용량과 제한
+func (cfg *apiConfig) handlerUserUsage(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.UserUsage
+		QuotaBytes     int64  `json:"quota_bytes"`     // 0이면 제한 없음
+		MaxVideos      int    `json:"max_videos"`      // 0이면 제한 없음
+		BytesRemaining *int64 `json:"bytes_remaining"` // 제한이 없으면 null
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	usage, err := cfg.db.GetUserUsage(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+
+	resp := response{
+		UserUsage:  usage,
+		QuotaBytes: max(cfg.userQuotaBytes, 0),
+		MaxVideos:  max(cfg.userMaxVideos, 0),
+	}
+	if cfg.userQuotaBytes > 0 {
+		remaining := max(cfg.userQuotaBytes-usage.BytesUsed, 0)
+		resp.BytesRemaining = &remaining
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
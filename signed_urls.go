@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cfsign"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// @@@ getCFURL은 도메인과 key를 이어 붙이기만 하므로 url을 아는 사람은 누구나 영구히 볼 수 있다
+// @@@ ==> CF_KEY_PAIR_ID, CF_PRIVATE_KEY_PATH가 설정되면 unlisted, private video의 응답 url을 cloud front signed url로 바꾼다
+// @@@ db에는 서명하지 않은 url을 그대로 저장하고 응답을 만들 때만 서명
+
+// hls, dash 같은 여러 파일 묶음이 저장되는 video별 key prefix
+// signed cookie는 이 prefix 아래 파일 전체(<prefix>*)를 허용한다
+func videoPackagePrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("packages/%s/", videoID)
+}
+
+// video의 visibility에 맞는 전달용 url로 VideoURL, ThumbnailURL을 바꾼 database.Video를 반환하는 apiConfig method
+// public : cdn url 그대로
+// unlisted, private : cloud front signed url (서명 설정이 없으면 s3 presigned url)
+// @@@ local 저장소처럼 서명할 방법이 없으면 영상은 토큰을 붙인 stream url, 썸네일은 그대로 둔다
+// @@@ 암호화된 영상은 visibility와 상관없이 stream url, 보관된 영상은 nil
+// @@@ HLSURL, DASHURL, SpritesVTTURL은 서명하지 않는다 (segment까지 받으려면 POST /api/videos/{videoID}/cookies의 signed cookie 필요)
+func (cfg *apiConfig) dbVideoToSignedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	// 보관된 영상은 복원 전까지 재생할 수 없으므로 url을 주지 않는다
+	if video.ArchiveStatus != "" {
+		video.VideoURL = nil
+	}
+	// signed cookie를 발급할 수 없으면 public이 아닌 video의 package를 보호할 방법이 없으므로 url을 주지 않는다
+	if video.Visibility != database.VisibilityPublic && cfg.cfSigner == nil {
+		video.HLSURL, video.DASHURL, video.SpritesVTTURL = nil, nil, nil
+	}
+
+	expires := time.Now().Add(cfg.cfSignedExpiry)
+	// @@@ 아직 업로드되지 않은 video는 VideoURL, ThumbnailURL이 nil이므로 예외 처리
+	fields := []**string{&video.VideoURL, &video.ThumbnailURL}
+
+	// 암호화된 영상은 서버가 복호화해야 하므로 public이어도 stream url (private이면 토큰 포함)
+	if video.VideoURL != nil {
+		encrypted, err := cfg.isEncryptedURL(*video.VideoURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		if encrypted {
+			streamURL := cfg.getStreamURL(video.ID, "")
+			if video.Visibility != database.VisibilityPublic {
+				streamURL, err = cfg.getSignedStreamURL(video.ID, expires)
+				if err != nil {
+					return database.Video{}, err
+				}
+			}
+			video.VideoURL = &streamURL
+			fields = fields[1:]
+		}
+	}
+
+	if video.Visibility == database.VisibilityPublic {
+		return video, nil
+	}
+
+	for _, field := range fields {
+		if *field == nil {
+			continue
+		}
+		signedURL, signed, err := cfg.signObjectURL(ctx, **field, expires)
+		if err != nil {
+			return database.Video{}, err
+		}
+		if !signed && field == &video.VideoURL {
+			signedURL, err = cfg.getSignedStreamURL(video.ID, expires)
+			if err != nil {
+				return database.Video{}, err
+			}
+		}
+		// 원본 포인터가 가리키는 값을 바꾸지 않도록 새 포인터로 교체
+		*field = &signedURL
+	}
+	return video, nil
+}
+
+// db에 저장된 url 하나를 expires까지 유효한 url로 바꾸는 apiConfig method
+// 서명할 방법이 없으면 rawURL과 false 반환
+func (cfg *apiConfig) signObjectURL(ctx context.Context, rawURL string, expires time.Time) (string, bool, error) {
+	storeName, key, ok := cfg.objectRefFromURL(rawURL)
+	if !ok || storeName != storeMedia || cfg.storageBackend == "local" {
+		return rawURL, false, nil
+	}
+
+	if cfg.cfSigner != nil {
+		signedURL, err := cfg.cfSigner.SignURL(rawURL, expires)
+		if err != nil {
+			return "", false, fmt.Errorf("error signing url: %w", err)
+		}
+		return signedURL, true, nil
+	}
+
+	// cloud front 서명 설정이 없으면 버킷의 presigned url 사용
+	if presigner, ok := cfg.store.(storage.Presigner); ok {
+		presignedURL, err := presigner.PresignGet(ctx, key, time.Until(expires))
+		if err != nil {
+			return "", false, fmt.Errorf("error creating presigned url: %w", err)
+		}
+		return presignedURL, true, nil
+	}
+	return rawURL, false, nil
+}
+
+// POST /api/videos/{videoID}/cookies handler : video의 package 디렉토리(hls 등)를 볼 수 있는 cloud front signed cookie 발급
+// @@@ hls는 playlist와 segment 파일을 많이 받아야 하므로 파일마다 signed url을 만드는 대신 와일드카드 cookie 하나로 허용
+// @@@ unlisted video의 응답에도 hls, dash, sprite url이 들어가므로 소유자만이 아니라 stream과 같은 규칙(canStream)으로 허용
+func (cfg *apiConfig) handlerVideoCookies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Resource  string    `json:"resource"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !cfg.canStream(r, video) {
+		// @@@ private video가 있다는 사실도 알리지 않도록 403 대신 404
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	if cfg.cfSigner == nil {
+		respondWithError(w, http.StatusNotImplemented, "Signed cookies are not configured", nil)
+		return
+	}
+
+	expires := time.Now().Add(cfg.cfSignedExpiry)
+	resource := cfg.getCFURL(videoPackagePrefix(video.ID)) + "*"
+	cookies, err := cfg.cfSigner.SignCookies(cfsign.NewCustomPolicy(resource, time.Time{}, expires, ""))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign cookies", err)
+		return
+	}
+
+	for _, c := range cookies {
+		// cloud front 도메인으로 보내지도록 cfCookieDomain(ex: .example.com)에 설정
+		c.Domain = cfg.cfCookieDomain
+		c.Path = "/"
+		c.Expires = expires
+		c.Secure = true
+		c.HttpOnly = true
+		c.SameSite = http.SameSiteNoneMode
+		http.SetCookie(w, c)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Resource:  resource,
+		ExpiresAt: expires.UTC(),
+	})
+}
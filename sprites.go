@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// @@@ seek bar에 마우스를 올렸을 때 미리보기를 보여줄 수 있도록
+// @@@ SPRITE_INTERVAL마다 frame 하나를 SPRITE_WIDTH 너비로 줄여 spriteColumns x spriteRows 격자로 이어 붙인 jpeg(sprite)를 만들고
+// @@@ 시간 구간 ==> sprite_000.jpg#xywh=x,y,w,h 를 적은 WebVTT 파일을 같이 올린다 (video.js, jw player 등이 읽는 thumbnails track 형식)
+// @@@ hls, dash처럼 video의 package prefix 아래에 올라가므로 같은 signed cookie로 볼 수 있다
+
+// sprite 하나의 격자 크기 (가로 x 세로 frame 개수)
+const (
+	spriteColumns = 10
+	spriteRows    = 10
+)
+
+// WebVTT 파일 이름 (sprite들과 같은 디렉토리, vtt 안의 sprite url은 상대 경로)
+const spriteVTT = "thumbnails.vtt"
+
+// sprite 파일 이름 (0부터)
+func spriteFileName(index int) string {
+	return fmt.Sprintf("sprite_%03d.jpg", index)
+}
+
+// 영상 길이를 ffprobe로 읽는 함수
+func probeVideoDuration(filePath string) (time.Duration, error) {
+	type ffprobeResult struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_entries", "format=duration", filePath)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("error running ffprobe command: %w", err)
+	}
+	var result ffprobeResult
+	if err := json.NewDecoder(&out).Decode(&result); err != nil {
+		return 0, fmt.Errorf("error decoding ffprobe's stdout: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(result.Format.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("unknown duration of %s", filePath)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// 영상에서 interval마다 frame을 뽑아 tileWidth x tileHeight 크기로 줄이고 sprite 파일들로 outDir에 저장하는 함수
+func transcodeSprites(filePath, outDir string, interval time.Duration, tileWidth, tileHeight int) error {
+	args := []string{
+		"-y",
+		"-i", filePath,
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", interval.Seconds(), tileWidth, tileHeight, spriteColumns, spriteRows),
+		"-q:v", "5",
+		"-start_number", "0",
+		"-f", "image2",
+		filepath.Join(outDir, "sprite_%03d.jpg"),
+	}
+	return runFFmpeg(args, nil)
+}
+
+// sprite 파일들의 각 frame이 영상의 어느 구간인지 적은 WebVTT 내용을 만드는 함수
+// @@@ 마지막 sprite는 tile filter가 남는 칸을 검게 채우므로 영상 길이까지만 구간을 적는다
+// @@@ 만들어지지 않은 sprite(영상 끝의 frame이 fps filter에서 빠진 경우)를 가리키지 않도록 exists로 확인
+func buildSpriteVTT(duration, interval time.Duration, tileWidth, tileHeight int, exists func(name string) bool) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	perSprite := spriteColumns * spriteRows
+	for i := 0; time.Duration(i)*interval < duration; i++ {
+		name := spriteFileName(i / perSprite)
+		if !exists(name) {
+			break
+		}
+		start := time.Duration(i) * interval
+		end := min(start+interval, duration)
+		cell := i % perSprite
+		x, y := cell%spriteColumns*tileWidth, cell/spriteColumns*tileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", vttTimestamp(start), vttTimestamp(end), name, x, y, tileWidth, tileHeight)
+	}
+	return b.String()
+}
+
+// WebVTT 시각 형식 (HH:MM:SS.mmm)
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// 원본 영상으로 sprite 미리보기를 만들어 올리고 video의 sprites_vtt_url을 갱신하는 apiConfig method, vtt url 반환
+// @@@ packageVideo처럼 key에 원본 hash를 넣어 영상을 바꾸면 새 prefix에 올라간다
+func (cfg *apiConfig) generateVideoSprites(ctx context.Context, video database.Video, filePath, contentHash string) (string, error) {
+	prefix := fmt.Sprintf("%s%s/%s/", videoPackagePrefix(video.ID), database.PackageFormatSprites, contentHash)
+	vttURL := cfg.objectURL(storeMedia, prefix+spriteVTT)
+	if video.SpritesVTTURL != nil && *video.SpritesVTTURL == vttURL {
+		// 같은 내용을 다시 올린 경우
+		return vttURL, nil
+	}
+
+	width, height, _, err := probeHLSSource(filePath)
+	if err != nil {
+		return "", err
+	}
+	duration, err := probeVideoDuration(filePath)
+	if err != nil {
+		return "", err
+	}
+	// 원본 비율대로 높이를 정한다 (ffmpeg scale은 짝수 크기만 받는 인코더가 있으므로 짝수로)
+	tileWidth := cfg.spriteWidth
+	tileHeight := max(tileWidth*height/width/2*2, 2)
+
+	outDir, err := os.MkdirTemp("", "tubely-sprites_*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(outDir)
+	if err := transcodeSprites(filePath, outDir, cfg.spriteInterval, tileWidth, tileHeight); err != nil {
+		return "", err
+	}
+	vtt := buildSpriteVTT(duration, cfg.spriteInterval, tileWidth, tileHeight, func(name string) bool {
+		ok, err := nonEmptyFile(filepath.Join(outDir, name))
+		return err == nil && ok
+	})
+	if err := os.WriteFile(filepath.Join(outDir, spriteVTT), []byte(vtt), 0o644); err != nil {
+		return "", err
+	}
+
+	objects, err := cfg.uploadPackageDir(ctx, outDir, prefix, video, database.PackageFormatSprites)
+	if err != nil {
+		return "", fmt.Errorf("error uploading sprites: %w", err)
+	}
+	// 이전 sprite 객체는 삭제 예약되고 바로 한번 지워본다
+	queued, err := cfg.db.ReplaceVideoSprites(video.ID, objects, vttURL)
+	if err != nil {
+		return "", err
+	}
+	cfg.attemptPendingDeletions(ctx, queued)
+	return vttURL, nil
+}
+
+// video의 sprite 미리보기를 지우는 apiConfig method (영상을 바꿨는데 새 sprite를 만들지 못한 경우)
+func (cfg *apiConfig) removeVideoSprites(ctx context.Context, video database.Video) error {
+	if video.SpritesVTTURL == nil {
+		return nil
+	}
+	queued, err := cfg.db.ReplaceVideoSprites(video.ID, nil, "")
+	if err != nil {
+		return err
+	}
+	cfg.attemptPendingDeletions(ctx, queued)
+	return nil
+}
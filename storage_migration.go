@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ 버킷이나 리전을 바꾸거나 local ==> s3로 옮길 때 db의 thumbnail_url, video_url이 참조하는 객체를 새 저장소로 복사
+// @@@ 1. 객체마다 복사 ==> target에서 다시 읽어 크기와 sha256 비교 ==> storage_migration_items에 기록 (동시에 concurrency개)
+// @@@ 2. 모든 객체가 성공하면 url 변경을 하나의 transaction으로 적용
+// @@@ 중간에 중단되어도 같은 target으로 다시 실행하면 기록된 객체는 건너뛰고 나머지만 복사
+// @@@ 원래 저장소의 객체는 지우지 않는다 ==> 설정을 target으로 바꾸고 확인한 뒤 직접 정리
+
+// migrate-storage 명령어의 target 저장소 설정
+type storageMigrationTarget struct {
+	Backend        string // s3, local
+	Bucket         string
+	Region         string
+	CfDistribution string
+	Root           string
+}
+
+// target 저장소를 쓰는 apiConfig 복사본과 target 식별 문자열을 만드는 apiConfig method
+// @@@ 복사본의 getStoredObjectURL로 target 설정에서 쓰일 url을 만든다
+func (cfg *apiConfig) newMigrationTargetConfig(ctx context.Context, target storageMigrationTarget) (*apiConfig, string, error) {
+	targetCfg := *cfg
+	targetCfg.storageBackend = target.Backend
+
+	switch target.Backend {
+	case "local":
+		if target.Root == "" {
+			return nil, "", errors.New("-to-root is required for a local target")
+		}
+		root, err := filepath.Abs(target.Root)
+		if err != nil {
+			return nil, "", err
+		}
+		store, err := storage.NewLocalStore(root)
+		if err != nil {
+			return nil, "", err
+		}
+		// local 저장소는 영상과 썸네일을 같은 디렉토리에 저장
+		targetCfg.assetsRoot = root
+		targetCfg.store = store
+		targetCfg.assetStore = store
+		return &targetCfg, "local:" + root, nil
+
+	case "s3":
+		if target.Bucket == "" || target.CfDistribution == "" {
+			return nil, "", errors.New("-to-bucket and -to-cf-distro are required for an s3 target")
+		}
+		region := target.Region
+		if region == "" {
+			region = cfg.s3Region
+		}
+		if region == "" {
+			return nil, "", errors.New("-to-region is required for an s3 target")
+		}
+		s3Cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating s3 config: %w", err)
+		}
+		targetCfg.s3Bucket = target.Bucket
+		targetCfg.s3Region = region
+		targetCfg.s3CfDistribution = target.CfDistribution
+		targetCfg.store = storage.NewS3Store(s3.NewFromConfig(s3Cfg), target.Bucket, getMultipartOptions())
+		return &targetCfg, "s3://" + target.Bucket, nil
+	}
+	return nil, "", fmt.Errorf("unknown target backend %q (must be s3 or local)", target.Backend)
+}
+
+// 옮길 객체 하나와 그 객체를 가리키는 db url들
+type migrationObject struct {
+	Store string
+	Key   string
+	URLs  []string
+}
+
+// migrate-storage 명령어 결과
+type storageMigrationReport struct {
+	DryRun        bool     `json:"dry_run"`
+	Target        string   `json:"target"`
+	Objects       int      `json:"objects"` // 옮길 객체 수
+	Copied        int      `json:"copied"`  // 이번 실행에서 복사하고 검증한 객체 수
+	Resumed       int      `json:"resumed"` // 이전 실행에서 이미 복사한 객체 수
+	CopiedBytes   int64    `json:"copied_bytes"`
+	URLsRewritten int      `json:"urls_rewritten"`
+	Skipped       []string `json:"skipped"`
+	Errors        []string `json:"errors"`
+}
+
+// video들이 참조하는 모든 객체를 target 저장소로 복사하고 url을 바꾸는 apiConfig method
+func (cfg *apiConfig) migrateStorage(ctx context.Context, target storageMigrationTarget, concurrency int, dryRun bool) (storageMigrationReport, error) {
+	report := storageMigrationReport{
+		DryRun:  dryRun,
+		Skipped: []string{},
+		Errors:  []string{},
+	}
+
+	targetCfg, targetID, err := cfg.newMigrationTargetConfig(ctx, target)
+	if err != nil {
+		return report, err
+	}
+	if targetCfg.storageBackend == cfg.storageBackend &&
+		(cfg.storageBackend == "s3" && targetCfg.s3Bucket == cfg.s3Bucket ||
+			cfg.storageBackend == "local" && sameDir(targetCfg.assetsRoot, cfg.assetsRoot)) {
+		return report, errors.New("target is the storage currently in use")
+	}
+	report.Target = targetID
+
+	objects, skipped, err := cfg.collectMigrationObjects()
+	if err != nil {
+		return report, err
+	}
+	report.Objects = len(objects)
+	report.Skipped = append(report.Skipped, skipped...)
+	if dryRun {
+		return report, nil
+	}
+
+	// 객체 복사 (최대 concurrency개 동시에)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(concurrency, 1))
+	for _, obj := range objects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			copied, size, err := cfg.migrateObject(ctx, targetCfg, targetID, obj)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", obj.Store, obj.Key, err))
+			case copied:
+				report.Copied++
+				report.CopiedBytes += size
+			default:
+				report.Resumed++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(report.Errors) > 0 {
+		// 다시 실행하면 실패한 객체만 다시 복사한다
+		sort.Strings(report.Errors)
+		return report, nil
+	}
+
+	// 모든 객체가 복사되었으면 url 변경을 한번에 적용
+	migrated := []database.MigratedObject{}
+	for _, obj := range objects {
+		newURL := targetCfg.objectURL(storeMedia, obj.Key)
+		for _, oldURL := range obj.URLs {
+			migrated = append(migrated, database.MigratedObject{
+				OldURL:   oldURL,
+				NewURL:   newURL,
+				Store:    obj.Store,
+				Key:      obj.Key,
+				NewStore: storeMedia,
+			})
+		}
+	}
+	if err := cfg.db.ApplyStorageMigration(targetID, migrated); err != nil {
+		return report, fmt.Errorf("error rewriting urls: %w", err)
+	}
+	report.URLsRewritten = len(migrated)
+	return report, nil
+}
+
+// video들의 thumbnail_url, video_url이 참조하는 객체와 package 객체 목록 (같은 객체는 하나로)
+// 옮길 수 없는 url은 이유와 함께 skipped로 반환
+func (cfg *apiConfig) collectMigrationObjects() ([]migrationObject, []string, error) {
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting videos: %w", err)
+	}
+
+	skipped := []string{}
+	byRef := map[[2]string]*migrationObject{}
+	objects := []*migrationObject{}
+	for _, video := range videos {
+		for _, url := range []*string{video.VideoURL, video.ThumbnailURL} {
+			if url == nil {
+				continue
+			}
+			if url == video.VideoURL && video.ArchiveStatus != "" {
+				// 보관된 영상은 원래 위치에 객체가 없으므로 복원한 뒤 다시 실행해야 한다
+				skipped = append(skipped, fmt.Sprintf("video %s is archived: %s", video.ID, *url))
+				continue
+			}
+			storeName, key, ok := cfg.objectRefFromURL(*url)
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("video %s references an unknown url: %s", video.ID, *url))
+				continue
+			}
+
+			ref := [2]string{storeName, key}
+			obj, found := byRef[ref]
+			if !found {
+				obj = &migrationObject{Store: storeName, Key: key}
+				byRef[ref] = obj
+				objects = append(objects, obj)
+			}
+			if !slices.Contains(obj.URLs, *url) {
+				obj.URLs = append(obj.URLs, *url)
+			}
+		}
+	}
+
+	// package(hls, dash, sprites)의 manifest, segment도 같이 옮긴다 (url은 manifest만 videos에 있다)
+	packageObjects, err := cfg.db.GetPackageObjects()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting package objects: %w", err)
+	}
+	packageURLs := map[[2]string]string{}
+	for _, video := range videos {
+		for _, url := range []*string{video.HLSURL, video.DASHURL, video.SpritesVTTURL} {
+			if url == nil {
+				continue
+			}
+			if storeName, key, ok := cfg.objectRefFromURL(*url); ok {
+				packageURLs[[2]string{storeName, key}] = *url
+			}
+		}
+	}
+	for _, pkgObj := range packageObjects {
+		ref := [2]string{pkgObj.Store, pkgObj.Key}
+		if _, found := byRef[ref]; found {
+			continue
+		}
+		obj := &migrationObject{Store: pkgObj.Store, Key: pkgObj.Key}
+		if url, ok := packageURLs[ref]; ok {
+			obj.URLs = []string{url}
+		}
+		byRef[ref] = obj
+		objects = append(objects, obj)
+	}
+
+	result := make([]migrationObject, 0, len(objects))
+	for _, obj := range objects {
+		result = append(result, *obj)
+	}
+	return result, skipped, nil
+}
+
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// 객체 하나를 target 저장소로 복사하고 검증하는 apiConfig method
+// 이전 실행에서 이미 복사했으면 copied == false
+func (cfg *apiConfig) migrateObject(ctx context.Context, targetCfg *apiConfig, targetID string, obj migrationObject) (copied bool, size int64, err error) {
+	item, err := cfg.db.GetStorageMigrationItem(targetID, obj.Store, obj.Key)
+	if err != nil {
+		return false, 0, err
+	}
+	if item.Key != "" {
+		return false, item.Size, nil
+	}
+
+	srcStore, err := cfg.storeByName(obj.Store)
+	if err != nil {
+		return false, 0, err
+	}
+	// SSE-C 객체는 같은 key로 읽고 쓴다 (target도 s3여야 한다)
+	// @@@ envelope 객체는 암호문을 그대로 복사하므로 key 기록도 그대로 쓸 수 있다
+	objectKey, err := cfg.db.GetObjectKey(obj.Store, obj.Key)
+	if err != nil {
+		return false, 0, err
+	}
+	if objectKey.Mode == database.EncryptionSSEC && targetCfg.storageBackend != "s3" {
+		return false, 0, errors.New("SSE-C encrypted objects can only be migrated to an s3 target")
+	}
+	objCtx, err := cfg.mediaObjectContext(ctx, obj.Store, obj.Key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	info, err := srcStore.Head(objCtx, obj.Key)
+	if err != nil {
+		return false, 0, err
+	}
+	tempPath, err := downloadObjectToTempFile(objCtx, srcStore, obj.Key, "", "tubely-migrate_*")
+	if err != nil {
+		return false, 0, err
+	}
+	defer os.Remove(tempPath)
+
+	f, err := os.Open(tempPath)
+	if err != nil {
+		return false, 0, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return false, 0, err
+	}
+	if stat.Size() != info.Size {
+		return false, 0, fmt.Errorf("downloaded %d bytes but the source object is %d bytes", stat.Size(), info.Size)
+	}
+	sum, err := hashFile(tempPath)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if err := storage.PutFile(objCtx, targetCfg.store, obj.Key, f, info.ContentType); err != nil {
+		return false, 0, err
+	}
+
+	// target에서 다시 읽어서 크기와 sha256이 같은지 확인
+	if err := verifyObject(objCtx, targetCfg.store, obj.Key, stat.Size(), sum); err != nil {
+		return false, 0, err
+	}
+
+	err = cfg.db.CreateStorageMigrationItem(database.StorageMigrationItem{
+		Target: targetID,
+		Store:  obj.Store,
+		Key:    obj.Key,
+		Size:   stat.Size(),
+		SHA256: sum,
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	log.Printf("migrated %s/%s (%d bytes)", obj.Store, obj.Key, stat.Size())
+	return true, stat.Size(), nil
+}
+
+// store의 key 객체가 size byte이고 sha256 hex 값이 sum인지 확인하는 함수
+func verifyObject(ctx context.Context, store storage.ObjectStore, key string, size int64, sum string) error {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error reading copied object: %w", err)
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, body)
+	if err != nil {
+		return fmt.Errorf("error reading copied object: %w", err)
+	}
+	if n != size {
+		return fmt.Errorf("size mismatch after copy: expected %d bytes, got %d", size, n)
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != sum {
+		return fmt.Errorf("checksum mismatch after copy: expected %s, got %s", sum, got)
+	}
+	return nil
+}
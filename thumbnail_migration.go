@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ 예전 썸네일은 assetsRoot(로컬 디스크)에 저장되고 http://localhost:<port>/assets/... url을 썼다
+// @@@ ==> 영상과 같은 저장소로 옮기고 thumbnail_url을 cloud front url로 바꾸는 일회성 migration
+// @@@ 여러 번 실행해도 이미 옮긴 썸네일은 건너뛴다
+
+// 썸네일 migration 결과 보고서
+type thumbnailMigrationReport struct {
+	DryRun   bool     `json:"dry_run"`
+	Blobs    int      `json:"blobs"`   // assets 저장소에 있던 blob (dedup 도입 후 올라간 썸네일)
+	Legacy   int      `json:"legacy"`  // blob이 아닌 썸네일 (dedup 도입 전 랜덤 이름)
+	Videos   int      `json:"videos"`  // thumbnail_url이 바뀐 video 개수
+	Skipped  int      `json:"skipped"` // 알 수 없는 url이라 건너뛴 video 개수
+	Errors   []string `json:"errors"`
+	Migrated []string `json:"migrated"` // 새 저장소의 key 목록
+}
+
+// assets 저장소의 썸네일을 cfg.store로 옮기는 apiConfig method
+// dryRun이면 옮기지 않고 보고서만 만든다
+func (cfg apiConfig) migrateThumbnails(ctx context.Context, dryRun bool) (thumbnailMigrationReport, error) {
+	report := thumbnailMigrationReport{
+		DryRun:   dryRun,
+		Errors:   []string{},
+		Migrated: []string{},
+	}
+
+	// 1. assets 저장소에 있는 blob은 객체를 복사하고 blob 위치를 바꾼다
+	// @@@ blob 하나를 여러 video가 참조할 수 있으므로 MoveBlob이 참조하는 모든 video의 url을 같이 바꾼다
+	blobs, err := cfg.db.GetBlobs()
+	if err != nil {
+		return report, fmt.Errorf("error getting blobs: %w", err)
+	}
+	for _, blob := range blobs {
+		if blob.Store != storeAssets {
+			continue
+		}
+		report.Blobs++
+		// @@@ 여러 video가 공유할 수 있는 blob이라 {user_id}, {video_id}를 채울 수 없으므로 예전 layout으로 옮긴다
+		// @@@ ==> THUMBNAIL_KEY_TEMPLATE layout으로는 rewrite-keys 명령어가 다시 옮긴다
+		newKey := getS3ThumbnailPath(blob.ContentType, blobContentHash(blob.Hash))
+		if dryRun {
+			report.Migrated = append(report.Migrated, newKey)
+			continue
+		}
+
+		if err := cfg.copyAssetToStore(ctx, blob.Key, newKey, blob.ContentType); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		queued, err := cfg.db.MoveBlob(blob.Hash, storeMedia, newKey, cfg.objectURL(storeMedia, newKey))
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error moving blob %s: %v", blob.Hash, err))
+			continue
+		}
+		report.Migrated = append(report.Migrated, newKey)
+		// 이전 객체 삭제는 실패해도 runPendingDeletions가 다시 시도한다
+		for _, pd := range queued {
+			if err := cfg.attemptPendingDeletion(ctx, pd); err != nil {
+				log.Printf("couldn't delete migrated thumbnail %s: %v", pd.Key, err)
+			}
+		}
+	}
+
+	// 2. blob이 아닌 예전 썸네일은 hash를 계산해서 blob으로 등록
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return report, fmt.Errorf("error getting videos: %w", err)
+	}
+	for _, video := range videos {
+		if video.ThumbnailURL == nil {
+			continue
+		}
+		storeName, key, ok := cfg.objectRefFromURL(*video.ThumbnailURL)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		if storeName != storeAssets {
+			// 이미 cfg.store에 있는 썸네일
+			continue
+		}
+		isBlob, err := cfg.db.IsBlobKey(storeName, key)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		if isBlob {
+			// 1단계에서 옮기지 못한 blob
+			continue
+		}
+
+		report.Legacy++
+		if dryRun {
+			report.Migrated = append(report.Migrated, key)
+			continue
+		}
+
+		newKey, err := cfg.migrateLegacyThumbnail(ctx, video, key)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error migrating thumbnail of video %s: %v", video.ID, err))
+			continue
+		}
+		report.Videos++
+		report.Migrated = append(report.Migrated, newKey)
+	}
+
+	return report, nil
+}
+
+// blob이 아닌 예전 썸네일 하나를 blob으로 cfg.store에 저장하고 video에 연결하는 apiConfig method
+// 새 key 반환
+func (cfg apiConfig) migrateLegacyThumbnail(ctx context.Context, video database.Video, key string) (string, error) {
+	tempPath, err := downloadObjectToTempFile(ctx, cfg.assetStore, key, "", "tubely-thumbnail_*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempPath)
+
+	contentHash, err := hashFile(tempPath)
+	if err != nil {
+		return "", err
+	}
+	info, err := cfg.assetStore.Head(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	blobID := cfg.blobID(database.BlobKindThumbnail, contentHash, video.UserID, video.ID)
+	blob, err := cfg.db.GetBlob(blobID)
+	if err != nil {
+		return "", err
+	}
+	if blob.Hash == "" {
+		newKey, err := cfg.blobKey(database.BlobKindThumbnail, video.UserID, video.ID, contentHash, info.ContentType, "")
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(tempPath)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if err := storage.PutFile(ctx, cfg.store, newKey, f, info.ContentType); err != nil {
+			return "", err
+		}
+		blob = database.Blob{
+			CreateBlobParams: database.CreateBlobParams{
+				Hash:        blobID,
+				Store:       storeMedia,
+				Key:         newKey,
+				Size:        info.Size,
+				ContentType: info.ContentType,
+			},
+		}
+	}
+
+	if err := cfg.db.AttachVideoBlob(video.ID, database.BlobKindThumbnail, blob.CreateBlobParams, cfg.objectURL(blob.Store, blob.Key)); err != nil {
+		return "", err
+	}
+
+	// 예전 썸네일은 랜덤 이름이라 다른 video가 참조하지 않으므로 바로 삭제
+	if err := cfg.assetStore.Delete(ctx, key); err != nil {
+		log.Printf("couldn't delete migrated thumbnail %s: %v", key, err)
+	}
+	return blob.Key, nil
+}
+
+// assets 저장소의 객체를 cfg.store의 newKey로 복사하는 apiConfig method
+func (cfg apiConfig) copyAssetToStore(ctx context.Context, key, newKey, contentType string) error {
+	tempPath, err := downloadObjectToTempFile(ctx, cfg.assetStore, key, "", "tubely-thumbnail_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
+
+	f, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return storage.PutFile(ctx, cfg.store, newKey, f, contentType)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ 썸네일을 따로 올리지 않은 video는 thumbnail_url이 NULL이라 목록에 빈 카드가 보였다
+// @@@ ==> 영상을 처리할 때 ffmpeg로 대표 frame을 골라 썸네일로 쓴다 (thumbnail_source = auto)
+// @@@ 사용자가 올린 썸네일(upload)이나 시각을 지정해서 고른 썸네일(frame)은 덮어쓰지 않는다
+// @@@ POST /api/videos/{videoID}/thumbnail/from_frame?t=12.5 로 원하는 시각의 frame을 썸네일로 지정할 수 있다
+
+// 자동 썸네일을 고를 때 건너뛰는 앞부분 길이 (초) ==> 시작 부분의 검은 화면, fade in을 피한다
+const autoThumbnailSkipSeconds = 2
+
+// 자동 썸네일 후보로 비교할 frame 개수 (ffmpeg thumbnail filter)
+const autoThumbnailCandidates = 100
+
+// 영상에서 대표 frame 하나를 jpeg로 outPath에 저장하는 함수
+// @@@ ffmpeg thumbnail filter는 후보 frame들의 색 분포 평균에 가장 가까운 frame을 고르므로 검은 화면이나 장면 전환 중인 frame은 잘 뽑히지 않는다
+// @@@ 영상이 autoThumbnailSkipSeconds보다 짧으면 frame이 나오지 않으므로 처음부터 다시 고른다
+func extractRepresentativeFrame(filePath, outPath string) error {
+	for _, skip := range []int{autoThumbnailSkipSeconds, 0} {
+		args := []string{
+			"-y",
+			"-ss", strconv.Itoa(skip),
+			"-i", filePath,
+			"-vf", fmt.Sprintf("thumbnail=n=%d", autoThumbnailCandidates),
+			"-frames:v", "1",
+			"-q:v", "2",
+			"-f", "image2",
+			outPath,
+		}
+		if err := runFFmpeg(args, nil); err != nil {
+			return err
+		}
+		if ok, err := nonEmptyFile(outPath); err != nil || ok {
+			return err
+		}
+	}
+	return fmt.Errorf("no video frame found in %s", filePath)
+}
+
+// 영상의 at초 위치의 frame을 jpeg로 outPath에 저장하는 함수, frame이 있었는지 반환 (at이 영상 길이보다 길면 false)
+func extractVideoFrame(filePath, outPath string, at float64) (bool, error) {
+	args := []string{
+		"-y",
+		"-ss", strconv.FormatFloat(at, 'f', -1, 64),
+		"-i", filePath,
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-f", "image2",
+		outPath,
+	}
+	if err := runFFmpeg(args, nil); err != nil {
+		return false, err
+	}
+	return nonEmptyFile(outPath)
+}
+
+// 파일이 있고 비어 있지 않은지 확인하는 함수
+// @@@ ffmpeg는 -ss가 영상 길이보다 길면 에러 없이 아무것도 쓰지 않는다
+func nonEmptyFile(filePath string) (bool, error) {
+	stat, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return stat.Size() > 0, nil
+}
+
+// 썸네일 이미지 파일(f)을 저장소에 올리고 video에 연결할 blob을 반환하는 apiConfig method
+// 같은 내용의 blob이 이미 있으면 올리지 않고 그 blob을 반환한다
+func (cfg *apiConfig) storeThumbnailBlob(ctx context.Context, video database.Video, f *os.File, size int64, contentHash, mediaType string) (database.Blob, error) {
+	blobID := cfg.blobID(database.BlobKindThumbnail, contentHash, video.UserID, video.ID)
+	blob, err := cfg.db.GetBlob(blobID)
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to look up the thumbnail: %w", err)
+	}
+	if blob.Hash != "" {
+		return blob, nil
+	}
+
+	// 썸네일도 영상과 같은 저장소(s3 버켓)에 THUMBNAIL_KEY_TEMPLATE(기본값 thumbnails/<hash>.<file_extension>) key로 저장
+	// @@@ 로컬 디스크(assetsRoot)에 저장하면 서버를 여러 대 띄우거나 실제 도메인 뒤에 두었을 때 썸네일을 찾을 수 없다
+	assetName, err := cfg.blobKey(database.BlobKindThumbnail, video.UserID, video.ID, contentHash, mediaType, "")
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to build thumbnail key: %w", err)
+	}
+	if err := storage.PutFile(ctx, cfg.store, assetName, f, mediaType); err != nil {
+		return database.Blob{}, fmt.Errorf("unable to store thumbnail file: %w", err)
+	}
+	return database.Blob{
+		CreateBlobParams: database.CreateBlobParams{
+			Hash:        blobID,
+			Store:       storeMedia,
+			Key:         assetName,
+			Size:        size,
+			ContentType: mediaType,
+		},
+	}, nil
+}
+
+// 영상 frame 이미지 파일을 썸네일로 올리고 source 방식으로 video에 연결하는 apiConfig method, 연결했는지 반환
+// source가 auto면 사용자가 고른 썸네일이 있을 때 연결하지 않는다 (AttachThumbnailBlob 참고)
+func (cfg *apiConfig) attachFrameThumbnail(ctx context.Context, video database.Video, framePath, source string) (database.Video, bool, error) {
+	contentHash, err := hashFile(framePath)
+	if err != nil {
+		return video, false, fmt.Errorf("unable to hash the frame: %w", err)
+	}
+	f, err := os.Open(framePath)
+	if err != nil {
+		return video, false, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return video, false, err
+	}
+
+	blob, err := cfg.storeThumbnailBlob(ctx, video, f, stat.Size(), contentHash, "image/jpeg")
+	if err != nil {
+		return video, false, err
+	}
+	thumbnailURL := cfg.objectURL(blob.Store, blob.Key)
+	attached, err := cfg.db.AttachThumbnailBlob(video.ID, blob.CreateBlobParams, thumbnailURL, source)
+	if err != nil {
+		return video, false, fmt.Errorf("unable to update the video's metadata: %w", err)
+	}
+	if attached {
+		video.ThumbnailURL = &thumbnailURL
+		video.ThumbnailSource = source
+	}
+	return video, attached, nil
+}
+
+// 사용자가 고른 썸네일이 없으면 업로드된 영상(filePath)에서 대표 frame을 골라 썸네일로 쓰는 apiConfig method
+// @@@ 영상은 이미 저장되어 재생할 수 있으므로 실패해도 처리 job은 성공으로 두고 로그만 남긴다
+// @@@ 썸네일은 cdn이 그대로 전달해야 해서 암호화하지 않으므로 MEDIA_ENCRYPTION이 설정되어 있으면 만들지 않는다 (기밀 영상의 frame이 평문으로 남음)
+func (cfg *apiConfig) generateAutoThumbnail(ctx context.Context, video database.Video, filePath string) database.Video {
+	if cfg.mediaEncryption != "" {
+		return video
+	}
+	if video.ThumbnailURL != nil && video.ThumbnailSource != database.ThumbnailSourceAuto {
+		return video
+	}
+
+	frame, err := os.CreateTemp("", "tubely-thumbnail_*.jpg")
+	if err != nil {
+		log.Printf("error creating thumbnail file for video %s: %v", video.ID, err)
+		return video
+	}
+	frame.Close()
+	defer os.Remove(frame.Name())
+
+	if err := extractRepresentativeFrame(filePath, frame.Name()); err != nil {
+		log.Printf("error extracting thumbnail of video %s: %v", video.ID, err)
+		return video
+	}
+
+	// 용량이 모자라면 자동 썸네일은 건너뛴다
+	if stat, err := os.Stat(frame.Name()); err == nil {
+		allowance, err := cfg.uploadAllowance(video, database.BlobKindThumbnail)
+		if err == nil && allowance >= 0 && stat.Size() > allowance {
+			log.Printf("skipping thumbnail of video %s: storage quota exceeded", video.ID)
+			return video
+		}
+	}
+
+	video, _, err = cfg.attachFrameThumbnail(ctx, video, frame.Name(), database.ThumbnailSourceAuto)
+	if err != nil {
+		log.Printf("error storing thumbnail of video %s: %v", video.ID, err)
+	}
+	return video
+}
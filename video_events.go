@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// @@@ 업로드한 영상이 처리되는 동안 클라이언트가 진행 상황을 볼 수 있도록
+// @@@ worker가 처리 단계와 진행률을 video별로 발행하고 GET /api/videos/{videoID}/events(SSE)가 구독한다
+// @@@ 진행 상황은 메모리에만 있다 ==> 서버를 다시 시작하면 db의 processing_status부터 다시 시작
+
+// video 처리 event 종류 (SSE의 event 이름)
+const (
+	videoEventReceived    = "received"    // 업로드를 다 받아서 처리 job을 만듦
+	videoEventQueued      = "queued"      // 처리에 실패해서 재시도 대기 (error에 이유)
+	videoEventProcessing  = "processing"  // worker가 처리 시작
+	videoEventProbed      = "probed"      // ffprobe로 화면비 계산 완료
+	videoEventTranscoding = "transcoding" // faststart 인코딩 중 (percent)
+	videoEventUploading   = "uploading"   // 저장소에 올리는 중 (percent)
+	videoEventPackaging   = "packaging"   // hls, dash package 인코딩 중 (percent)
+	videoEventReady       = "ready"       // 처리 완료
+	videoEventFailed      = "failed"      // 재시도를 다 해도 실패 (error에 이유)
+)
+
+// video 처리 event 하나
+type videoEvent struct {
+	Type    string   `json:"type"`
+	Percent *float64 `json:"percent,omitempty"`
+	Aspect  string   `json:"aspect,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Attempt int      `json:"attempt,omitempty"`
+}
+
+// 더 이상 event가 없는 마지막 event인지
+func (e videoEvent) final() bool {
+	return e.Type == videoEventReady || e.Type == videoEventFailed
+}
+
+// video별 처리 event를 구독자들에게 전달하는 구조체
+type videoEventHub struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan videoEvent]struct{}
+	// 처리 중인 video의 마지막 event (중간에 구독한 클라이언트에게 지금 상태를 바로 보내기 위해)
+	last map[uuid.UUID]videoEvent
+}
+
+func newVideoEventHub() *videoEventHub {
+	return &videoEventHub{
+		subscribers: map[uuid.UUID]map[chan videoEvent]struct{}{},
+		last:        map[uuid.UUID]videoEvent{},
+	}
+}
+
+// video의 구독자들에게 event 전달
+// @@@ 느린 구독자 때문에 worker가 멈추면 안 되므로 구독자 buffer가 차 있으면 가장 오래된 event를 버린다
+func (h *videoEventHub) publish(videoID uuid.UUID, event videoEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if event.final() {
+		delete(h.last, videoID)
+	} else {
+		h.last[videoID] = event
+	}
+	for ch := range h.subscribers[videoID] {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		// publish만 채널에 보내고 잠금 안에서 보내므로 하나 비우면 반드시 들어간다
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- event
+	}
+}
+
+// video의 event 구독 ==> (event 채널, 마지막 event(없으면 Type이 빈 문자열), 구독 해제 함수)
+func (h *videoEventHub) subscribe(videoID uuid.UUID) (<-chan videoEvent, videoEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan videoEvent, 16)
+	if h.subscribers[videoID] == nil {
+		h.subscribers[videoID] = map[chan videoEvent]struct{}{}
+	}
+	h.subscribers[videoID][ch] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[videoID], ch)
+		if len(h.subscribers[videoID]) == 0 {
+			delete(h.subscribers, videoID)
+		}
+	}
+	return ch, h.last[videoID], unsubscribe
+}
+
+// 진행률(0~100)을 받아 eventType event로 발행하는 함수를 만드는 apiConfig method
+// @@@ ffmpeg, 업로드 진행률은 아주 자주 불리므로 정수 %가 바뀔 때만 발행한다
+func (cfg *apiConfig) progressReporter(videoID uuid.UUID, eventType string) func(percent float64) {
+	var mu sync.Mutex
+	lastPercent := -1.0
+	return func(percent float64) {
+		percent = math.Floor(percent)
+		// multipart upload는 여러 goroutine에서 부르므로 잠금 안에서 발행해야 %가 거꾸로 가지 않는다
+		mu.Lock()
+		defer mu.Unlock()
+		if percent <= lastPercent {
+			return
+		}
+		lastPercent = percent
+		cfg.videoEvents.publish(videoID, videoEvent{Type: eventType, Percent: &percent})
+	}
+}
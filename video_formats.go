@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// @@@ 휴대폰은 MOV(HEVC), 브라우저 녹화는 WebM(VP8, VP9, Opus)으로 저장하는 경우가 많아서 mp4만 받으면 다시 변환해서 올려야 했다
+// @@@ ==> VIDEO_UPLOAD_TYPES에 적힌 container 형식은 모두 받고 처리 job에서 H.264/AAC mp4로 맞춘다 (processVideoForFastStart)
+// @@@ 이미 H.264/AAC인 영상은 예전처럼 stream copy만 하므로 다시 인코딩하지 않는다
+
+// 업로드를 받을 수 있는 영상 container 형식별 확장자
+var videoUploadExts = map[string]string{
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
+	"video/webm":       ".webm",
+	"video/x-matroska": ".mkv",
+}
+
+// VIDEO_UPLOAD_TYPES 기본값
+const defaultVideoUploadTypes = "video/mp4,video/quicktime,video/webm,video/x-matroska"
+
+// 저장소에 올라가는 영상 형식 (업로드 형식과 상관없이 mp4로 맞춘다)
+const storedVideoMediaType = "video/mp4"
+
+// VIDEO_UPLOAD_TYPES 환경변수(ex: video/mp4,video/webm)를 읽는 함수
+func parseVideoUploadTypes(spec string) ([]string, error) {
+	types := []string{}
+	for _, mediaType := range strings.Split(spec, ",") {
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if _, ok := videoUploadExts[mediaType]; !ok {
+			return nil, fmt.Errorf("unsupported video type %q (must be one of %s)", mediaType, defaultVideoUploadTypes)
+		}
+		if !slices.Contains(types, mediaType) {
+			types = append(types, mediaType)
+		}
+	}
+	return types, nil
+}
+
+// 업로드를 받을 수 있는 영상 형식인지 확인하는 apiConfig method
+func (cfg *apiConfig) allowedVideoType(mediaType string) bool {
+	return slices.Contains(cfg.videoUploadTypes, mediaType)
+}
+
+// 받을 수 없는 영상 형식일 때 응답할 에러 메시지
+func (cfg *apiConfig) videoTypeError() string {
+	return "video file type must be one of " + strings.Join(cfg.videoUploadTypes, ", ")
+}
+
+// 파일 이름의 확장자로 영상 형식을 찾는 함수 (모르면 빈 문자열)
+// @@@ 브라우저는 .mkv 같은 파일의 Content-Type을 비워서 보내는 경우가 있다
+func videoTypeFromFileName(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for mediaType, typeExt := range videoUploadExts {
+		if typeExt == ext {
+			return mediaType
+		}
+	}
+	return ""
+}
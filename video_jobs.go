@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// @@@ 예전에는 업로드 요청 안에서 ffprobe, ffmpeg, 저장소 업로드까지 끝냈기 때문에
+// @@@ 큰 영상은 client timeout이 나고 처리 중에 서버가 죽으면 받은 파일도 사라졌다
+// @@@ ==> 업로드 handler는 원본 파일을 VIDEO_JOB_DIR에 두고 video_jobs에 job을 넣은 뒤 202로 바로 응답
+// @@@ VIDEO_WORKERS개의 worker가 job을 꺼내 processUploadedVideo로 처리하고 실패하면 backoff 후 재시도
+// @@@ 클라이언트는 GET /api/videos/{videoID}의 processing_status로 처리 상태를 확인한다
+
+// 원본 파일로 처리 job을 만들고 worker를 깨우는 apiConfig method
+// job에 넘긴 원본 파일은 job이 끝날 때 worker가 지운다 (에러를 반환하면 호출한 쪽에서 지워야 한다)
+// 같은 video의 아직 시작하지 않은 job은 새 업로드로 대체되므로 원본 파일도 지운다
+// @@@ 원본 파일 크기만큼 유저 용량을 예약하고 모자라면 database.ErrQuotaExceeded 반환 (job이 끝나면 예약이 풀린다)
+func (cfg *apiConfig) enqueueVideoJob(video database.Video, filePath, mediaType, contentHash string) (database.Video, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return video, err
+	}
+	_, superseded, err := cfg.db.EnqueueVideoJob(database.CreateVideoJobParams{
+		VideoID:       video.ID,
+		FilePath:      filePath,
+		MediaType:     mediaType,
+		ContentHash:   contentHash,
+		ReservedBytes: stat.Size(),
+	}, cfg.userQuotaBytes)
+	if err != nil {
+		return video, err
+	}
+	for _, job := range superseded {
+		removeVideoJobFile(job)
+	}
+	cfg.videoEvents.publish(video.ID, videoEvent{Type: videoEventReceived})
+	cfg.wakeVideoWorkers()
+
+	video.ProcessingStatus = database.ProcessingStatusQueued
+	video.ProcessingError = nil
+	return video, nil
+}
+
+// 쉬고 있는 worker 하나를 깨운다 (이미 깨우는 중이면 아무것도 하지 않음)
+func (cfg *apiConfig) wakeVideoWorkers() {
+	select {
+	case cfg.videoJobWake <- struct{}{}:
+	default:
+	}
+}
+
+// 서버가 처리 중에 멈춰서 남은 job을 다시 대기 상태로 돌리고 worker들을 시작하는 apiConfig method
+// @@@ worker를 시작하기 전에 돌려야 방금 가져간 job을 다시 돌리는 일이 없다
+func (cfg *apiConfig) startVideoWorkers(ctx context.Context, workers int, pollInterval time.Duration) {
+	n, err := cfg.db.RequeueProcessingVideoJobs()
+	if err != nil {
+		log.Printf("error requeueing interrupted video jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("requeued %d video jobs interrupted by a restart", n)
+	}
+	for range workers {
+		go cfg.runVideoWorker(ctx, pollInterval)
+	}
+}
+
+// 처리할 job이 없을 때까지 꺼내서 처리하고, 깨울 때까지 또는 pollInterval마다 다시 확인하는 apiConfig method
+// @@@ 재시도 job은 run_at이 되어도 깨워주는 쪽이 없으므로 pollInterval마다 확인한다
+func (cfg *apiConfig) runVideoWorker(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := cfg.db.ClaimVideoJob(time.Now().UTC())
+			if err != nil {
+				log.Printf("error claiming video job: %v", err)
+				break
+			}
+			if job.ID == "" {
+				break
+			}
+			// 남은 job이 더 있을 수 있으므로 다른 worker도 확인하도록
+			cfg.wakeVideoWorkers()
+			cfg.runVideoJob(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.videoJobWake:
+		}
+	}
+}
+
+// job 하나를 처리하는 apiConfig method
+// 실패하면 VIDEO_JOB_MAX_ATTEMPTS번까지 30초, 1분, 2분, ... (최대 30분) 뒤에 다시 시도하고 그래도 실패하면 video를 failed로
+func (cfg *apiConfig) runVideoJob(ctx context.Context, job database.VideoJob) {
+	cfg.videoEvents.publish(job.VideoID, videoEvent{Type: videoEventProcessing, Attempt: job.Attempts})
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err == nil && video.ID == uuid.Nil {
+		// 처리하기 전에 video가 삭제된 경우
+		cfg.finishVideoJob(job, nil)
+		return
+	}
+	if err == nil {
+		// @@@ 원본 파일이 없으면(VIDEO_JOB_DIR이 지워진 경우 등) 다시 시도해도 소용없다
+		if _, statErr := os.Stat(job.FilePath); statErr != nil {
+			log.Printf("source file of video %s is gone, giving up: %v", job.VideoID, statErr)
+			cfg.finishVideoJob(job, errors.New("uploaded file is no longer available, upload the video again"))
+			return
+		}
+		_, err = cfg.processUploadedVideo(ctx, video, job.FilePath, job.MediaType, job.ContentHash)
+	}
+	// @@@ 용량 초과는 다시 시도해도 같으므로 바로 실패 처리
+	if err == nil || job.Attempts >= cfg.videoJobMaxAttempts || errors.Is(err, database.ErrQuotaExceeded) {
+		if err != nil {
+			log.Printf("error processing video %s (attempt %d), giving up: %v", job.VideoID, job.Attempts, err)
+		}
+		cfg.finishVideoJob(job, err)
+		return
+	}
+
+	backoff := min(30*time.Second<<min(job.Attempts-1, 10), 30*time.Minute)
+	log.Printf("error processing video %s (attempt %d), retrying in %s: %v", job.VideoID, job.Attempts, backoff, err)
+	if err := cfg.db.RetryVideoJob(job, err.Error(), time.Now().UTC().Add(backoff)); err != nil {
+		log.Printf("error rescheduling video job %s: %v", job.ID, err)
+	}
+	cfg.videoEvents.publish(job.VideoID, videoEvent{Type: videoEventQueued, Error: err.Error(), Attempt: job.Attempts})
+}
+
+// job 기록과 원본 파일을 지우고 video 상태를 ready(jobErr가 nil) 또는 failed로 바꾸는 apiConfig method
+func (cfg *apiConfig) finishVideoJob(job database.VideoJob, jobErr error) {
+	errMsg := ""
+	if jobErr != nil {
+		errMsg = jobErr.Error()
+	}
+	if err := cfg.db.FinishVideoJob(job, errMsg); err != nil {
+		// 기록이 남아 있으면 서버를 다시 시작할 때 다시 처리되므로 원본 파일은 지우지 않는다
+		log.Printf("error finishing video job %s: %v", job.ID, err)
+		return
+	}
+	removeVideoJobFile(job)
+
+	// @@@ 처리 중에 같은 video에 새 업로드가 들어왔으면 마지막 event는 그 job이 끝날 때 보낸다
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil {
+		log.Printf("error getting video %s after its job finished: %v", job.VideoID, err)
+		return
+	}
+	switch video.ProcessingStatus {
+	case database.ProcessingStatusReady:
+		cfg.videoEvents.publish(job.VideoID, videoEvent{Type: videoEventReady})
+	case database.ProcessingStatusFailed:
+		cfg.videoEvents.publish(job.VideoID, videoEvent{Type: videoEventFailed, Error: errMsg})
+	}
+}
+
+func removeVideoJobFile(job database.VideoJob) {
+	if err := os.Remove(job.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("couldn't delete source file of video job %s: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// probe-videos 명령어 보고서
+type videoMetadataReport struct {
+	DryRun  bool        `json:"dry_run"`
+	Probed  []uuid.UUID `json:"probed"`  // 영상 정보를 채운 (dry-run이면 채울) video
+	Skipped int         `json:"skipped"` // 보관 중이라 읽을 수 없는 video 개수
+	Errors  []string    `json:"errors"`
+}
+
+// 영상은 있는데 영상 정보가 없는 video들의 영상 blob을 ffprobe로 읽어 db에 채우는 apiConfig method
+// @@@ 한 video가 실패해도 나머지는 계속 진행하고 실패 내역은 보고서에 남긴다
+// @@@ all이면 영상 정보가 있는 video도 다시 읽는다 (회전 정보를 적용하기 전에 세로 영상을 가로 크기로 저장한 경우)
+func (cfg *apiConfig) backfillVideoMetadata(ctx context.Context, dryRun, all bool) (videoMetadataReport, error) {
+	report := videoMetadataReport{DryRun: dryRun, Probed: []uuid.UUID{}, Errors: []string{}}
+
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return report, fmt.Errorf("error getting videos: %w", err)
+	}
+	for _, video := range videos {
+		if video.VideoURL == nil || (video.DurationSeconds > 0 && !all) {
+			continue
+		}
+		blob, err := cfg.db.GetVideoBlob(video.ID, database.BlobKindVideo)
+		if err != nil {
+			return report, fmt.Errorf("error getting blob of video %s: %w", video.ID, err)
+		}
+		if blob.Hash == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: video is not stored as a blob", video.ID))
+			continue
+		}
+		if blob.ArchiveStatus != "" {
+			report.Skipped++
+			continue
+		}
+		if dryRun {
+			report.Probed = append(report.Probed, video.ID)
+			continue
+		}
+
+		meta, err := cfg.probeBlob(ctx, blob)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", video.ID, err))
+			continue
+		}
+		if err := cfg.db.SetVideoMetadata(video.ID, meta); err != nil {
+			return report, fmt.Errorf("error updating metadata of video %s: %w", video.ID, err)
+		}
+		report.Probed = append(report.Probed, video.ID)
+	}
+	return report, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// @@@ hls, dash package는 video의 package prefix(packages/<videoID>/) 아래에 올라가므로 signed cookie 하나로 전부 허용된다
+// @@@ 형식이 여러 개여도 video의 package는 하나 (dash segment를 hls playlist도 같이 가리킬 수 있으므로)
+
+// package 형식별 manifest 파일 이름
+var packageManifests = map[string]string{
+	database.PackageFormatHLS:  hlsMasterPlaylist,
+	database.PackageFormatDASH: dashManifest,
+}
+
+// PACKAGE_FORMATS 값을 읽는 함수 (ex: hls, dash, hls,dash)
+func parsePackageFormats(spec string) ([]string, error) {
+	formats := []string{}
+	for _, format := range strings.Split(spec, ",") {
+		format = strings.TrimSpace(format)
+		if _, ok := packageManifests[format]; !ok {
+			return nil, fmt.Errorf("unknown package format %q (must be hls or dash)", format)
+		}
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
+
+// package 파일 확장자별 Content-Type
+var packageContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".mpd":  "application/dash+xml",
+	".m4s":  "video/iso.segment",
+	".vtt":  "text/vtt",
+	".jpg":  "image/jpeg",
+}
+
+// 디렉토리 안의 package 파일들을 저장소의 prefix 아래에 올리는 apiConfig method
+// 올린 객체 목록 반환 (실패하면 이미 올린 객체는 지운다)
+// @@@ 상대 경로를 그대로 key로 쓰므로 manifest 안의 상대 url이 저장소에서도 그대로 맞는다
+func (cfg *apiConfig) uploadPackageDir(ctx context.Context, dir, prefix string, video database.Video, format string) ([]database.PackageObject, error) {
+	objects := []database.PackageObject{}
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(rel)
+		contentType, ok := packageContentTypes[path.Ext(key)]
+		if !ok {
+			contentType = "application/octet-stream"
+		}
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if err := storage.PutFile(ctx, cfg.store, key, f, contentType); err != nil {
+			return err
+		}
+		objects = append(objects, database.PackageObject{
+			VideoID: video.ID,
+			Format:  format,
+			Store:   storeMedia,
+			Key:     key,
+			Size:    stat.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		for _, obj := range objects {
+			if delErr := cfg.store.Delete(ctx, obj.Key); delErr != nil {
+				log.Printf("couldn't delete partially uploaded package object %s: %v", obj.Key, delErr)
+			}
+		}
+		return nil, err
+	}
+	return objects, nil
+}
+
+// 원본 영상으로 PACKAGE_FORMATS 형식의 package를 만들어 올리고 video의 형식별 url을 갱신하는 apiConfig method
+// 형식별 manifest url 반환
+// @@@ dash가 있으면 fMP4 segment 하나로 hls까지, hls만 있으면 MPEG-TS segment (오래된 기기 호환)
+// @@@ key에 원본 hash를 넣어 영상을 바꾸면 새 prefix에 올라간다 ==> cdn에 캐시된 이전 manifest와 섞이지 않는다
+func (cfg *apiConfig) packageVideo(ctx context.Context, video database.Video, filePath, contentHash string) (map[string]string, error) {
+	layout := database.PackageFormatHLS
+	if slices.Contains(cfg.packageFormats, database.PackageFormatDASH) {
+		layout = database.PackageFormatDASH
+	}
+	prefix := fmt.Sprintf("%s%s/%s/", videoPackagePrefix(video.ID), layout, contentHash)
+	urls := map[string]string{}
+	for _, format := range cfg.packageFormats {
+		urls[format] = cfg.objectURL(storeMedia, prefix+packageManifests[format])
+	}
+	if packageURLsMatch(video, urls) {
+		// 같은 내용을 다시 올린 경우
+		return urls, nil
+	}
+
+	width, height, hasAudio, err := probeHLSSource(filePath)
+	if err != nil {
+		return nil, err
+	}
+	renditions := selectHLSRenditions(cfg.hlsLadder, min(width, height))
+
+	outDir, err := os.MkdirTemp("", "tubely-package_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+	onProgress := cfg.progressReporter(video.ID, videoEventPackaging)
+	if layout == database.PackageFormatDASH {
+		withHLS := slices.Contains(cfg.packageFormats, database.PackageFormatHLS)
+		err = transcodeDASH(filePath, outDir, renditions, height > width, hasAudio, withHLS, cfg.hlsSegmentSeconds, onProgress)
+	} else {
+		err = transcodeHLS(filePath, outDir, renditions, height > width, hasAudio, cfg.hlsSegmentSeconds, onProgress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := cfg.uploadPackageDir(ctx, outDir, prefix, video, layout)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading %s package: %w", layout, err)
+	}
+	// 이전 package 객체는 삭제 예약되고 바로 한번 지워본다
+	queued, err := cfg.db.ReplaceVideoPackage(video.ID, objects, urls)
+	if err != nil {
+		return nil, err
+	}
+	cfg.attemptPendingDeletions(ctx, queued)
+	return urls, nil
+}
+
+// video의 형식별 url이 urls와 모두 같은지 (설정된 형식이 바뀌었으면 false)
+func packageURLsMatch(video database.Video, urls map[string]string) bool {
+	current := map[string]*string{
+		database.PackageFormatHLS:  video.HLSURL,
+		database.PackageFormatDASH: video.DASHURL,
+	}
+	for format, url := range current {
+		want, ok := urls[format]
+		if ok != (url != nil) || ok && *url != want {
+			return false
+		}
+	}
+	return true
+}
+
+// video의 package를 지우는 apiConfig method (영상을 바꿨는데 새 package를 만들지 못한 경우)
+// @@@ 이전 영상의 package가 새 영상과 같이 재생되지 않도록
+func (cfg *apiConfig) removeVideoPackage(ctx context.Context, video database.Video) error {
+	if video.HLSURL == nil && video.DASHURL == nil {
+		return nil
+	}
+	queued, err := cfg.db.ReplaceVideoPackage(video.ID, nil, nil)
+	if err != nil {
+		return err
+	}
+	cfg.attemptPendingDeletions(ctx, queued)
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// 디스크에 다 받아진 영상 파일(filePath)을 처리해서 저장소에 올리고 video의 VideoURL을 갱신하는 apiConfig method
+// ffprobe로 영상 정보 읽기 ==> faststart 인코딩 ==> 저장소 업로드 ==> db 갱신 ==> (package, sprite, 자동 썸네일) 순서
+// @@@ multipart form, tus, 직접 업로드 모두 처리 job을 만들고 worker(runVideoJob)가 이 method로 처리한다
+// @@@ filePath의 원본 파일은 호출한 쪽에서 삭제해야 한다
+// @@@ contentHash는 원본 파일의 sha256 hash (빈 문자열이면 여기서 계산)
+// @@@ 같은 hash의 blob이 이미 있으면 인코딩과 업로드를 건너뛰고 그 객체를 같이 참조한다
+func (cfg *apiConfig) processUploadedVideo(ctx context.Context, video database.Video, filePath, mediaType, contentHash string) (database.Video, error) {
+	if contentHash == "" {
+		hash, err := hashFile(filePath)
+		if err != nil {
+			return video, fmt.Errorf("unable to hash the video file: %w", err)
+		}
+		contentHash = hash
+	}
+
+	// 임시파일을 ffprobe명령어로 살펴보고 영상 정보(길이, 해상도, codec 등)를 얻기
+	// 반드시 파일이 디스크에 다 저장된 뒤에 실행해야 한다
+	// @@@ 같은 내용의 blob을 재사용해도 video마다 영상 정보를 저장해야 하므로 blob을 찾기 전에 실행
+	probe, err := probeVideoFile(filePath)
+	if err != nil {
+		return video, fmt.Errorf("unable to probe the video file: %w", err)
+	}
+	videoAspectRatio := videoAspectLabel(probe.Width, probe.Height)
+	cfg.videoEvents.publish(video.ID, videoEvent{Type: videoEventProbed, Aspect: videoAspectRatio})
+
+	blob, newVideoURL, err := cfg.storeOrReuseVideoBlob(ctx, video, filePath, mediaType, contentHash, probe, videoAspectRatio)
+	if err != nil {
+		return video, err
+	}
+	video.VideoURL = &newVideoURL
+
+	// 영상 정보 저장 (파일 크기는 저장소에 올라간 blob 크기, codec은 H.264/AAC로 맞춘 뒤의 codec)
+	meta := normalizedVideoMetadata(probe, cfg.videoAutoRotate, blob.Size)
+	if err := cfg.db.SetVideoMetadata(video.ID, meta); err != nil {
+		return video, fmt.Errorf("unable to update the video's metadata: %w", err)
+	}
+	video.VideoMetadata = meta
+
+	// HLS_LADDER가 설정되어 있으면 화질별 hls, dash package도 만든다
+	// @@@ mp4는 이미 저장되어 재생할 수 있으므로 실패해도 업로드는 성공으로 처리하고 로그만 남긴다
+	if len(cfg.hlsLadder) > 0 {
+		urls, err := cfg.packageVideo(ctx, video, filePath, contentHash)
+		if err != nil {
+			log.Printf("error packaging video %s: %v", video.ID, err)
+			if err := cfg.removeVideoPackage(ctx, video); err != nil {
+				log.Printf("error removing stale package of video %s: %v", video.ID, err)
+			}
+			urls = nil
+		}
+		video.HLSURL, video.DASHURL = nil, nil
+		if url, ok := urls[database.PackageFormatHLS]; ok {
+			video.HLSURL = &url
+		}
+		if url, ok := urls[database.PackageFormatDASH]; ok {
+			video.DASHURL = &url
+		}
+	}
+
+	// SPRITE_INTERVAL이 설정되어 있으면 seek bar 미리보기 sprite도 만든다
+	// @@@ package처럼 실패해도 업로드는 성공으로 처리하고 로그만 남긴다
+	if cfg.spriteInterval > 0 {
+		vttURL, err := cfg.generateVideoSprites(ctx, video, filePath, contentHash)
+		if err != nil {
+			log.Printf("error generating sprites of video %s: %v", video.ID, err)
+			if err := cfg.removeVideoSprites(ctx, video); err != nil {
+				log.Printf("error removing stale sprites of video %s: %v", video.ID, err)
+			}
+			vttURL = ""
+		}
+		video.SpritesVTTURL = nil
+		if vttURL != "" {
+			video.SpritesVTTURL = &vttURL
+		}
+	}
+
+	// 썸네일을 올리지 않았으면 영상에서 대표 frame을 골라 썸네일로
+	video = cfg.generateAutoThumbnail(ctx, video, filePath)
+
+	return video, nil
+}
+
+// 같은 내용의 blob이 있으면 재사용하고 없으면 인코딩해서 올린 뒤 video에 연결하는 apiConfig method
+// 연결한 blob과 video_url 반환
+// @@@ 같은 내용을 동시에 처리하는 job끼리 둘 다 blob이 없다고 보고 같은 key에 올리면 암호화할 때 서로 다른 data key로 덮어써서
+// @@@ 객체와 key 기록이 어긋날 수 있다 ==> blob 식별자로 잠가서 찾기, 올리기, 연결을 한 job씩 처리 (뒤의 job은 blob을 재사용)
+func (cfg *apiConfig) storeOrReuseVideoBlob(ctx context.Context, video database.Video, filePath, mediaType, contentHash string, probe videoProbe, videoAspectRatio string) (database.Blob, string, error) {
+	// @@@ key template에 {user_id}, {video_id}가 있으면 같은 범위 안에서만 blob 공유
+	blobID := cfg.blobID(database.BlobKindVideo, contentHash, video.UserID, video.ID)
+	unlock := cfg.blobLocks.Lock(blobID)
+	defer unlock()
+
+	blob, err := cfg.db.GetBlob(blobID)
+	if err != nil {
+		return database.Blob{}, "", fmt.Errorf("unable to look up the blob: %w", err)
+	}
+	stored := blob.Hash == ""
+	if stored {
+		// 처음 올라온 내용이면 인코딩해서 저장소에 올리기
+		blob, err = cfg.storeVideoBlob(ctx, video, filePath, mediaType, contentHash, probe, videoAspectRatio)
+		if err != nil {
+			return database.Blob{}, "", err
+		}
+	}
+
+	// @@@ faststart, H.264/AAC 인코딩 후의 크기는 업로드할 때 검사한 원본 크기보다 클 수 있으므로 연결하기 전에 다시 확인
+	// @@@ 이 job의 예약은 빼지 않고 계산되므로(GetUploadAllowance) 실제로 올라간 크기로 다시 검사하는 것
+	allowance, err := cfg.uploadAllowance(video, database.BlobKindVideo)
+	if err != nil {
+		return database.Blob{}, "", fmt.Errorf("unable to check storage quota: %w", err)
+	}
+	if allowance >= 0 && blob.Size > allowance {
+		if stored {
+			// 방금 올린 객체는 어디에서도 참조하지 않으므로 삭제 예약 (다른 blob이 같은 key를 쓰면 지우지 않는다)
+			queued, err := cfg.db.QueuePendingDeletions([]database.CreatePendingDeletionParams{{Store: blob.Store, Key: blob.Key, VideoID: video.ID}})
+			if err != nil {
+				log.Printf("error queueing deletion of %s/%s: %v", blob.Store, blob.Key, err)
+			}
+			cfg.attemptPendingDeletions(ctx, queued)
+		}
+		return database.Blob{}, "", fmt.Errorf("%w: processed video is %d bytes but only %d bytes remain", database.ErrQuotaExceeded, blob.Size, allowance)
+	}
+	if blob.ArchiveStatus != "" {
+		// 같은 내용이 보관되어 있으면 복원해서 다시 사용 (GLACIER 등이나 prefix, backend 방식은 복원이 끝날 때까지 archive_status가 restoring)
+		if _, err := cfg.requestBlobRestore(ctx, blob); err != nil {
+			return database.Blob{}, "", fmt.Errorf("unable to restore the archived blob: %w", err)
+		}
+		blob, err = cfg.db.GetBlob(blobID)
+		if err != nil {
+			return database.Blob{}, "", fmt.Errorf("unable to look up the blob: %w", err)
+		}
+	}
+
+	// newVideoURL는 s3 저장소면 "<cloud front domain name>/<fileName>", local 저장소면 /assets url
+	// @@@ prefix, backend 방식으로 보관된 blob은 복원 중에도 보관 위치에 있으므로 복원되면 돌아갈 원래 위치로 url을 만든다
+	// @@@ (복원은 videos의 url을 바꾸지 않으므로 보관 위치로 만들면 복원 후 지워진 객체를 가리키게 된다)
+	urlStore, urlKey := blob.Store, blob.Key
+	if blob.ArchivedFrom != "" {
+		urlStore, urlKey = storeMedia, blob.ArchivedFrom
+	}
+	newVideoURL := cfg.objectURL(urlStore, urlKey)
+
+	// @@@ cloud front 사용하면서 signed url 미사용
+	// // @@@ db에 저장되는 VideoURL은 <bucketName>,<fileName> 형태를 유지해야 handlerVideoGet과 같은 다른 함수에서도
+	// // @@@ <bucketName>,<fileName> 값을 접근해 dbVideoToSignedVideo가 사용가능해진다
+
+	// blob 참조 연결과 video_url 갱신을 하나의 transaction으로 처리
+	// @@@ 이전 영상의 blob은 참조가 0이 되면 삭제 예약된다
+	if err := cfg.db.AttachVideoBlob(video.ID, database.BlobKindVideo, blob.CreateBlobParams, newVideoURL); err != nil {
+		return database.Blob{}, "", fmt.Errorf("unable to update the video's metadata: %w", err)
+	}
+	return blob, newVideoURL, nil
+}
+
+// 영상 파일을 faststart 인코딩해서 VIDEO_KEY_TEMPLATE key로 저장소에 올리는 apiConfig method
+// probe, videoAspectRatio는 processUploadedVideo가 ffprobe로 읽은 정보와 화면비 (key template의 {aspect})
+// @@@ mediaType은 업로드된 형식이고 저장소에는 항상 mp4(storedVideoMediaType)로 올라간다
+func (cfg *apiConfig) storeVideoBlob(ctx context.Context, video database.Video, filePath, mediaType, contentHash string, probe videoProbe, videoAspectRatio string) (database.Blob, error) {
+	// @@@ faststart 인코딩인 새파일 생성 (H.264/AAC mp4가 아니면 다시 인코딩)
+	newFilePath, err := processVideoForFastStart(filePath, mediaType, probe, cfg.videoAutoRotate, cfg.progressReporter(video.ID, videoEventTranscoding))
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to create a new faststart encoding video file: %w", err)
+	}
+	// 임시 파일 삭제를 defer 걸어두기
+	defer os.Remove(newFilePath)
+
+	newTempFile, err := os.Open(newFilePath)
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to open the new faststart encoding video file: %w", err)
+	}
+	// 임시 파일 Close defer 해서 메모리 누수 방지
+	defer newTempFile.Close()
+	// @@@ defer는 LIFO
+	// // @@@ 따라서 newTempFile.Close()가 먼저 실행되고 그 다음에 os.Remove가 실행된다
+
+	stat, err := newTempFile.Stat()
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to stat the new faststart encoding video file: %w", err)
+	}
+
+	// @@@ 저장소에 파일 업로드 @@@
+
+	// 파일이름은 기본값이면 <prefix>/<hash>.<file_extension> 형태
+	// @@@ getS3AssetPath 대신 key template 사용
+	fileName, err := cfg.blobKey(database.BlobKindVideo, video.UserID, video.ID, contentHash, storedVideoMediaType, videoAspectRatio)
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to build the object key: %w", err)
+	}
+
+	// storage.PutFile로 저장소에 파일 업로드
+	// @@@ cfg.s3Client.PutObject를 직접 부르던 것을 저장소 인터페이스로 변경 ==> local 저장소도 사용 가능
+	// @@@ s3 저장소에서 part 크기 이상인 파일은 multipart upload로 part별로 병렬 업로드, 실패한 part만 재시도
+	// @@@ MEDIA_ENCRYPTION이 설정되어 있으면 암호화해서 올린다 (blob 크기는 평문 크기 그대로)
+	// @@@ 올리는 동안 진행률은 uploading event로 발행
+	onUpload := cfg.progressReporter(video.ID, videoEventUploading)
+	uploadCtx := storage.WithProgress(ctx, func(done, total int64) {
+		onUpload(float64(done) / float64(max(total, 1)) * 100)
+	})
+	err = cfg.putMediaObject(uploadCtx, storeMedia, fileName, newTempFile, storedVideoMediaType)
+	if err != nil {
+		return database.Blob{}, fmt.Errorf("unable to upload the file to storage: %w", err)
+	}
+
+	return database.Blob{
+		CreateBlobParams: database.CreateBlobParams{
+			Hash:        cfg.blobID(database.BlobKindVideo, contentHash, video.UserID, video.ID),
+			Store:       storeMedia,
+			Key:         fileName,
+			Size:        stat.Size(),
+			ContentType: storedVideoMediaType,
+			Aspect:      videoAspectRatio,
+		},
+	}, nil
+}